@@ -0,0 +1,238 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"intent-classifier/classifier"
+)
+
+// sizeUnits are the suffixes parseSize accepts, in powers of 1024
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"gib", 1 << 30}, {"gb", 1 << 30}, {"g", 1 << 30},
+	{"mib", 1 << 20}, {"mb", 1 << 20}, {"m", 1 << 20},
+	{"kib", 1 << 10}, {"kb", 1 << 10}, {"k", 1 << 10},
+	{"b", 1},
+}
+
+// parseSize parses sizes such as "500MB", "1.5G" or "4096" (bytes)
+func parseSize(s string) (int64, error) {
+	value := strings.ToLower(strings.TrimSpace(s))
+	unit := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(value, u.suffix) {
+			value, unit = strings.TrimSpace(strings.TrimSuffix(value, u.suffix)), u.bytes
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q: expected e.g. 500MB or 2GB", s)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// formatSize formats a byte count for humans, e.g. "1.5 MB"
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// byteSize is a flag.Value holding a size parsed by parseSize
+type byteSize int64
+
+func (s *byteSize) String() string {
+	if *s == 0 {
+		return "0"
+	}
+	return formatSize(int64(*s))
+}
+
+func (s *byteSize) Set(value string) error {
+	n, err := parseSize(value)
+	if err != nil {
+		return err
+	}
+	*s = byteSize(n)
+	return nil
+}
+
+// addMaxCacheSizeFlag registers --max-cache-size. IC_MAX_CACHE_SIZE sets
+// the default, so the flag still wins.
+func addMaxCacheSizeFlag(fs *flag.FlagSet, size *byteSize) {
+	if env := os.Getenv("IC_MAX_CACHE_SIZE"); env != "" {
+		if err := size.Set(env); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Invalid IC_MAX_CACHE_SIZE env var '%s', using default\n", env)
+		}
+	}
+	fs.Var(size, "max-cache-size", "Evict least recently used embeddings and LLM responses beyond this `size`, e.g. 500MB (0 = no limit, env: IC_MAX_CACHE_SIZE)")
+}
+
+// enforceCacheLimit evicts cache entries beyond maxSize bytes if the cache
+// was written to since CacheWrites returned writes. Failures only warn.
+func enforceCacheLimit(maxSize int64, writes int64) {
+	if maxSize <= 0 || classifier.CacheWrites() == writes {
+		return
+	}
+	if _, err := classifier.EnforceCacheLimit(maxSize); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to enforce the cache size limit: %v\n", err)
+	}
+}
+
+// runCache implements the "cache" subcommand
+func runCache(args []string) error {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s cache <command> [options]\n\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Commands:")
+		fmt.Fprintln(os.Stderr, "  stats                 Size of each cache section, broken down by model")
+		fmt.Fprintln(os.Stderr, "  list [section...]     Every cache file, least recently used first")
+		fmt.Fprintln(os.Stderr, "  prune [options]       Evict least recently used or old entries")
+		fmt.Fprintln(os.Stderr, "  clear [section...]    Remove everything in the given sections (default: all)")
+		fmt.Fprintf(os.Stderr, "\nSections: %s\n", strings.Join(classifier.CacheSections, ", "))
+	}
+	if len(args) == 0 {
+		usage()
+		return errors.New("missing cache command")
+	}
+
+	switch args[0] {
+	case "stats":
+		return runCacheStats(os.Stdout, args[1:])
+	case "list":
+		return runCacheList(os.Stdout, args[1:])
+	case "prune":
+		return runCachePrune(os.Stdout, args[1:])
+	case "clear":
+		return runCacheClear(os.Stdout, args[1:])
+	}
+	usage()
+	return fmt.Errorf("unknown cache command %q: expected stats, list, prune, or clear", args[0])
+}
+
+// runCacheStats prints the size of each section and of each model in it
+func runCacheStats(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("cache stats", flag.ExitOnError)
+	fs.Parse(args)
+
+	entries, err := classifier.ScanCache()
+	if err != nil {
+		return err
+	}
+	groups := classifier.GroupCache(entries)
+
+	fmt.Fprintf(w, "📦 Cache: %s\n", classifier.CacheDir())
+	var total int64
+	for _, section := range classifier.CacheSections {
+		var files int
+		var size int64
+		for _, group := range groups {
+			if group.Section == section {
+				files += group.Files
+				size += group.Size
+			}
+		}
+		total += size
+		fmt.Fprintf(w, "\n%-10s %10s  %6d files\n", section, formatSize(size), files)
+		for _, group := range groups {
+			if group.Section == section {
+				fmt.Fprintf(w, "  %10s  %6d files  used %s  %s\n", formatSize(group.Size), group.Files, group.Used.Local().Format(time.DateTime), group.Model)
+			}
+		}
+	}
+	fmt.Fprintf(w, "\n%-10s %10s  %6d files\n", "total", formatSize(total), len(entries))
+	return nil
+}
+
+// runCacheList prints every file of the given sections
+func runCacheList(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("cache list", flag.ExitOnError)
+	fs.Parse(args)
+
+	entries, err := classifier.ScanCache(fs.Args()...)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s  %10s  %-10s  %s  %s\n", entry.Used.Local().Format(time.DateTime), formatSize(entry.Size), entry.Section, entry.Path, entry.Model)
+	}
+	return nil
+}
+
+// runCachePrune evicts entries by size or age
+func runCachePrune(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("cache prune", flag.ExitOnError)
+	var maxSize byteSize
+	addMaxCacheSizeFlag(fs, &maxSize)
+	olderThan := fs.Duration("older-than", 0, "Evict entries not used for this long, e.g. 720h (0 = no limit)")
+	models := fs.Bool("models", false, "Also evict downloaded models, which are otherwise kept")
+	dryRun := fs.Bool("dry-run", false, "Show what would be removed without removing it")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s cache prune [options]\n\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Evicts the least recently used embeddings and LLM responses until the")
+		fmt.Fprintln(os.Stderr, "cache fits --max-cache-size, and those unused for longer than --older-than.")
+		fmt.Fprintln(os.Stderr, "")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if maxSize == 0 && *olderThan == 0 {
+		fs.Usage()
+		return errors.New("nothing to prune: give --max-cache-size or --older-than")
+	}
+	opts := classifier.PruneOptions{
+		Sections:  []string{classifier.CacheEmbeddings, classifier.CacheLLM},
+		MaxSize:   int64(maxSize),
+		OlderThan: *olderThan,
+		DryRun:    *dryRun,
+	}
+	if *models {
+		opts.Sections = classifier.CacheSections
+	}
+
+	removed, err := classifier.PruneCache(opts)
+	reportRemoved(w, removed, *dryRun)
+	return err
+}
+
+// runCacheClear removes whole sections
+func runCacheClear(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("cache clear", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "Show what would be removed without removing it")
+	fs.Parse(args)
+
+	removed, err := classifier.ClearCache(*dryRun, fs.Args()...)
+	reportRemoved(w, removed, *dryRun)
+	return err
+}
+
+// reportRemoved summarizes removed entries by section and model
+func reportRemoved(w io.Writer, removed []classifier.CacheEntry, dryRun bool) {
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+
+	var total int64
+	for _, group := range classifier.GroupCache(removed) {
+		total += group.Size
+		fmt.Fprintf(w, "  %10s  %6d files  %-10s  %s\n", formatSize(group.Size), group.Files, group.Section, group.Model)
+	}
+	fmt.Fprintf(w, "🧹 %s %d files (%s)\n", verb, len(removed), formatSize(total))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"intent-classifier/classifier"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{"0", 0, false},
+		{"4096", 4096, false},
+		{"512B", 512, false},
+		{"64k", 64 << 10, false},
+		{"500MB", 500 << 20, false},
+		{"500 MiB", 500 << 20, false},
+		{"1.5G", 3 << 29, false},
+		{"2GB", 2 << 30, false},
+		{"", 0, true},
+		{"lots", 0, true},
+		{"-1MB", 0, true},
+		{"10TB", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseSize(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSize(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseSize(%q) = %d, expected %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		bytes int64
+		want  string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1536, "1.5 KB"},
+		{500 << 20, "500.0 MB"},
+		{3 << 29, "1.5 GB"},
+	}
+
+	for _, tt := range tests {
+		if got := formatSize(tt.bytes); got != tt.want {
+			t.Errorf("formatSize(%d) = %q, expected %q", tt.bytes, got, tt.want)
+		}
+	}
+}
+
+func TestRunCacheClear(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	model := filepath.Join(classifier.CacheDir(), classifier.CacheModels, "embedding", "model.gguf")
+	if err := os.MkdirAll(filepath.Dir(model), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(model, make([]byte, 2048), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := runCacheClear(&out, []string{"--dry-run"}); err != nil {
+		t.Fatalf("runCacheClear() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "Would remove 1 files (2.0 KB)") || !strings.Contains(out.String(), "embedding/model.gguf") {
+		t.Errorf("unexpected dry run output:\n%s", out.String())
+	}
+	if _, err := os.Stat(model); err != nil {
+		t.Fatalf("dry run removed %s", model)
+	}
+
+	out.Reset()
+	if err := runCacheClear(&out, []string{"models"}); err != nil {
+		t.Fatalf("runCacheClear() error = %v", err)
+	}
+	if _, err := os.Stat(model); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed", model)
+	}
+
+	if err := runCacheClear(&out, []string{"vectors"}); err == nil {
+		t.Error("expected an error for an unknown section")
+	}
+}
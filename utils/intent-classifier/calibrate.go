@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+
+	"intent-classifier/classifier"
+)
+
+// calibrateTableStep is the threshold spacing of the rows printed per sweep;
+// the best threshold is always printed
+const calibrateTableStep = 0.05
+
+// calibrateOptions holds the settings of the calibrate subcommand
+type calibrateOptions struct {
+	datasetOptions
+	Beta        float64
+	From, To    float64
+	Step        float64
+	MinLabels   int
+	WriteConfig string
+}
+
+// frontmatterSuggestion is an item threshold to set as threshold: in the
+// item's frontmatter
+type frontmatterSuggestion struct {
+	Item      string   `json:"item"`
+	Path      string   `json:"path"`
+	Threshold float32  `json:"threshold"`
+	Current   *float32 `json:"current,omitempty"` // the item's frontmatter threshold, which overrides the config
+}
+
+// runCalibrate implements the "calibrate" subcommand
+func runCalibrate(args []string) error {
+	fs := flag.NewFlagSet("calibrate", flag.ExitOnError)
+	opts := calibrateOptions{}
+	opts.Mode = classifier.ModeEmbedding
+	addDatasetFlags(fs, &opts.datasetOptions)
+	fs.Float64Var(&opts.Beta, "beta", 1, "Maximise F-beta: above 1 favours recall, below 1 precision")
+	fs.Float64Var(&opts.From, "from", 0.05, "Lowest threshold of the sweep")
+	fs.Float64Var(&opts.To, "to", 0.95, "Highest threshold of the sweep")
+	fs.Float64Var(&opts.Step, "step", 0.01, "Threshold step of the sweep")
+	fs.IntVar(&opts.MinLabels, "min-labels", 3, "Labels an item needs before it gets a threshold of its own")
+	fs.StringVar(&opts.WriteConfig, "write-config", "", "Write the type and item thresholds into this config file, keeping its other settings")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s calibrate --dataset cases.yaml [options]\n\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Scores every labelled item of a dataset, sweeps the threshold overall, per")
+		fmt.Fprintln(os.Stderr, "item type and per item, prints precision and recall across the sweep and")
+		fmt.Fprintln(os.Stderr, "suggests the thresholds that maximise F-beta.")
+		fmt.Fprintln(os.Stderr, "")
+		fs.PrintDefaults()
+	}
+	if err := parseDatasetFlags(fs, &opts.datasetOptions, args); err != nil {
+		return err
+	}
+	if opts.Beta <= 0 {
+		return fmt.Errorf("invalid beta %g: must be above 0", opts.Beta)
+	}
+	if opts.MinLabels < 1 {
+		return fmt.Errorf("invalid min-labels %d: must be at least 1", opts.MinLabels)
+	}
+	candidates, err := classifier.ThresholdCandidates(opts.From, opts.To, opts.Step)
+	if err != nil {
+		return err
+	}
+
+	dataset, err := classifier.LoadDataset(opts.Dataset)
+	if err != nil {
+		return err
+	}
+
+	opts.explainAll = true
+	items, results, err := classifyDataset(opts.datasetOptions, dataset)
+	if err != nil {
+		return err
+	}
+	explanations := make([][]classifier.Explanation, len(results))
+	for i, result := range results {
+		explanations[i] = result.Explanations
+	}
+	observations := classifier.Observe(dataset.Cases, explanations, items)
+	cal := classifier.Calibrate(observations, candidates, opts.Beta, opts.MinLabels)
+	suggestions := suggestFrontmatter(cal, items)
+
+	if opts.WriteConfig != "" {
+		if err := writeCalibratedConfig(opts.WriteConfig, cal.Thresholds); err != nil {
+			return err
+		}
+	}
+
+	if opts.Format == formatJSON {
+		return writeCalibrationJSON(os.Stdout, cal, suggestions)
+	}
+	writeCalibrationReport(os.Stdout, cal, suggestions, len(dataset.Cases), opts)
+	warnFrontmatterThresholds(cal, items)
+	return nil
+}
+
+// suggestFrontmatter returns the item thresholds of cal as frontmatter
+// settings, in the order of cal.Items
+func suggestFrontmatter(cal classifier.Calibration, items []classifier.Item) []frontmatterSuggestion {
+	byName := make(map[string]classifier.Item, len(items))
+	for _, item := range items {
+		byName[item.Name] = item
+	}
+	suggestions := []frontmatterSuggestion{}
+	for _, sweep := range cal.Items {
+		item := byName[sweep.Name]
+		suggestions = append(suggestions, frontmatterSuggestion{
+			Item:      item.Name,
+			Path:      item.Path,
+			Threshold: sweep.Best.Threshold,
+			Current:   item.Metadata.Threshold,
+		})
+	}
+	return suggestions
+}
+
+// warnFrontmatterThresholds warns about items whose frontmatter threshold
+// would override the calibrated type threshold of the config
+func warnFrontmatterThresholds(cal classifier.Calibration, items []classifier.Item) {
+	for _, item := range items {
+		if item.Metadata.Threshold == nil {
+			continue
+		}
+		if _, calibrated := cal.Thresholds.Items[item.Name]; calibrated {
+			continue
+		}
+		if threshold, ok := cal.Thresholds.Types[item.Type]; ok {
+			fmt.Fprintf(os.Stderr, "Warning: %s sets threshold: %g in its frontmatter, which overrides the calibrated %s threshold %g\n", item.Path, *item.Metadata.Threshold, item.Type, threshold)
+		}
+	}
+}
+
+// writeCalibratedConfig merges thresholds into the config file at path,
+// creating it when it does not exist
+func writeCalibratedConfig(path string, thresholds classifier.Thresholds) error {
+	config, err := classifier.LoadConfig(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	config.Thresholds = config.Thresholds.Merge(thresholds)
+
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	if err := classifier.WriteFileAtomic(path, data); err != nil {
+		return err
+	}
+	if len(config.Thresholds.Priorities) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %s sets priority thresholds, which take precedence over the type thresholds for items with a priority\n", path)
+	}
+	return nil
+}
+
+// calibrationJSON is the document written by calibrate --format json
+type calibrationJSON struct {
+	SchemaVersion int                     `json:"schema_version"`
+	Frontmatter   []frontmatterSuggestion `json:"frontmatter"`
+	classifier.Calibration
+}
+
+// writeCalibrationJSON writes the sweeps and the suggested thresholds
+func writeCalibrationJSON(w io.Writer, cal classifier.Calibration, suggestions []frontmatterSuggestion) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(calibrationJSON{SchemaVersion: outputSchemaVersion, Frontmatter: suggestions, Calibration: cal})
+}
+
+// writeCalibrationReport prints the sweeps and the suggested thresholds for
+// humans
+func writeCalibrationReport(w io.Writer, cal classifier.Calibration, suggestions []frontmatterSuggestion, cases int, opts calibrateOptions) {
+	score := fmt.Sprintf("F%g", cal.Beta)
+	fmt.Fprintf(w, "📊 Calibrated on %d case%s (%d label%s), maximising %s\n", cases, plural(cases), cal.Default.Labels, plural(cal.Default.Labels), score)
+
+	writeSweep(w, "all items", cal.Default, score)
+	for _, sweep := range cal.Types {
+		writeSweep(w, "type "+sweep.Name, sweep, score)
+	}
+	for _, sweep := range cal.Items {
+		writeSweep(w, "item "+sweep.Name, sweep, score)
+	}
+
+	fmt.Fprintf(w, "\n✅ Suggested thresholds (%s %.2f at the current thresholds, %.2f calibrated):\n", score, cal.Current.FBeta, cal.Calibrated.FBeta)
+	fmt.Fprintf(w, "   --threshold %.2f\n", cal.Default.Best.Threshold)
+	for _, itemType := range sortedThresholdKeys(cal.Thresholds.Types) {
+		fmt.Fprintf(w, "   thresholds.types.%s: %.2f\n", itemType, cal.Thresholds.Types[itemType])
+	}
+	for _, name := range sortedThresholdKeys(cal.Thresholds.Items) {
+		fmt.Fprintf(w, "   thresholds.items.%s: %.2f\n", name, cal.Thresholds.Items[name])
+	}
+
+	if opts.WriteConfig != "" {
+		fmt.Fprintf(w, "\n✅ Wrote the type and item thresholds to %s\n", opts.WriteConfig)
+	} else {
+		fmt.Fprintln(w, "\n💡 Write them to a config file with --write-config <embed>/intent-classifier.yaml")
+	}
+	if len(suggestions) > 0 {
+		fmt.Fprintln(w, "\nOr set the item thresholds in the frontmatter:")
+		for _, s := range suggestions {
+			note := ""
+			if s.Current != nil {
+				note = fmt.Sprintf(" (currently %g, which overrides the config)", *s.Current)
+			}
+			fmt.Fprintf(w, "   %s: threshold: %.2f%s\n", s.Path, s.Threshold, note)
+		}
+	}
+}
+
+// writeSweep prints the precision/recall table of one sweep, a row every
+// calibrateTableStep plus the best threshold, marked with an arrow
+func writeSweep(w io.Writer, title string, sweep classifier.Sweep, score string) {
+	fmt.Fprintf(w, "\n%s (%d label%s, %d expected)\n", title, sweep.Labels, plural(sweep.Labels), sweep.Positives)
+	fmt.Fprintf(w, "    %9s  %9s  %6s  %5s  %3s  %3s  %3s\n", "threshold", "precision", "recall", score, "tp", "fp", "fn")
+	for _, p := range sweep.Points {
+		best := p.Threshold == sweep.Best.Threshold
+		steps := float64(p.Threshold) / calibrateTableStep
+		if !best && math.Abs(steps-math.Round(steps)) > 1e-3 {
+			continue
+		}
+		marker := "  "
+		if best {
+			marker = "→ "
+		}
+		precision := metric(p.Precision, p.TruePositives+p.FalsePositives)
+		recall := metric(p.Recall, p.TruePositives+p.FalseNegatives)
+		fmt.Fprintf(w, "  %s%9.2f  %9s  %6s  %5.2f  %3d  %3d  %3d\n", marker, p.Threshold, precision, recall, p.FBeta, p.TruePositives, p.FalsePositives, p.FalseNegatives)
+	}
+}
+
+// sortedThresholdKeys returns the keys of thresholds in order
+func sortedThresholdKeys(thresholds map[string]float32) []string {
+	keys := make([]string, 0, len(thresholds))
+	for key := range thresholds {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"intent-classifier/classifier"
+)
+
+func TestWriteCalibratedConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), classifier.ConfigFileName)
+
+	// A new file only holds the calibrated thresholds
+	if err := writeCalibratedConfig(path, classifier.Thresholds{Types: map[string]float32{"skill": 0.35}}); err != nil {
+		t.Fatalf("writeCalibratedConfig() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != "thresholds:\n    types:\n        skill: 0.35\n" {
+		t.Errorf("config = %q", got)
+	}
+
+	// An existing file keeps the settings that were not calibrated
+	existing := "thresholds:\n  types:\n    agent: 0.4\n    skill: 0.2\n  items:\n    deploy-agent: 0.6\n"
+	if err := os.WriteFile(path, []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+	calibrated := classifier.Thresholds{
+		Types: map[string]float32{"skill": 0.35},
+		Items: map[string]float32{"python-skill": 0.5},
+	}
+	if err := writeCalibratedConfig(path, calibrated); err != nil {
+		t.Fatalf("writeCalibratedConfig() error = %v", err)
+	}
+	config, err := classifier.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	got := config.Thresholds
+	if got.Types["skill"] != 0.35 || got.Types["agent"] != 0.4 || got.Items["deploy-agent"] != 0.6 || got.Items["python-skill"] != 0.5 {
+		t.Errorf("merged thresholds = %+v", got)
+	}
+
+	if err := os.WriteFile(path, []byte("thresholds:\n  typos: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeCalibratedConfig(path, calibrated); err == nil {
+		t.Error("expected an invalid config to be left alone with an error")
+	}
+}
+
+func TestWriteCalibrationReport(t *testing.T) {
+	candidates, err := classifier.ThresholdCandidates(0.05, 0.5, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	observations := []classifier.Observation{
+		{Item: "python-skill", Type: "skill", Similarity: 0.43, Threshold: 0.2, Positive: true},
+		{Item: "python-skill", Type: "skill", Similarity: 0.48, Threshold: 0.2, Positive: true},
+		{Item: "python-skill", Type: "skill", Similarity: 0.41, Threshold: 0.2},
+	}
+	cal := classifier.Calibrate(observations, candidates, 1, 3)
+	items := []classifier.Item{{Name: "python-skill", Type: "skill", Path: ".claude/skills/python.md"}}
+
+	var opts calibrateOptions
+	var buf bytes.Buffer
+	writeCalibrationReport(&buf, cal, suggestFrontmatter(cal, items), 3, opts)
+	out := buf.String()
+	for _, want := range []string{
+		"📊 Calibrated on 3 cases (3 labels), maximising F1",
+		"type skill (3 labels, 2 expected)",
+		"threshold  precision  recall     F1   tp   fp   fn",
+		"     0.05       0.67    1.00   0.80    2    1    0",
+		"→      0.43       1.00    1.00   1.00    2    0    0",
+		"--threshold 0.43",
+		"thresholds.types.skill: 0.43",
+		"--write-config",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report does not contain %q:\n%s", want, out)
+		}
+	}
+	// Rows between the 0.05 steps are left out, except the best
+	if strings.Contains(out, " 0.42 ") {
+		t.Errorf("report contains an off-step row:\n%s", out)
+	}
+}
+
+func TestSuggestFrontmatter(t *testing.T) {
+	current := float32(0.3)
+	cal := classifier.Calibration{Items: []classifier.Sweep{{Name: "python-skill", Best: classifier.SweepPoint{Threshold: 0.45}}}}
+	items := []classifier.Item{
+		{Name: "python-skill", Path: ".claude/skills/python.md", Metadata: classifier.Metadata{Threshold: &current}},
+		{Name: "fitness-skill", Path: ".claude/skills/fitness.md"},
+	}
+
+	got := suggestFrontmatter(cal, items)
+	if len(got) != 1 || got[0].Path != ".claude/skills/python.md" || got[0].Threshold != 0.45 || got[0].Current == nil || *got[0].Current != 0.3 {
+		t.Errorf("suggestFrontmatter() = %+v", got)
+	}
+}
@@ -0,0 +1,67 @@
+package classifier
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AtomicFile is written under a temporary name next to its target and only
+// replaces the target on Commit, so readers never see a partial file and a
+// killed writer leaves the target untouched
+type AtomicFile struct {
+	*os.File
+	path string
+}
+
+// isAtomicTemp reports whether name is the temporary name of a file that
+// CreateAtomic is still writing
+func isAtomicTemp(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".tmp")
+}
+
+// CreateAtomic starts writing the file at path
+func CreateAtomic(path string) (*AtomicFile, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &AtomicFile{File: file, path: path}, nil
+}
+
+// Commit flushes the data to disk and renames the file to its target
+func (f *AtomicFile) Commit() error {
+	err := f.Sync()
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Abort discards the file, leaving the target as it was
+func (f *AtomicFile) Abort() {
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// WriteFileAtomic replaces the file at path with data
+func WriteFileAtomic(path string, data []byte) error {
+	f, err := CreateAtomic(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Commit()
+}
@@ -0,0 +1,82 @@
+package classifier
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "entry.cache")
+
+	for _, content := range []string{"first", "second"} {
+		if err := WriteFileAtomic(path, []byte(content)); err != nil {
+			t.Fatalf("WriteFileAtomic() error = %v", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil || string(data) != content {
+			t.Errorf("file = %q (%v), expected %q", data, err, content)
+		}
+	}
+
+	// An aborted write leaves the previous content
+	f, err := CreateAtomic(path)
+	if err != nil {
+		t.Fatalf("CreateAtomic() error = %v", err)
+	}
+	f.WriteString("partial")
+	f.Abort()
+	if data, _ := os.ReadFile(path); string(data) != "second" {
+		t.Errorf("file = %q after abort, expected %q", data, "second")
+	}
+
+	names, _ := os.ReadDir(dir)
+	if len(names) != 1 {
+		t.Errorf("expected no temporary files to be left, got %v", names)
+	}
+
+	if err := WriteFileAtomic(filepath.Join(dir, "missing", "entry.cache"), nil); !os.IsNotExist(err) {
+		t.Errorf("expected a not-exist error for a missing directory, got %v", err)
+	}
+}
+
+func TestLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "model.lock")
+
+	lock, err := LockFile(path)
+	if err != nil {
+		t.Fatalf("LockFile() error = %v", err)
+	}
+
+	var mu sync.Mutex
+	var order []string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		second, err := LockFile(path)
+		if err != nil {
+			t.Errorf("LockFile() error = %v", err)
+			return
+		}
+		mu.Lock()
+		order = append(order, "second")
+		mu.Unlock()
+		second.Unlock()
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	order = append(order, "first")
+	mu.Unlock()
+	if err := lock.Unlock(); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	<-done
+
+	if len(order) != 2 || order[0] != "first" {
+		t.Errorf("expected the second holder to wait, got %v", order)
+	}
+}
@@ -0,0 +1,112 @@
+package classifier
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// HashContent returns SHA256 hash of content
+func HashContent(content string) string {
+	h := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(h[:])
+}
+
+// getCacheFile returns path to cache file for given hash in the directory
+// the section keeps for model
+func getCacheFile(hash, section string, model cacheModel) string {
+	return filepath.Join(model.dir(section), hash+".cache")
+}
+
+// embeddingMagic starts every embedding cache file
+const embeddingMagic = "ICEV"
+
+// embeddingHeaderSize is the magic, the dimension count and a CRC-32 of the values
+const embeddingHeaderSize = len(embeddingMagic) + 4 + 4
+
+// embeddingCacheKey returns the cache key of text embedded by the model with
+// the given fingerprint. Vectors of different models, preprocessing or
+// pooling never share a key.
+func embeddingCacheKey(fingerprint string, text string) string {
+	return HashContent(strings.Join([]string{fingerprint, "preprocess=" + PreprocessVersion, text}, "\x00"))
+}
+
+// loadCachedEmbedding loads the embedding stored under key. Files that are
+// corrupt, or whose dimension differs from dim (unless dim is 0), are
+// ignored so the embedding gets recomputed.
+func loadCachedEmbedding(model cacheModel, key string, dim int) ([]float32, bool) {
+	path := getCacheFile(key, CacheEmbeddings, model)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	embedding, ok := decodeEmbedding(data, dim)
+	if ok {
+		touchCacheFile(path)
+	}
+	return embedding, ok
+}
+
+// saveCachedEmbedding stores embedding under key
+func saveCachedEmbedding(model cacheModel, key string, embedding []float32) error {
+	return writeCacheFile(getCacheFile(key, CacheEmbeddings, model), model, encodeEmbedding(embedding))
+}
+
+// encodeEmbedding serializes embedding as a header followed by
+// little-endian float32 values
+func encodeEmbedding(embedding []float32) []byte {
+	values := make([]byte, len(embedding)*4)
+	for i, v := range embedding {
+		binary.LittleEndian.PutUint32(values[i*4:], math.Float32bits(v))
+	}
+
+	data := make([]byte, 0, embeddingHeaderSize+len(values))
+	data = append(data, embeddingMagic...)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(embedding)))
+	data = binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(values))
+	return append(data, values...)
+}
+
+// decodeEmbedding parses data written by encodeEmbedding, checking the
+// magic, the length, the checksum and, unless dim is 0, the dimension
+func decodeEmbedding(data []byte, dim int) ([]float32, bool) {
+	if len(data) < embeddingHeaderSize || string(data[:len(embeddingMagic)]) != embeddingMagic {
+		return nil, false
+	}
+	n := int(binary.LittleEndian.Uint32(data[len(embeddingMagic):]))
+	checksum := binary.LittleEndian.Uint32(data[len(embeddingMagic)+4:])
+	values := data[embeddingHeaderSize:]
+	if n == 0 || len(values) != n*4 || (dim > 0 && n != dim) || crc32.ChecksumIEEE(values) != checksum {
+		return nil, false
+	}
+
+	embedding := make([]float32, n)
+	for i := range embedding {
+		embedding[i] = math.Float32frombits(binary.LittleEndian.Uint32(values[i*4:]))
+	}
+	return embedding, true
+}
+
+// CacheDir returns a cross-platform cache directory
+func CacheDir() string {
+	if runtime.GOOS == "windows" {
+		localAppData := os.Getenv("LOCALAPPDATA")
+		if localAppData != "" {
+			return filepath.Join(localAppData, "intent-classifier")
+		}
+		return filepath.Join(os.Getenv("USERPROFILE"), "AppData", "Local", "intent-classifier")
+	}
+
+	// Unix-like systems (Linux, macOS, BSD)
+	if xdgCache := os.Getenv("XDG_CACHE_HOME"); xdgCache != "" {
+		return filepath.Join(xdgCache, "intent-classifier")
+	}
+
+	return filepath.Join(os.Getenv("HOME"), ".cache", "intent-classifier")
+}
@@ -0,0 +1,99 @@
+package classifier
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestDecodeEmbedding(t *testing.T) {
+	embedding := []float32{0.5, -0.25, 1}
+	valid := encodeEmbedding(embedding)
+
+	corrupt := append([]byte(nil), valid...)
+	corrupt[len(corrupt)-1] ^= 0xff
+
+	legacy := valid[embeddingHeaderSize:] // raw float32 values without a header
+
+	tests := []struct {
+		name  string
+		data  []byte
+		dim   int
+		valid bool
+	}{
+		{"valid", valid, 3, true},
+		{"any dimension", valid, 0, true},
+		{"other dimension", valid, 384, false},
+		{"corrupt value", corrupt, 3, false},
+		{"truncated", valid[:len(valid)-2], 3, false},
+		{"headerless", legacy, 3, false},
+		{"empty", nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, ok := decodeEmbedding(tt.data, tt.dim)
+			if ok != tt.valid {
+				t.Fatalf("decodeEmbedding() ok = %v, expected %v", ok, tt.valid)
+			}
+			if ok && (len(decoded) != 3 || decoded[1] != -0.25) {
+				t.Errorf("decodeEmbedding() = %v, expected %v", decoded, embedding)
+			}
+		})
+	}
+}
+
+func TestEmbeddingCacheKey(t *testing.T) {
+	if embeddingCacheKey("model-a", "text") == embeddingCacheKey("model-b", "text") {
+		t.Error("different models share a cache key")
+	}
+	if embeddingCacheKey("model-a", "text") != embeddingCacheKey("model-a", "text") {
+		t.Error("cache key is not stable")
+	}
+}
+
+func TestClassifyIgnoresForeignCacheEntries(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	req := Request{Prompt: "python", Threshold: 0.5}
+	items := fakeItems[:1]
+
+	first := newFakeEmbedder()
+	first.fingerprint = "model-a"
+	if _, err := New(first, nil).Classify(context.Background(), req, items); err != nil {
+		t.Fatalf("Classify() error = %v", err)
+	}
+
+	// Another model must not pick up the vectors of the first
+	other := newFakeEmbedder()
+	other.fingerprint = "model-b"
+	if _, err := New(other, nil).Classify(context.Background(), req, items); err != nil {
+		t.Fatalf("Classify() error = %v", err)
+	}
+	if len(other.calls) != 2 {
+		t.Errorf("expected the item to be embedded again for another model, got %v", other.calls)
+	}
+
+	// Neither must an entry of the wrong dimension, e.g. from an older build
+	wider := &fakeEmbedder{vocab: append(newFakeEmbedder().vocab, "flask"), fingerprint: "model-a"}
+	result, err := New(wider, nil).Classify(context.Background(), req, items)
+	if err != nil {
+		t.Fatalf("Classify() error = %v", err)
+	}
+	if len(wider.calls) != 2 || len(result.Matches) != 1 {
+		t.Errorf("expected the item to be embedded again, got calls %v and matches %+v", wider.calls, result.Matches)
+	}
+
+	// Corrupt entries are recomputed and rewritten
+	key := embeddingCacheKey("model-a", wider.calls[1][0])
+	model := New(wider, nil).cache
+	if err := os.WriteFile(getCacheFile(key, CacheEmbeddings, model), []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	again := &fakeEmbedder{vocab: wider.vocab, fingerprint: "model-a"}
+	if _, err := New(again, nil).Classify(context.Background(), req, items); err != nil {
+		t.Fatalf("Classify() error = %v", err)
+	}
+	if _, ok := loadCachedEmbedding(model, key, len(wider.vocab)); len(again.calls) != 2 || !ok {
+		t.Errorf("expected the corrupt entry to be recomputed, got calls %v", again.calls)
+	}
+}
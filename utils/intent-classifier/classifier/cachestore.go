@@ -0,0 +1,354 @@
+package classifier
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Cache sections under CacheDir
+const (
+	CacheEmbeddings = "embeddings" // item and prompt vectors, one directory per model
+	CacheLLM        = "llm"        // LLM responses, one directory per model
+	CacheModels     = "models"     // downloaded GGUF files, one directory per model type
+)
+
+// CacheSections lists the sections in the order they are reported
+var CacheSections = []string{CacheEmbeddings, CacheLLM, CacheModels}
+
+// LegacyCacheModel labels entries written before the cache was split by model
+const LegacyCacheModel = "(legacy)"
+
+// cacheLabelFile names the model whose entries a cache directory holds
+const cacheLabelFile = "model.txt"
+
+// ModelSumSuffix is appended to a downloaded model's path to name the file
+// recording its sha256. Like lock files, it is not a cache entry of its own
+// and goes with the model.
+const ModelSumSuffix = ".sha256"
+
+// DownloadPartSuffix names the file a download is written to until it
+// completes. Partial downloads are not cache entries either, so they are
+// neither listed nor removed while a download may still be writing them.
+const DownloadPartSuffix = ".part"
+
+// cacheWrites counts the cache entries written by this process
+var cacheWrites atomic.Int64
+
+// CacheWrites returns how many cache entries this process has written. A
+// caller can compare it before and after some work to tell whether the
+// cache grew.
+func CacheWrites() int64 {
+	return cacheWrites.Load()
+}
+
+// cacheModel identifies the model a cache entry belongs to
+type cacheModel struct {
+	id    string // stable key, e.g. the embedder's fingerprint
+	label string // shown by the cache commands
+}
+
+// embedderCacheModel returns the cache model of embedder. Embedders that
+// know their file name are labelled with it.
+func embedderCacheModel(embedder Embedder, fingerprint string) cacheModel {
+	model := cacheModel{id: fingerprint, label: fingerprint}
+	if fingerprint == "" {
+		model.label = "unknown model"
+	}
+	if named, ok := embedder.(interface{ File() string }); ok {
+		model.label = named.File() + " (" + model.label + ")"
+	}
+	return model
+}
+
+// dir returns the directory of section that holds the model's entries
+func (m cacheModel) dir(section string) string {
+	return filepath.Join(CacheDir(), section, HashContent(m.id)[:16])
+}
+
+// writeCacheFile atomically writes a cache entry of model, so concurrent
+// readers never see part of it. The directory is created and labelled on
+// first use, and again if the cache was cleared meanwhile.
+func writeCacheFile(path string, model cacheModel, data []byte) error {
+	err := WriteFileAtomic(path, data)
+	if errors.Is(err, fs.ErrNotExist) {
+		dir := filepath.Dir(path)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		if err := WriteFileAtomic(filepath.Join(dir, cacheLabelFile), []byte(model.label+"\n")); err != nil {
+			return err
+		}
+		err = WriteFileAtomic(path, data)
+	}
+	if err == nil {
+		cacheWrites.Add(1)
+	}
+	return err
+}
+
+// touchCacheFile marks a cache entry as used, for least recently used
+// eviction. Failures only make the entry look older.
+func touchCacheFile(path string) {
+	now := time.Now()
+	os.Chtimes(path, now, now)
+}
+
+// CacheEntry is one file in the cache
+type CacheEntry struct {
+	Section string    `json:"section"`
+	Model   string    `json:"model"` // label of the model the entry belongs to
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	Used    time.Time `json:"used"` // last written or read
+}
+
+// CacheGroup totals the entries of one model in one section
+type CacheGroup struct {
+	Section string    `json:"section"`
+	Model   string    `json:"model"`
+	Files   int       `json:"files"`
+	Size    int64     `json:"size"`
+	Used    time.Time `json:"used"` // most recent use of any entry
+}
+
+// PruneOptions selects the entries PruneCache removes. Zero values disable
+// a criterion.
+type PruneOptions struct {
+	Sections  []string      // sections to prune, all when empty
+	MaxSize   int64         // evict least recently used entries until the rest fit
+	OlderThan time.Duration // evict entries unused for longer than this
+	DryRun    bool          // report the entries without removing them
+}
+
+// validateSections checks that every section is one of CacheSections and
+// returns all of them when none are given
+func validateSections(sections []string) ([]string, error) {
+	if len(sections) == 0 {
+		return CacheSections, nil
+	}
+	for _, section := range sections {
+		known := false
+		for _, s := range CacheSections {
+			known = known || section == s
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown cache section %q: must be one of %s", section, strings.Join(CacheSections, ", "))
+		}
+	}
+	return sections, nil
+}
+
+// ScanCache returns the entries of the given sections, all of them when
+// none are given, least recently used first
+func ScanCache(sections ...string) ([]CacheEntry, error) {
+	sections, err := validateSections(sections)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []CacheEntry
+	for _, section := range sections {
+		found, err := scanSection(section)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, found...)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].Used.Equal(entries[j].Used) {
+			return entries[i].Used.Before(entries[j].Used)
+		}
+		return entries[i].Path < entries[j].Path
+	})
+	return entries, nil
+}
+
+// scanSection lists the files of one section. Files directly in the
+// section predate the per-model directories and are reported as legacy;
+// downloaded models are labelled "<type>/<file>".
+func scanSection(section string) ([]CacheEntry, error) {
+	root := filepath.Join(CacheDir(), section)
+	labels := make(map[string]string)
+
+	var entries []CacheEntry
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && p == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || !isCacheEntryName(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // removed while scanning
+		}
+
+		entry := CacheEntry{Section: section, Path: p, Size: info.Size(), Used: info.ModTime()}
+		dir := filepath.Dir(p)
+		switch {
+		case dir == root:
+			entry.Model = LegacyCacheModel
+		case section == CacheModels:
+			rel, _ := filepath.Rel(root, p)
+			entry.Model = filepath.ToSlash(rel)
+		default:
+			label, ok := labels[dir]
+			if !ok {
+				label = readCacheLabel(dir)
+				labels[dir] = label
+			}
+			entry.Model = label
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, err
+}
+
+// isCacheEntryName reports whether a file named name is a cache entry
+// rather than a label, lock, sum, partial download or atomic write in
+// progress
+func isCacheEntryName(name string) bool {
+	switch {
+	case name == cacheLabelFile, isAtomicTemp(name):
+		return false
+	case strings.HasSuffix(name, ".lock"), strings.HasSuffix(name, ModelSumSuffix), strings.HasSuffix(name, DownloadPartSuffix):
+		return false
+	}
+	return true
+}
+
+// readCacheLabel returns the model label of a cache directory, or its name
+// when the label is missing
+func readCacheLabel(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, cacheLabelFile))
+	if label := strings.TrimSpace(string(data)); err == nil && label != "" {
+		return label
+	}
+	return filepath.Base(dir)
+}
+
+// GroupCache totals entries by section and model. Groups follow the order
+// of CacheSections, largest first within a section.
+func GroupCache(entries []CacheEntry) []CacheGroup {
+	index := make(map[[2]string]int)
+	var groups []CacheGroup
+	for _, entry := range entries {
+		key := [2]string{entry.Section, entry.Model}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, CacheGroup{Section: entry.Section, Model: entry.Model})
+		}
+		groups[i].Files++
+		groups[i].Size += entry.Size
+		if entry.Used.After(groups[i].Used) {
+			groups[i].Used = entry.Used
+		}
+	}
+
+	order := make(map[string]int)
+	for i, section := range CacheSections {
+		order[section] = i
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Section != groups[j].Section {
+			return order[groups[i].Section] < order[groups[j].Section]
+		}
+		if groups[i].Size != groups[j].Size {
+			return groups[i].Size > groups[j].Size
+		}
+		return groups[i].Model < groups[j].Model
+	})
+	return groups
+}
+
+// selectEvictions returns the entries to remove from entries, which must be
+// least recently used first: those unused since before now-olderThan, then
+// more of the least recently used until the rest take at most maxSize bytes
+func selectEvictions(entries []CacheEntry, maxSize int64, olderThan time.Duration, now time.Time) []CacheEntry {
+	var total int64
+	for _, entry := range entries {
+		total += entry.Size
+	}
+
+	var evict []CacheEntry
+	for _, entry := range entries {
+		stale := olderThan > 0 && now.Sub(entry.Used) > olderThan
+		over := maxSize > 0 && total > maxSize
+		if !stale && !over {
+			continue
+		}
+		evict = append(evict, entry)
+		total -= entry.Size
+	}
+	return evict
+}
+
+// PruneCache removes the entries selected by opts and returns them. In a
+// dry run nothing is removed.
+func PruneCache(opts PruneOptions) ([]CacheEntry, error) {
+	entries, err := ScanCache(opts.Sections...)
+	if err != nil {
+		return nil, err
+	}
+	evict := selectEvictions(entries, opts.MaxSize, opts.OlderThan, time.Now())
+	if opts.DryRun {
+		return evict, nil
+	}
+	return evict, removeCacheEntries(evict)
+}
+
+// ClearCache removes every entry of the given sections, all of them when
+// none are given, and returns what was removed. In a dry run nothing is
+// removed.
+func ClearCache(dryRun bool, sections ...string) ([]CacheEntry, error) {
+	entries, err := ScanCache(sections...)
+	if err != nil || dryRun {
+		return entries, err
+	}
+	return entries, removeCacheEntries(entries)
+}
+
+// EnforceCacheLimit evicts the least recently used embeddings and LLM
+// responses until they take at most maxSize bytes. Downloaded models are
+// left alone: evicting the model in use would only download it again.
+func EnforceCacheLimit(maxSize int64) ([]CacheEntry, error) {
+	return PruneCache(PruneOptions{Sections: []string{CacheEmbeddings, CacheLLM}, MaxSize: maxSize})
+}
+
+// removeCacheEntries deletes entries, then the model directories left
+// holding nothing but their label
+func removeCacheEntries(entries []CacheEntry) error {
+	dirs := make(map[string]bool)
+	var errs []error
+	for _, entry := range entries {
+		if err := os.Remove(entry.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+			continue
+		}
+		if entry.Section == CacheModels {
+			os.Remove(entry.Path + ModelSumSuffix)
+		}
+		dirs[filepath.Dir(entry.Path)] = true
+	}
+
+	for dir := range dirs {
+		names, err := os.ReadDir(dir)
+		if err == nil && len(names) == 1 && names[0].Name() == cacheLabelFile {
+			os.RemoveAll(dir)
+		}
+	}
+	return errors.Join(errs...)
+}
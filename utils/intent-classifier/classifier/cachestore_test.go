@@ -0,0 +1,184 @@
+package classifier
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeCacheEntry writes a cache file of size bytes last used at used
+func writeCacheEntry(t *testing.T, path string, size int, used time.Time) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, used, used); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScanCache(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	embedder := newFakeEmbedder()
+	embedder.fingerprint = "model-a"
+	req := Request{Prompt: "python", Threshold: 0.5}
+	if _, err := New(embedder, nil).Classify(context.Background(), req, fakeItems[:1]); err != nil {
+		t.Fatalf("Classify() error = %v", err)
+	}
+
+	root := CacheDir()
+	old := time.Now().Add(-time.Hour)
+	writeCacheEntry(t, filepath.Join(root, CacheEmbeddings, "legacy.cache"), 10, old)
+	writeCacheEntry(t, filepath.Join(root, CacheModels, "embedding", "model.gguf"), 100, old)
+	// Downloads and writes in progress are not entries
+	writeCacheEntry(t, filepath.Join(root, CacheModels, "embedding", "next.gguf"+DownloadPartSuffix), 50, old)
+	writeCacheEntry(t, filepath.Join(root, CacheEmbeddings, ".legacy.cache.123.tmp"), 10, old)
+
+	entries, err := ScanCache()
+	if err != nil {
+		t.Fatalf("ScanCache() error = %v", err)
+	}
+	for i := 1; i < len(entries); i++ {
+		if entries[i].Used.Before(entries[i-1].Used) {
+			t.Errorf("expected least recently used first, got %+v", entries)
+		}
+	}
+
+	var got []string
+	for _, group := range GroupCache(entries) {
+		got = append(got, group.Section+": "+group.Model)
+	}
+	want := []string{
+		"embeddings: model-a",
+		"embeddings: " + LegacyCacheModel,
+		"models: embedding/model.gguf",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("groups = %q, expected %q", got, want)
+	}
+
+	if _, err := ScanCache("vectors"); err == nil {
+		t.Error("expected an error for an unknown section")
+	}
+}
+
+func TestSelectEvictions(t *testing.T) {
+	now := time.Now()
+	entries := []CacheEntry{
+		{Path: "a", Size: 10, Used: now.Add(-3 * time.Hour)},
+		{Path: "b", Size: 20, Used: now.Add(-2 * time.Hour)},
+		{Path: "c", Size: 30, Used: now.Add(-time.Hour)},
+	}
+
+	tests := []struct {
+		name      string
+		maxSize   int64
+		olderThan time.Duration
+		want      []string
+	}{
+		{name: "no limits", want: nil},
+		{name: "fits", maxSize: 60, want: nil},
+		{name: "least recently used first", maxSize: 50, want: []string{"a"}},
+		{name: "until it fits", maxSize: 45, want: []string{"a", "b"}},
+		{name: "older than", olderThan: 90 * time.Minute, want: []string{"a", "b"}},
+		{name: "both", maxSize: 55, olderThan: 150 * time.Minute, want: []string{"a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, entry := range selectEvictions(entries, tt.maxSize, tt.olderThan, now) {
+				got = append(got, entry.Path)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectEvictions() = %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPruneCache(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	root := CacheDir()
+	now := time.Now()
+	dir := filepath.Join(root, CacheLLM, "0123456789abcdef")
+	oldest := filepath.Join(dir, "old.cache")
+	newest := filepath.Join(dir, "new.cache")
+	model := filepath.Join(root, CacheModels, "llm", "model.gguf")
+	writeCacheEntry(t, oldest, 100, now.Add(-2*time.Hour))
+	writeCacheEntry(t, newest, 100, now)
+	writeCacheEntry(t, model, 1000, now.Add(-3*time.Hour))
+
+	// A dry run reports what would go without removing it
+	evicted, err := PruneCache(PruneOptions{Sections: []string{CacheLLM}, MaxSize: 150, DryRun: true})
+	if err != nil {
+		t.Fatalf("PruneCache() error = %v", err)
+	}
+	if len(evicted) != 1 || evicted[0].Path != oldest {
+		t.Errorf("expected %s to be selected, got %+v", oldest, evicted)
+	}
+	if _, err := os.Stat(oldest); err != nil {
+		t.Errorf("dry run removed %s", oldest)
+	}
+
+	// The limit only counts embeddings and LLM responses
+	if _, err := EnforceCacheLimit(150); err != nil {
+		t.Fatalf("EnforceCacheLimit() error = %v", err)
+	}
+	for path, kept := range map[string]bool{oldest: false, newest: true, model: true} {
+		if _, err := os.Stat(path); (err == nil) != kept {
+			t.Errorf("%s kept = %v, expected %v", path, err == nil, kept)
+		}
+	}
+
+	// Directories left with nothing but their label go too
+	if err := os.WriteFile(filepath.Join(dir, cacheLabelFile), []byte("model.gguf\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ClearCache(false, CacheLLM); err != nil {
+		t.Fatalf("ClearCache() error = %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed", dir)
+	}
+	if _, err := os.Stat(model); err != nil {
+		t.Errorf("clearing llm removed %s", model)
+	}
+}
+
+func TestWriteCacheFileAfterClear(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	model := cacheModel{id: "model", label: "model.gguf"}
+	key := embeddingCacheKey("model", "text")
+	if err := saveCachedEmbedding(model, key, []float32{1}); err != nil {
+		t.Fatalf("saveCachedEmbedding() error = %v", err)
+	}
+	if _, err := ClearCache(false); err != nil {
+		t.Fatalf("ClearCache() error = %v", err)
+	}
+
+	// A resident classifier keeps writing after the cache was cleared
+	before := CacheWrites()
+	if err := saveCachedEmbedding(model, key, []float32{1}); err != nil {
+		t.Fatalf("saveCachedEmbedding() error = %v", err)
+	}
+	if CacheWrites() != before+1 {
+		t.Errorf("expected the write to be counted")
+	}
+	entries, err := ScanCache(CacheEmbeddings)
+	if err != nil {
+		t.Fatalf("ScanCache() error = %v", err)
+	}
+	if len(entries) != 1 || entries[0].Model != "model.gguf" {
+		t.Errorf("expected one labelled entry, got %+v", entries)
+	}
+}
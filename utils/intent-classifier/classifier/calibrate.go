@@ -0,0 +1,228 @@
+package classifier
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Observation is the embedding score of one labelled item for one prompt
+type Observation struct {
+	Item       string
+	Type       string
+	Path       string
+	Similarity float32
+	Threshold  float32 // effective threshold of the item when it was scored
+	Blocked    bool    // suppressed by a not_for anchor or not scored: never matches
+	Positive   bool    // the item is in the case's expect list
+}
+
+// Observe pairs the labels of cases[i] with explanations[i], which must
+// cover every scored item (see Request.ExplainAll). Labelled items without
+// an explanation could not be scored and are observed as blocked.
+func Observe(cases []EvalCase, explanations [][]Explanation, items []Item) []Observation {
+	types := make(map[string]Item, len(items))
+	for _, item := range items {
+		types[item.Name] = item
+	}
+
+	var observations []Observation
+	for i, c := range cases {
+		explained := make(map[string]Explanation, len(explanations[i]))
+		for _, e := range explanations[i] {
+			explained[e.Name] = e
+		}
+		observe := func(name string, positive bool) {
+			o := Observation{Item: name, Type: types[name].Type, Path: types[name].Path, Positive: positive}
+			if e, ok := explained[name]; ok {
+				o.Similarity, o.Threshold, o.Blocked = e.Similarity, e.Threshold, e.Suppressed
+			} else {
+				o.Blocked = true
+			}
+			observations = append(observations, o)
+		}
+		for _, name := range c.Expect {
+			observe(name, true)
+		}
+		for _, name := range c.NotExpect {
+			observe(name, false)
+		}
+	}
+	return observations
+}
+
+// SweepPoint is how the observations fare at one threshold
+type SweepPoint struct {
+	Threshold      float32 `json:"threshold"`
+	TruePositives  int     `json:"true_positives"`
+	FalsePositives int     `json:"false_positives"`
+	FalseNegatives int     `json:"false_negatives"`
+	Precision      float64 `json:"precision"`
+	Recall         float64 `json:"recall"`
+	FBeta          float64 `json:"f_beta"`
+}
+
+// Sweep is a threshold sweep over a group of observations, such as those of
+// one item type
+type Sweep struct {
+	Name      string       `json:"name"`
+	Labels    int          `json:"labels"`
+	Positives int          `json:"positives"`
+	Points    []SweepPoint `json:"points"` // one per candidate threshold, ascending
+	Best      SweepPoint   `json:"best"`   // highest F-beta, the middle one of ties
+}
+
+// ThresholdCandidates returns the thresholds from..to (inclusive) in steps
+// of step, rounded to avoid accumulating float error
+func ThresholdCandidates(from, to, step float64) ([]float32, error) {
+	if step <= 0 || from > to {
+		return nil, fmt.Errorf("invalid threshold sweep %g..%g in steps of %g", from, to, step)
+	}
+	var candidates []float32
+	for i := 0; ; i++ {
+		threshold := math.Round((from+float64(i)*step)*1e4) / 1e4
+		if threshold > to+1e-9 {
+			return candidates, nil
+		}
+		candidates = append(candidates, float32(threshold))
+	}
+}
+
+// SweepThresholds evaluates every candidate threshold on observations and
+// picks the one maximising F-beta. beta > 1 favours recall, beta < 1
+// precision.
+func SweepThresholds(name string, observations []Observation, candidates []float32, beta float64) Sweep {
+	sweep := Sweep{Name: name, Labels: len(observations)}
+	for _, o := range observations {
+		if o.Positive {
+			sweep.Positives++
+		}
+	}
+
+	var best []int
+	for i, threshold := range candidates {
+		point := SweepAt(observations, threshold, beta)
+		sweep.Points = append(sweep.Points, point)
+		switch {
+		case len(best) == 0 || point.FBeta > sweep.Points[best[0]].FBeta:
+			best = []int{i}
+		case point.FBeta == sweep.Points[best[0]].FBeta:
+			best = append(best, i)
+		}
+	}
+	if len(best) > 0 {
+		sweep.Best = sweep.Points[best[len(best)/2]]
+	}
+	return sweep
+}
+
+// SweepAt evaluates observations at a single threshold
+func SweepAt(observations []Observation, threshold float32, beta float64) SweepPoint {
+	point := score(observations, func(Observation) float32 { return threshold }, beta)
+	point.Threshold = threshold
+	return point
+}
+
+// score evaluates observations, each against the threshold thresholdOf
+// returns for it
+func score(observations []Observation, thresholdOf func(Observation) float32, beta float64) SweepPoint {
+	var point SweepPoint
+	for _, o := range observations {
+		fires := !o.Blocked && o.Similarity >= thresholdOf(o)
+		switch {
+		case fires && o.Positive:
+			point.TruePositives++
+		case fires:
+			point.FalsePositives++
+		case o.Positive:
+			point.FalseNegatives++
+		}
+	}
+	point.Precision = ratio(point.TruePositives, point.TruePositives+point.FalsePositives)
+	point.Recall = ratio(point.TruePositives, point.TruePositives+point.FalseNegatives)
+
+	b2 := beta * beta
+	tp, fp, fn := float64(point.TruePositives), float64(point.FalsePositives), float64(point.FalseNegatives)
+	if denominator := (1+b2)*tp + b2*fn + fp; denominator > 0 {
+		point.FBeta = (1 + b2) * tp / denominator
+	}
+	return point
+}
+
+// Calibration holds the thresholds that maximise F-beta on a dataset
+type Calibration struct {
+	Beta       float64    `json:"beta"`
+	Default    Sweep      `json:"default"` // one threshold for every item, i.e. --threshold
+	Types      []Sweep    `json:"types"`   // per item type, types without positive labels are left out
+	Items      []Sweep    `json:"items"`   // items whose own threshold beats their type's
+	Thresholds Thresholds `json:"thresholds"`
+	Current    SweepPoint `json:"current"`    // at the thresholds the items were scored with; Threshold is unset
+	Calibrated SweepPoint `json:"calibrated"` // with the Thresholds applied; Threshold is unset
+}
+
+// Calibrate sweeps candidates over all observations, per item type and per
+// item. Only items with at least minLabels labels get their own threshold,
+// and only when it scores better on them than their type's threshold, so a
+// handful of labels does not overfit.
+func Calibrate(observations []Observation, candidates []float32, beta float64, minLabels int) Calibration {
+	cal := Calibration{
+		Beta:    beta,
+		Default: SweepThresholds("default", observations, candidates, beta),
+		Types:   []Sweep{},
+		Items:   []Sweep{},
+	}
+
+	byType := make(map[string][]Observation)
+	byItem := make(map[string][]Observation)
+	for _, o := range observations {
+		byType[o.Type] = append(byType[o.Type], o)
+		byItem[o.Item] = append(byItem[o.Item], o)
+	}
+
+	typeThreshold := func(itemType string) float32 {
+		if threshold, ok := cal.Thresholds.Types[itemType]; ok {
+			return threshold
+		}
+		return cal.Default.Best.Threshold
+	}
+	for _, itemType := range sortedKeys(byType) {
+		sweep := SweepThresholds(itemType, byType[itemType], candidates, beta)
+		if sweep.Positives == 0 || !isItemType(itemType) {
+			continue
+		}
+		cal.Types = append(cal.Types, sweep)
+		cal.Thresholds.Types = mergeThresholds(cal.Thresholds.Types, map[string]float32{itemType: sweep.Best.Threshold})
+	}
+	for _, name := range sortedKeys(byItem) {
+		itemObservations := byItem[name]
+		if len(itemObservations) < minLabels {
+			continue
+		}
+		sweep := SweepThresholds(name, itemObservations, candidates, beta)
+		inherited := SweepAt(itemObservations, typeThreshold(itemObservations[0].Type), beta)
+		if sweep.Positives == 0 || sweep.Best.FBeta <= inherited.FBeta {
+			continue
+		}
+		cal.Items = append(cal.Items, sweep)
+		cal.Thresholds.Items = mergeThresholds(cal.Thresholds.Items, map[string]float32{name: sweep.Best.Threshold})
+	}
+
+	cal.Current = score(observations, func(o Observation) float32 { return o.Threshold }, beta)
+	cal.Calibrated = score(observations, func(o Observation) float32 {
+		if threshold, ok := cal.Thresholds.Items[o.Item]; ok {
+			return threshold
+		}
+		return typeThreshold(o.Type)
+	}, beta)
+	return cal
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string][]Observation) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,165 @@
+package classifier
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestThresholdCandidates(t *testing.T) {
+	tests := []struct {
+		name           string
+		from, to, step float64
+		want           []float32
+		wantErr        bool
+	}{
+		{"inclusive", 0.1, 0.3, 0.1, []float32{0.1, 0.2, 0.3}, false},
+		{"no float drift", 0, 0.05, 0.01, []float32{0, 0.01, 0.02, 0.03, 0.04, 0.05}, false},
+		{"single", 0.5, 0.5, 0.1, []float32{0.5}, false},
+		{"zero step", 0, 1, 0, nil, true},
+		{"reversed", 0.6, 0.2, 0.1, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ThresholdCandidates(tt.from, tt.to, tt.step)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ThresholdCandidates() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ThresholdCandidates() = %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSweepThresholds(t *testing.T) {
+	observations := []Observation{
+		{Item: "a", Similarity: 0.6, Positive: true},
+		{Item: "a", Similarity: 0.45, Positive: true},
+		{Item: "a", Similarity: 0.3},
+		{Item: "a", Similarity: 0.9, Blocked: true},
+	}
+	candidates := []float32{0.2, 0.3, 0.4, 0.5, 0.6}
+
+	sweep := SweepThresholds("a", observations, candidates, 1)
+	if sweep.Labels != 4 || sweep.Positives != 2 || len(sweep.Points) != len(candidates) {
+		t.Fatalf("SweepThresholds() = %+v", sweep)
+	}
+	// 0.2 and 0.3 let the negative through, 0.5 and 0.6 miss a positive
+	if sweep.Best.Threshold != 0.4 || sweep.Best.FBeta != 1 {
+		t.Errorf("best = %+v, expected threshold 0.4 with F1 1", sweep.Best)
+	}
+	if p := sweep.Points[0]; p.TruePositives != 2 || p.FalsePositives != 1 || p.FalseNegatives != 0 {
+		t.Errorf("point at 0.2 = %+v, the blocked observation must never fire", p)
+	}
+
+	t.Run("beta favours recall", func(t *testing.T) {
+		observations := []Observation{
+			{Similarity: 0.6, Positive: true},
+			{Similarity: 0.3, Positive: true},
+			{Similarity: 0.4},
+			{Similarity: 0.5},
+		}
+		if got := SweepThresholds("x", observations, candidates, 0.5).Best.Threshold; got != 0.6 {
+			t.Errorf("F0.5 best threshold = %v, expected 0.6", got)
+		}
+		if got := SweepThresholds("x", observations, candidates, 2).Best.Threshold; got > 0.3 {
+			t.Errorf("F2 best threshold = %v, expected at most 0.3", got)
+		}
+	})
+
+	t.Run("ties pick the middle", func(t *testing.T) {
+		observations := []Observation{{Similarity: 0.7, Positive: true}, {Similarity: 0.1}}
+		if got := SweepThresholds("x", observations, candidates, 1).Best.Threshold; got != 0.4 {
+			t.Errorf("best threshold = %v, expected the middle of 0.2..0.6", got)
+		}
+	})
+}
+
+func TestSweepAtFBeta(t *testing.T) {
+	observations := []Observation{
+		{Similarity: 0.5, Positive: true},
+		{Similarity: 0.1, Positive: true},
+		{Similarity: 0.5},
+	}
+	// tp 1, fp 1, fn 1: F2 = 5/(5+4+1)
+	point := SweepAt(observations, 0.3, 2)
+	if math.Abs(point.FBeta-0.5) > 1e-9 || point.Precision != 0.5 || point.Recall != 0.5 {
+		t.Errorf("SweepAt() = %+v, expected precision, recall and F2 of 0.5", point)
+	}
+	if point := SweepAt(nil, 0.3, 1); point.FBeta != 0 {
+		t.Errorf("SweepAt(nil) = %+v, expected F1 0", point)
+	}
+}
+
+func TestObserve(t *testing.T) {
+	cases := []EvalCase{{Name: "tests", Expect: StringList{"testing-agent", "python-agent"}, NotExpect: StringList{"fitness-skill"}}}
+	explanations := [][]Explanation{{
+		{Name: "testing-agent", Similarity: 0.5, Threshold: 0.2},
+		{Name: "fitness-skill", Similarity: 0.4, Threshold: 0.3, Suppressed: true},
+	}}
+	items := []Item{
+		{Name: "testing-agent", Type: "agent"},
+		{Name: "python-agent", Type: "agent"},
+		{Name: "fitness-skill", Type: "skill", Path: "skills/fitness.md"},
+	}
+
+	got := Observe(cases, explanations, items)
+	want := []Observation{
+		{Item: "testing-agent", Type: "agent", Similarity: 0.5, Threshold: 0.2, Positive: true},
+		{Item: "python-agent", Type: "agent", Blocked: true, Positive: true},
+		{Item: "fitness-skill", Type: "skill", Path: "skills/fitness.md", Similarity: 0.4, Threshold: 0.3, Blocked: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Observe() = %+v, expected %+v", got, want)
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	var observations []Observation
+	add := func(item, itemType string, positive bool, similarities ...float32) {
+		for _, s := range similarities {
+			observations = append(observations, Observation{Item: item, Type: itemType, Similarity: s, Threshold: 0.2, Positive: positive})
+		}
+	}
+	// skills separate at 0.3, except fitness-skill whose scores run higher
+	add("python-skill", "skill", true, 0.4, 0.5)
+	add("python-skill", "skill", false, 0.2, 0.25)
+	add("fitness-skill", "skill", true, 0.7, 0.8)
+	add("fitness-skill", "skill", false, 0.5, 0.55)
+	// too few labels for an item threshold
+	add("deploy-agent", "agent", true, 0.6)
+	// no positives, so no type threshold
+	add("lint-command", "command", false, 0.1)
+
+	candidates, err := ThresholdCandidates(0.1, 0.9, 0.05)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cal := Calibrate(observations, candidates, 1, 3)
+
+	var types []string
+	for _, s := range cal.Types {
+		types = append(types, s.Name)
+	}
+	if got := strings.Join(types, ","); got != "agent,skill" {
+		t.Errorf("types = %s, expected agent,skill", got)
+	}
+	if len(cal.Items) != 1 || cal.Items[0].Name != "fitness-skill" {
+		t.Fatalf("items = %+v, expected only fitness-skill", cal.Items)
+	}
+	if threshold := cal.Thresholds.Items["fitness-skill"]; threshold <= 0.55 || threshold > 0.7 {
+		t.Errorf("fitness-skill threshold = %v, expected it to separate 0.55 from 0.7", threshold)
+	}
+	if _, ok := cal.Thresholds.Items["python-skill"]; ok {
+		t.Errorf("python-skill got its own threshold, but the type's already separates it: %+v", cal.Thresholds)
+	}
+	if cal.Calibrated.FBeta != 1 {
+		t.Errorf("calibrated = %+v, expected F1 1", cal.Calibrated)
+	}
+	if cal.Current.FBeta >= cal.Calibrated.FBeta {
+		t.Errorf("current F1 %.2f should be below calibrated %.2f", cal.Current.FBeta, cal.Calibrated.FBeta)
+	}
+}
@@ -0,0 +1,161 @@
+package classifier
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Chunk aggregates combine the similarities of an item's chunks into its score
+const (
+	AggregateMax      = "max"       // best chunk wins
+	AggregateMean     = "mean"      // average over all chunks
+	AggregateTopKMean = "topk-mean" // average over the best TopK chunks
+)
+
+const (
+	// DefaultChunkSize fits MiniLM's 256 token training length
+	DefaultChunkSize = 256
+
+	// DefaultChunkOverlap keeps sentences cut at a boundary in both chunks
+	DefaultChunkOverlap = 32
+
+	// DefaultChunkTopK is how many chunks AggregateTopKMean averages
+	DefaultChunkTopK = 3
+)
+
+// Tokenizer is implemented by embedders that can count tokens exactly.
+// Without it every word is counted as one token.
+type Tokenizer interface {
+	CountTokens(text string) (int, error)
+}
+
+// TokenLimiter is implemented by embedders that cut texts off after a
+// number of tokens, so explanations can flag truncated texts
+type TokenLimiter interface {
+	MaxTokens() int
+}
+
+// ChunkOptions control how long items are split before embedding
+type ChunkOptions struct {
+	Size      int    // tokens per chunk (0 = DefaultChunkSize)
+	Overlap   int    // tokens shared by consecutive chunks
+	Aggregate string // AggregateMax (default), AggregateMean or AggregateTopKMean
+	TopK      int    // chunks averaged by AggregateTopKMean (0 = DefaultChunkTopK)
+}
+
+// ValidateAggregate checks that aggregate is a supported chunk aggregate
+func ValidateAggregate(aggregate string) error {
+	switch aggregate {
+	case AggregateMax, AggregateMean, AggregateTopKMean:
+		return nil
+	}
+	return fmt.Errorf("invalid chunk aggregate %q: must be one of max, mean, topk-mean", aggregate)
+}
+
+// withDefaults fills unset options and checks the rest
+func (o ChunkOptions) withDefaults() (ChunkOptions, error) {
+	if o.Size == 0 {
+		o.Size = DefaultChunkSize
+	}
+	if o.Aggregate == "" {
+		o.Aggregate = AggregateMax
+	}
+	if o.TopK == 0 {
+		o.TopK = DefaultChunkTopK
+	}
+	if o.Size < 0 || o.Overlap < 0 || o.TopK < 0 {
+		return o, fmt.Errorf("chunk size, overlap and top-k must not be negative")
+	}
+	if o.Overlap >= o.Size {
+		return o, fmt.Errorf("chunk overlap (%d) must be smaller than chunk size (%d)", o.Overlap, o.Size)
+	}
+	return o, ValidateAggregate(o.Aggregate)
+}
+
+// chunkText splits preprocessed text into chunks of at most size tokens on
+// word boundaries, each starting overlap tokens before the previous one ended.
+// Text that fits is returned as a single chunk.
+func chunkText(text string, opts ChunkOptions, tokenizer Tokenizer) ([]string, error) {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return []string{text}, nil
+	}
+
+	// Preprocessed words are separated by single spaces, so per-word counts
+	// add up to the count of the whole text
+	counts := make([]int, len(words))
+	known := make(map[string]int)
+	for i, word := range words {
+		count, ok := known[word]
+		if !ok {
+			count = 1
+			if tokenizer != nil {
+				var err error
+				if count, err = tokenizer.CountTokens(" " + word); err != nil {
+					return nil, err
+				}
+			}
+			known[word] = count
+		}
+		counts[i] = count
+	}
+
+	var chunks []string
+	for start := 0; start < len(words); {
+		// Fill the chunk; an oversized word still gets a chunk of its own
+		end, tokens := start, 0
+		for end < len(words) && (end == start || tokens+counts[end] <= opts.Size) {
+			tokens += counts[end]
+			end++
+		}
+		chunks = append(chunks, strings.Join(words[start:end], " "))
+		if end == len(words) {
+			break
+		}
+
+		// Step back over the words that make up the overlap
+		next, overlap := end, 0
+		for next > start+1 && overlap+counts[next-1] <= opts.Overlap {
+			next--
+			overlap += counts[next]
+		}
+		start = next
+	}
+
+	return chunks, nil
+}
+
+// aggregateScores combines chunk similarities into one score and returns the
+// index of the best chunk
+func aggregateScores(scores []float32, opts ChunkOptions) (float32, int) {
+	best := 0
+	for i, score := range scores {
+		if score > scores[best] {
+			best = i
+		}
+	}
+
+	switch opts.Aggregate {
+	case AggregateMean:
+		return mean(scores), best
+	case AggregateTopKMean:
+		sorted := append([]float32(nil), scores...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] > sorted[j] })
+		if len(sorted) > opts.TopK {
+			sorted = sorted[:opts.TopK]
+		}
+		return mean(sorted), best
+	default:
+		return scores[best], best
+	}
+}
+
+// mean returns the average of values
+func mean(values []float32) float32 {
+	var sum float32
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float32(len(values))
+}
@@ -0,0 +1,168 @@
+package classifier
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeTokenizer counts one token per started group of three letters
+type fakeTokenizer struct{}
+
+func (fakeTokenizer) CountTokens(text string) (int, error) {
+	return (len(strings.TrimSpace(text)) + 2) / 3, nil
+}
+
+func TestChunkText(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		opts      ChunkOptions
+		tokenizer Tokenizer
+		expected  []string
+	}{
+		{
+			name:     "fits in one chunk",
+			text:     "alpha beta gamma",
+			opts:     ChunkOptions{Size: 5},
+			expected: []string{"alpha beta gamma"},
+		},
+		{
+			name:     "empty text",
+			text:     "",
+			opts:     ChunkOptions{Size: 5},
+			expected: []string{""},
+		},
+		{
+			name:     "words as tokens",
+			text:     "a1 a2 a3 a4 a5 a6 a7",
+			opts:     ChunkOptions{Size: 3},
+			expected: []string{"a1 a2 a3", "a4 a5 a6", "a7"},
+		},
+		{
+			name:     "overlap",
+			text:     "a1 a2 a3 a4 a5 a6 a7",
+			opts:     ChunkOptions{Size: 3, Overlap: 1},
+			expected: []string{"a1 a2 a3", "a3 a4 a5", "a5 a6 a7"},
+		},
+		{
+			name:      "token counts",
+			text:      "abcdef ab abcdefghi abc",
+			opts:      ChunkOptions{Size: 4},
+			tokenizer: fakeTokenizer{},
+			expected:  []string{"abcdef ab", "abcdefghi abc"},
+		},
+		{
+			name:      "oversized word gets its own chunk",
+			text:      "ab abcdefghijklmnop ab",
+			opts:      ChunkOptions{Size: 2},
+			tokenizer: fakeTokenizer{},
+			expected:  []string{"ab", "abcdefghijklmnop", "ab"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks, err := chunkText(tt.text, tt.opts, tt.tokenizer)
+			if err != nil {
+				t.Fatalf("chunkText() error = %v", err)
+			}
+			if !reflect.DeepEqual(chunks, tt.expected) {
+				t.Errorf("chunkText() = %q, expected %q", chunks, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAggregateScores(t *testing.T) {
+	scores := []float32{0.2, 0.8, 0.5, 0.1}
+
+	tests := []struct {
+		aggregate string
+		expected  float32
+	}{
+		{aggregate: AggregateMax, expected: 0.8},
+		{aggregate: AggregateMean, expected: 0.4},
+		{aggregate: AggregateTopKMean, expected: 0.5}, // (0.8 + 0.5 + 0.2) / 3
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.aggregate, func(t *testing.T) {
+			score, best := aggregateScores(scores, ChunkOptions{Aggregate: tt.aggregate, TopK: 3})
+			if diff := score - tt.expected; diff < -0.001 || diff > 0.001 {
+				t.Errorf("aggregateScores() = %v, expected %v", score, tt.expected)
+			}
+			if best != 1 {
+				t.Errorf("best chunk = %d, expected 1", best)
+			}
+		})
+	}
+}
+
+func TestChunkOptionsDefaults(t *testing.T) {
+	opts, err := ChunkOptions{}.withDefaults()
+	if err != nil {
+		t.Fatalf("withDefaults() error = %v", err)
+	}
+	if opts.Size != DefaultChunkSize || opts.Aggregate != AggregateMax || opts.TopK != DefaultChunkTopK {
+		t.Errorf("withDefaults() = %+v", opts)
+	}
+
+	for _, invalid := range []ChunkOptions{
+		{Size: 10, Overlap: 10},
+		{Size: -1},
+		{Aggregate: "median"},
+	} {
+		if _, err := invalid.withDefaults(); err == nil {
+			t.Errorf("withDefaults(%+v) expected error", invalid)
+		}
+	}
+}
+
+func TestClassifyLongItem(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	// The relevant words sit far beyond what a single chunk can hold
+	long := Item{
+		Name:    "long-skill",
+		Path:    "/skills/long.md",
+		Content: "---\nname: long-skill\n---\n" + strings.Repeat("filler ", 300) + "python django",
+		Type:    "skill",
+	}
+
+	c := New(newFakeEmbedder(), nil)
+	result, err := c.Classify(context.Background(), Request{
+		Prompt:    "python django",
+		Threshold: 0.5,
+		Chunking:  ChunkOptions{Size: 20, Overlap: 5},
+		Explain:   true,
+	}, []Item{long})
+	if err != nil {
+		t.Fatalf("Classify() error = %v", err)
+	}
+
+	if len(result.Matches) != 1 {
+		t.Fatalf("expected the long item to match, got %+v", result.Matches)
+	}
+	if len(result.Explanations) != 1 {
+		t.Fatalf("expected one explanation, got %+v", result.Explanations)
+	}
+	e := result.Explanations[0]
+	if e.Chunk != e.Chunks-1 || !strings.Contains(e.ChunkText, "python django") {
+		t.Errorf("expected the last chunk to win, got %+v", e)
+	}
+
+	// Mean over mostly irrelevant chunks stays below the threshold
+	result, err = c.Classify(context.Background(), Request{
+		Prompt:    "python django",
+		Threshold: 0.5,
+		Chunking:  ChunkOptions{Size: 20, Overlap: 5, Aggregate: AggregateMean},
+	}, []Item{long})
+	if err != nil {
+		t.Fatalf("Classify() error = %v", err)
+	}
+	if len(result.Matches) != 0 {
+		t.Errorf("expected no match with mean aggregate, got %+v", result.Matches)
+	}
+}
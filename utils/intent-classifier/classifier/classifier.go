@@ -0,0 +1,340 @@
+// Package classifier matches user prompts against Claude Code skills, agents
+// and commands. Items are compared with a prompt by embedding similarity,
+// optionally refined by an LLM that rates each candidate.
+//
+// The models are pluggable: an Embedder turns text into vectors and a Scorer
+// rates a single item. LlamaEmbedder and LlamaScorer run GGUF models through
+// llama.cpp; tests and other tools can supply their own implementations.
+package classifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Item represents a file with its content for matching
+type Item struct {
+	Name     string
+	Path     string
+	Content  string
+	Priority string
+	Type     string // "skill", "agent" or "command"
+	Metadata Metadata
+}
+
+// Match represents a matched item with its similarity score
+type Match struct {
+	Name       string  `json:"name"`
+	Path       string  `json:"path"`
+	Similarity float32 `json:"similarity"`
+	Priority   string  `json:"priority"`
+	Type       string  `json:"type"`      // "skill", "agent" or "command"
+	Threshold  float32 `json:"threshold"` // the threshold the item had to reach
+}
+
+// Embedder turns texts into embeddings
+type Embedder interface {
+	// Embed returns one L2-normalized embedding per text, in order
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// Fingerprinter is implemented by embedders that can identify their model.
+// Cached embeddings are keyed by the fingerprint, so vectors of different
+// models are never mixed.
+type Fingerprinter interface {
+	Fingerprint() string
+}
+
+// Scorer rates how relevant an item is to a prompt
+type Scorer interface {
+	// Score returns a confidence between 0.0 and 1.0
+	Score(ctx context.Context, prompt string, item Item) (float32, error)
+}
+
+// Matching modes
+const (
+	ModeEmbedding = "embedding" // cosine similarity against item embeddings
+	ModeLLM       = "llm"       // LLM confidence for every item
+	ModeHybrid    = "hybrid"    // LLM confidence for the embedding shortlist only
+)
+
+// ValidateMode checks that mode is a supported matching mode
+func ValidateMode(mode string) error {
+	switch mode {
+	case ModeEmbedding, ModeLLM, ModeHybrid:
+		return nil
+	}
+	return fmt.Errorf("invalid mode %q: must be one of embedding, llm, hybrid", mode)
+}
+
+// Request describes one classification
+type Request struct {
+	Prompt       string
+	Mode         string     // defaults to ModeEmbedding
+	Threshold    float32    // minimum embedding similarity
+	Thresholds   Thresholds // per-item, per-priority and per-type overrides of Threshold
+	LLMThreshold float32    // minimum LLM confidence in llm and hybrid modes
+	Shortlist    int        // hybrid mode: max embedding matches sent to the LLM (0 = all)
+	Chunking     ChunkOptions
+	Selection    Selection // limits on the number of matches kept
+	Explain      bool      // record how each embedding match was scored
+	ExplainAll   bool      // also record items below their threshold; implies Explain
+}
+
+// Result is the outcome of one classification
+type Result struct {
+	Matches      []Match       // most similar first
+	Explanations []Explanation // embedding matches and suppressed items, when requested; every scored item with ExplainAll
+	Prompt       string        // the preprocessed prompt that was embedded, when explaining
+	Diagnostics  []Diagnostic  // items that could not be scored and cache entries that could not be written
+	EmbedPrompt  time.Duration // embedding the prompt
+	Match        time.Duration // scoring items (embeddings and/or LLM)
+}
+
+// Explanation records how an item's embedding score was reached
+type Explanation struct {
+	Name         string  `json:"name"`
+	Path         string  `json:"path"`
+	Similarity   float32 `json:"similarity"` // max of body and example score
+	BodyScore    float32 `json:"body_score"` // chunk similarities aggregated
+	Aggregate    string  `json:"aggregate"`
+	Chunk        int     `json:"chunk"`                   // index of the most similar chunk
+	Chunks       int     `json:"chunks"`                  // number of chunks the item was split into
+	ChunkScore   float32 `json:"chunk_score"`             // similarity of the most similar chunk
+	ChunkText    string  `json:"chunk_text"`              // preprocessed text of the most similar chunk
+	Example      string  `json:"example,omitempty"`       // most similar example prompt
+	ExampleScore float32 `json:"example_score,omitempty"` // similarity of that example
+
+	Threshold       float32 `json:"threshold"`        // effective threshold of the item
+	ThresholdSource string  `json:"threshold_source"` // setting it came from, e.g. "type"
+
+	NegativeExample string  `json:"negative_example,omitempty"` // most similar not_for prompt
+	NegativeScore   float32 `json:"negative_score,omitempty"`   // similarity of that prompt
+	Suppressed      bool    `json:"suppressed,omitempty"`       // negative score reached the positive one
+	Dropped         string  `json:"dropped,omitempty"`          // selection limit that left the match out, e.g. "top-k"
+
+	Winner     string `json:"winner"`              // what decided Similarity: WinnerBody or WinnerExample
+	TextLength int    `json:"text_length"`         // characters of the preprocessed item text, before chunking
+	Truncated  bool   `json:"truncated,omitempty"` // a chunk or anchor was longer than the embedder keeps
+	Cached     bool   `json:"cached"`              // every vector of the item came from memory, an index or the disk cache
+}
+
+// What decided an explained similarity
+const (
+	WinnerBody    = "body"    // the aggregated chunk scores
+	WinnerExample = "example" // an example anchor beat the body
+)
+
+// Classifier matches prompts against items. Item embeddings are kept in
+// memory and on disk, so repeated classifications only embed the prompt.
+// A Classifier is safe for concurrent use if its Embedder and Scorer are.
+type Classifier struct {
+	embedder    Embedder
+	fingerprint string     // of the embedder's model, "" when unknown
+	cache       cacheModel // where the model's embeddings are cached
+	scorer      Scorer
+	memo        *embeddingMemo
+	texts       *textsMemo
+}
+
+// New creates a Classifier. scorer may be nil when only the embedding mode
+// is used.
+func New(embedder Embedder, scorer Scorer) *Classifier {
+	c := &Classifier{
+		embedder: embedder,
+		scorer:   scorer,
+		memo:     newEmbeddingMemo(),
+		texts:    newTextsMemo(),
+	}
+	if f, ok := embedder.(Fingerprinter); ok {
+		c.fingerprint = f.Fingerprint()
+	}
+	c.cache = embedderCacheModel(embedder, c.fingerprint)
+	return c
+}
+
+// Classify returns the items relevant to the request's prompt
+func (c *Classifier) Classify(ctx context.Context, req Request, items []Item) (Result, error) {
+	var result Result
+
+	mode := req.Mode
+	if mode == "" {
+		mode = ModeEmbedding
+	}
+	if err := ValidateMode(mode); err != nil {
+		return result, err
+	}
+	if mode != ModeEmbedding && c.scorer == nil {
+		return result, fmt.Errorf("%s mode requires a scorer", mode)
+	}
+	chunking, err := req.Chunking.withDefaults()
+	if err != nil {
+		return result, err
+	}
+	if err := req.Selection.Validate(); err != nil {
+		return result, err
+	}
+
+	// LLM mode skips embeddings entirely
+	if mode == ModeLLM {
+		start := time.Now()
+		result.Matches, result.Diagnostics, err = c.matchWithScorer(ctx, req.Prompt, items, req.LLMThreshold)
+		result.Matches, _ = selectMatches(result.Matches, req.Selection)
+		result.Match = time.Since(start)
+		return result, err
+	}
+
+	// Compute prompt embedding (preprocess first)
+	start := time.Now()
+	prompt := preprocessText(strings.ToLower(req.Prompt))
+	if req.Explain || req.ExplainAll {
+		result.Prompt = prompt
+	}
+	embeddings, err := c.embedder.Embed(ctx, []string{prompt})
+	if err == nil && len(embeddings) != 1 {
+		err = fmt.Errorf("embedder returned %d embeddings for 1 text", len(embeddings))
+	}
+	if err != nil {
+		return result, fmt.Errorf("failed to embed prompt: %w", err)
+	}
+	result.EmbedPrompt = time.Since(start)
+
+	// Embedding similarity mode - match items
+	start = time.Now()
+	result.Matches, result.Explanations, result.Diagnostics, err = c.matchItems(ctx, embeddings[0], items, req.Threshold, req.Thresholds, chunking, req.Explain || req.ExplainAll, req.ExplainAll)
+	if err != nil {
+		return result, err
+	}
+
+	// Hybrid mode - only the best embedding matches are worth an LLM call
+	if mode == ModeHybrid {
+		var diagnostics []Diagnostic
+		result.Matches, diagnostics, err = c.matchWithScorer(ctx, req.Prompt, shortlistItems(items, result.Matches, req.Shortlist), req.LLMThreshold)
+		result.Diagnostics = append(result.Diagnostics, diagnostics...)
+	}
+
+	var dropped map[string]string
+	result.Matches, dropped = selectMatches(result.Matches, req.Selection)
+	sort.SliceStable(result.Explanations, func(i, j int) bool {
+		return result.Explanations[i].Similarity > result.Explanations[j].Similarity
+	})
+	if mode == ModeEmbedding {
+		for i := range result.Explanations {
+			result.Explanations[i].Dropped = dropped[result.Explanations[i].Path]
+		}
+	}
+	result.Match = time.Since(start)
+
+	return result, err
+}
+
+// matchWithScorer asks the scorer for a confidence per item and keeps the
+// items reaching threshold. The confidence is reported as the match
+// similarity. Items the scorer fails on are reported as diagnostics.
+func (c *Classifier) matchWithScorer(ctx context.Context, prompt string, items []Item, threshold float32) ([]Match, []Diagnostic, error) {
+	var matches []Match
+	var diagnostics []Diagnostic
+	for _, item := range items {
+		if err := ctx.Err(); err != nil {
+			return nil, diagnostics, err
+		}
+
+		confidence, err := c.scorer.Score(ctx, prompt, item)
+		var uncached *uncachedError
+		if errors.As(err, &uncached) {
+			// Scored, but the response will be asked for again next time
+			diagnostics = append(diagnostics, Diagnostic{Message: uncached.Error()})
+			err = nil
+		}
+		if err != nil {
+			diagnostics = append(diagnostics, Diagnostic{Path: item.Path, Message: fmt.Sprintf("failed to score with LLM: %v", err)})
+			continue
+		}
+
+		if confidence >= threshold {
+			matches = append(matches, Match{
+				Name:       item.Name,
+				Path:       item.Path,
+				Similarity: confidence,
+				Priority:   item.Priority,
+				Type:       item.Type,
+				Threshold:  threshold,
+			})
+		}
+	}
+
+	return matches, diagnostics, nil
+}
+
+// shortlistItems returns the items behind the n most similar matches
+func shortlistItems(items []Item, matches []Match, n int) []Item {
+	ranked := make([]Match, len(matches))
+	copy(ranked, matches)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Similarity > ranked[j].Similarity
+	})
+	if n > 0 && len(ranked) > n {
+		ranked = ranked[:n]
+	}
+
+	byPath := make(map[string]Item, len(items))
+	for _, item := range items {
+		byPath[item.Path] = item
+	}
+
+	shortlist := make([]Item, 0, len(ranked))
+	for _, match := range ranked {
+		shortlist = append(shortlist, byPath[match.Path])
+	}
+	return shortlist
+}
+
+// cosineSimilarity computes cosine similarity between two vectors
+func cosineSimilarity(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+
+	var dotProduct float32
+	for i := range a {
+		dotProduct += a[i] * b[i]
+	}
+
+	// Vectors are already normalized, so dot product = cosine similarity
+	return dotProduct
+}
+
+// memoMaxEmbeddings bounds the embeddings kept in memory, so a long-lived
+// daemon does not grow without limit; about 30MB at 384 dimensions.
+// Evicted embeddings are read back from the disk cache.
+const memoMaxEmbeddings = 20000
+
+// embeddingMemo holds item embeddings in memory, keyed by preprocessed text
+type embeddingMemo struct {
+	embeddings *lru[[]float32]
+}
+
+// newEmbeddingMemo creates an empty in-memory embedding store
+func newEmbeddingMemo() *embeddingMemo {
+	return &embeddingMemo{embeddings: newLRU[[]float32](memoMaxEmbeddings)}
+}
+
+// get returns the resident embedding for text; a nil memo never hits
+func (m *embeddingMemo) get(text string) ([]float32, bool) {
+	if m == nil {
+		return nil, false
+	}
+	return m.embeddings.get(HashContent(text))
+}
+
+// put stores an embedding for text; a nil memo discards it
+func (m *embeddingMemo) put(text string, embedding []float32) {
+	if m == nil {
+		return
+	}
+	m.embeddings.put(HashContent(text), embedding)
+}
@@ -0,0 +1,259 @@
+package classifier
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Dataset is a set of labelled prompts read from a YAML file:
+//
+//	gates:
+//	  micro_f1: 0.8
+//	cases:
+//	  - prompt: "why does pytest not find my fixtures"
+//	    expect: [python-agent, testing-agent]
+//	    not_expect: fitness-skill
+//
+// Only the items a case names are judged; matches of other items neither
+// help nor hurt.
+type Dataset struct {
+	Gates Gates      `yaml:"gates"`
+	Cases []EvalCase `yaml:"cases"`
+}
+
+// EvalCase is one labelled prompt
+type EvalCase struct {
+	Name      string     `yaml:"name" json:"name"` // defaults to the prompt
+	Prompt    string     `yaml:"prompt" json:"prompt"`
+	Expect    StringList `yaml:"expect" json:"expect,omitempty"`         // items that should match
+	NotExpect StringList `yaml:"not_expect" json:"not_expect,omitempty"` // items that should not match
+}
+
+// Gates are the minimum scores an evaluation must reach. Zero values
+// disable a gate.
+type Gates struct {
+	Precision float64 `yaml:"precision" json:"precision,omitempty"` // micro-averaged
+	Recall    float64 `yaml:"recall" json:"recall,omitempty"`       // micro-averaged
+	MicroF1   float64 `yaml:"micro_f1" json:"micro_f1,omitempty"`
+	MacroF1   float64 `yaml:"macro_f1" json:"macro_f1,omitempty"`
+	MRR       float64 `yaml:"mrr" json:"mrr,omitempty"`
+}
+
+// LoadDataset reads a dataset file. Unknown keys are rejected so that typos
+// do not silently drop labels.
+func LoadDataset(path string) (Dataset, error) {
+	var dataset Dataset
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return dataset, err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&dataset); err != nil && !errors.Is(err, io.EOF) {
+		return dataset, fmt.Errorf("invalid dataset %s: %w", path, err)
+	}
+	if err := dataset.validate(); err != nil {
+		return dataset, fmt.Errorf("invalid dataset %s: %w", path, err)
+	}
+	return dataset, nil
+}
+
+// validate checks that every case has a prompt and labels, and defaults
+// case names to their prompt
+func (d *Dataset) validate() error {
+	if len(d.Cases) == 0 {
+		return errors.New("no cases")
+	}
+	for i := range d.Cases {
+		c := &d.Cases[i]
+		if strings.TrimSpace(c.Prompt) == "" {
+			return fmt.Errorf("case %d has no prompt", i+1)
+		}
+		if c.Name == "" {
+			c.Name = c.Prompt
+		}
+		if len(c.Expect) == 0 && len(c.NotExpect) == 0 {
+			return fmt.Errorf("case %q lists no expect or not_expect items", c.Name)
+		}
+		for _, name := range c.Expect {
+			for _, other := range c.NotExpect {
+				if name == other {
+					return fmt.Errorf("case %q both expects and rejects %s", c.Name, name)
+				}
+			}
+		}
+	}
+	for _, gate := range []float64{d.Gates.Precision, d.Gates.Recall, d.Gates.MicroF1, d.Gates.MacroF1, d.Gates.MRR} {
+		if gate < 0 || gate > 1 {
+			return fmt.Errorf("gates must be between 0 and 1, got %g", gate)
+		}
+	}
+	return nil
+}
+
+// CheckItems fails when a case names an item that is not among items, so a
+// typo in the dataset is not mistaken for a missed match
+func (d Dataset) CheckItems(items []Item) error {
+	known := make(map[string]bool, len(items))
+	for _, item := range items {
+		known[item.Name] = true
+	}
+	for _, c := range d.Cases {
+		for _, name := range append(append([]string{}, c.Expect...), c.NotExpect...) {
+			if !known[name] {
+				return fmt.Errorf("case %q names unknown item %q", c.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+// ItemScore holds the counts and scores of one labelled item. Precision is
+// 0 when the item never matched where it was labelled.
+type ItemScore struct {
+	Name           string  `json:"name"`
+	TruePositives  int     `json:"true_positives"`
+	FalsePositives int     `json:"false_positives"`
+	FalseNegatives int     `json:"false_negatives"`
+	Precision      float64 `json:"precision"`
+	Recall         float64 `json:"recall"`
+	F1             float64 `json:"f1"`
+}
+
+// Confusion is a match that should not have happened, or one that did not
+type Confusion struct {
+	Case       string  `json:"case"`
+	Item       string  `json:"item"`
+	Rank       int     `json:"rank,omitempty"`       // position among the case's matches, false positives only
+	Similarity float32 `json:"similarity,omitempty"` // false positives only
+	Threshold  float32 `json:"threshold,omitempty"`  // false positives only
+}
+
+// EvalReport summarizes how well matches agree with a dataset's labels
+type EvalReport struct {
+	Cases          int         `json:"cases"`
+	Items          []ItemScore `json:"items"` // labelled items, by name
+	Precision      float64     `json:"precision"`
+	Recall         float64     `json:"recall"`
+	MicroF1        float64     `json:"micro_f1"`
+	MacroF1        float64     `json:"macro_f1"` // mean F1 of the items that were expected or matched wrongly
+	MRR            float64     `json:"mrr"`      // mean reciprocal rank of the first expected match, over cases expecting one
+	FalsePositives []Confusion `json:"false_positives"`
+	FalseNegatives []Confusion `json:"false_negatives"`
+}
+
+// Evaluate scores matches[i], ranked best first, against cases[i]
+func Evaluate(cases []EvalCase, matches [][]Match) EvalReport {
+	report := EvalReport{Cases: len(cases), FalsePositives: []Confusion{}, FalseNegatives: []Confusion{}}
+	scores := make(map[string]*ItemScore)
+	score := func(name string) *ItemScore {
+		if scores[name] == nil {
+			scores[name] = &ItemScore{Name: name}
+		}
+		return scores[name]
+	}
+
+	var reciprocalRanks float64
+	ranked := 0
+	for i, c := range cases {
+		rank := make(map[string]int)
+		for j, m := range matches[i] {
+			if _, ok := rank[m.Name]; !ok {
+				rank[m.Name] = j + 1
+			}
+		}
+
+		first := 0
+		for _, name := range c.Expect {
+			if r, ok := rank[name]; ok {
+				score(name).TruePositives++
+				if first == 0 || r < first {
+					first = r
+				}
+			} else {
+				score(name).FalseNegatives++
+				report.FalseNegatives = append(report.FalseNegatives, Confusion{Case: c.Name, Item: name})
+			}
+		}
+		for _, name := range c.NotExpect {
+			s := score(name)
+			r, ok := rank[name]
+			if !ok {
+				continue
+			}
+			s.FalsePositives++
+			m := matches[i][r-1]
+			report.FalsePositives = append(report.FalsePositives, Confusion{Case: c.Name, Item: name, Rank: r, Similarity: m.Similarity, Threshold: m.Threshold})
+		}
+
+		if len(c.Expect) > 0 {
+			ranked++
+			if first > 0 {
+				reciprocalRanks += 1 / float64(first)
+			}
+		}
+	}
+
+	var tp, fp, fn int
+	var f1Sum float64
+	f1Items := 0
+	for _, s := range scores {
+		s.Precision = ratio(s.TruePositives, s.TruePositives+s.FalsePositives)
+		s.Recall = ratio(s.TruePositives, s.TruePositives+s.FalseNegatives)
+		s.F1 = ratio(2*s.TruePositives, 2*s.TruePositives+s.FalsePositives+s.FalseNegatives)
+		if s.TruePositives+s.FalsePositives+s.FalseNegatives > 0 {
+			f1Sum += s.F1
+			f1Items++
+		}
+		tp, fp, fn = tp+s.TruePositives, fp+s.FalsePositives, fn+s.FalseNegatives
+		report.Items = append(report.Items, *s)
+	}
+	sort.Slice(report.Items, func(i, j int) bool {
+		return report.Items[i].Name < report.Items[j].Name
+	})
+
+	report.Precision = ratio(tp, tp+fp)
+	report.Recall = ratio(tp, tp+fn)
+	report.MicroF1 = ratio(2*tp, 2*tp+fp+fn)
+	if f1Items > 0 {
+		report.MacroF1 = f1Sum / float64(f1Items)
+	}
+	if ranked > 0 {
+		report.MRR = reciprocalRanks / float64(ranked)
+	}
+	return report
+}
+
+// ratio returns n/d, or 0 when d is 0
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
+
+// CheckGates returns a description of every gate the report falls below,
+// e.g. "micro F1 0.72 < 0.80"
+func (r EvalReport) CheckGates(gates Gates) []string {
+	var failed []string
+	check := func(name string, got, min float64) {
+		if min > 0 && got < min {
+			failed = append(failed, fmt.Sprintf("%s %.2f < %.2f", name, got, min))
+		}
+	}
+	check("precision", r.Precision, gates.Precision)
+	check("recall", r.Recall, gates.Recall)
+	check("micro F1", r.MicroF1, gates.MicroF1)
+	check("macro F1", r.MacroF1, gates.MacroF1)
+	check("MRR", r.MRR, gates.MRR)
+	return failed
+}
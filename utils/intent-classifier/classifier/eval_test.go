@@ -0,0 +1,132 @@
+package classifier
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadDataset(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{"valid", "gates:\n  micro_f1: 0.8\ncases:\n  - prompt: run my tests\n    expect: testing-agent\n    not_expect: [fitness-skill]\n", ""},
+		{"unknown key", "cases:\n  - prompt: run my tests\n    expects: testing-agent\n", "expects"},
+		{"no cases", "gates:\n  mrr: 0.5\n", "no cases"},
+		{"no prompt", "cases:\n  - expect: testing-agent\n", "no prompt"},
+		{"no labels", "cases:\n  - prompt: run my tests\n", "lists no expect"},
+		{"contradiction", "cases:\n  - prompt: run my tests\n    expect: a\n    not_expect: a\n", "both expects and rejects"},
+		{"gate out of range", "gates:\n  mrr: 2\ncases:\n  - prompt: x\n    expect: a\n", "between 0 and 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cases.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0644); err != nil {
+				t.Fatal(err)
+			}
+			dataset, err := LoadDataset(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("LoadDataset() error = %v, expected it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadDataset() error = %v", err)
+			}
+			c := dataset.Cases[0]
+			if c.Name != "run my tests" || !reflect.DeepEqual([]string(c.Expect), []string{"testing-agent"}) || dataset.Gates.MicroF1 != 0.8 {
+				t.Errorf("LoadDataset() = %+v", dataset)
+			}
+		})
+	}
+}
+
+func TestDatasetCheckItems(t *testing.T) {
+	dataset := Dataset{Cases: []EvalCase{{Name: "tests", Expect: StringList{"testing-agent"}, NotExpect: StringList{"fitnes-skill"}}}}
+	items := []Item{{Name: "testing-agent"}, {Name: "fitness-skill"}}
+	if err := dataset.CheckItems(items); err == nil || !strings.Contains(err.Error(), `"fitnes-skill"`) {
+		t.Errorf("CheckItems() error = %v, expected the unknown item", err)
+	}
+	dataset.Cases[0].NotExpect = StringList{"fitness-skill"}
+	if err := dataset.CheckItems(items); err != nil {
+		t.Errorf("CheckItems() error = %v", err)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	cases := []EvalCase{
+		{Name: "python", Expect: StringList{"python", "testing"}, NotExpect: StringList{"fitness"}},
+		{Name: "gym", Expect: StringList{"fitness"}, NotExpect: StringList{"python"}},
+		{Name: "nothing", NotExpect: StringList{"testing"}},
+	}
+	matches := [][]Match{
+		{{Name: "other"}, {Name: "python"}, {Name: "fitness", Similarity: 0.3, Threshold: 0.2}},
+		{{Name: "python", Similarity: 0.25, Threshold: 0.2}},
+		{},
+	}
+
+	report := Evaluate(cases, matches)
+
+	// python: 1 TP, 1 FP; testing: 1 FN, labelled negative once; fitness: 1 FP, 1 FN
+	want := []ItemScore{
+		{Name: "fitness", FalsePositives: 1, FalseNegatives: 1},
+		{Name: "python", TruePositives: 1, FalsePositives: 1, Precision: 0.5, Recall: 1, F1: 2.0 / 3},
+		{Name: "testing", FalseNegatives: 1},
+	}
+	if !reflect.DeepEqual(report.Items, want) {
+		t.Errorf("Items = %+v\nexpected %+v", report.Items, want)
+	}
+
+	near := func(got, want float64) bool { return math.Abs(got-want) < 1e-9 }
+	if !near(report.Precision, 1.0/3) || !near(report.Recall, 1.0/3) || !near(report.MicroF1, 1.0/3) {
+		t.Errorf("micro = %v/%v/%v, expected 1/3 each", report.Precision, report.Recall, report.MicroF1)
+	}
+	if !near(report.MacroF1, 2.0/9) {
+		t.Errorf("MacroF1 = %v, expected 2/9", report.MacroF1)
+	}
+	// python ranks 2nd in the first case, nothing expected matches in the second
+	if !near(report.MRR, 0.25) {
+		t.Errorf("MRR = %v, expected 0.25", report.MRR)
+	}
+
+	wantFP := []Confusion{
+		{Case: "python", Item: "fitness", Rank: 3, Similarity: 0.3, Threshold: 0.2},
+		{Case: "gym", Item: "python", Rank: 1, Similarity: 0.25, Threshold: 0.2},
+	}
+	if !reflect.DeepEqual(report.FalsePositives, wantFP) {
+		t.Errorf("FalsePositives = %+v\nexpected %+v", report.FalsePositives, wantFP)
+	}
+	wantFN := []Confusion{{Case: "python", Item: "testing"}, {Case: "gym", Item: "fitness"}}
+	if !reflect.DeepEqual(report.FalseNegatives, wantFN) {
+		t.Errorf("FalseNegatives = %+v\nexpected %+v", report.FalseNegatives, wantFN)
+	}
+}
+
+func TestCheckGates(t *testing.T) {
+	report := EvalReport{Precision: 0.9, Recall: 0.6, MicroF1: 0.72, MacroF1: 0.7, MRR: 0.8}
+
+	tests := []struct {
+		name  string
+		gates Gates
+		want  []string
+	}{
+		{"none", Gates{}, nil},
+		{"met", Gates{Precision: 0.9, MRR: 0.5}, nil},
+		{"failed", Gates{Recall: 0.7, MicroF1: 0.8, MRR: 0.5}, []string{"recall 0.60 < 0.70", "micro F1 0.72 < 0.80"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := report.CheckGates(tt.gates); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CheckGates() = %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package classifier
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Metadata is an item's YAML frontmatter
+type Metadata struct {
+	Name        string     `yaml:"name"`
+	Description string     `yaml:"description"`
+	Priority    string     `yaml:"priority"`
+	Type        string     `yaml:"type"`
+	Keywords    StringList `yaml:"keywords"`
+	Examples    StringList `yaml:"examples"` // prompts the item should match
+	Aliases     StringList `yaml:"aliases"`
+	Tags        StringList `yaml:"tags"`
+	Threshold   *float32   `yaml:"threshold"` // overrides every configured threshold
+
+	// Prompts the item must not fire on; both keys are accepted
+	NotFor           StringList `yaml:"not_for"`
+	NegativeExamples StringList `yaml:"negative_examples"`
+
+	// Extra holds every other key, e.g. Claude Code's tools or model
+	Extra map[string]any `yaml:",inline"`
+}
+
+// StringList accepts either a YAML sequence of strings or a single string
+type StringList []string
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (l *StringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		if node.Tag == "!!null" {
+			*l = nil
+			return nil
+		}
+		*l = StringList{node.Value}
+		return nil
+	}
+
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// FrontmatterError is a problem with an item's frontmatter at a file line
+type FrontmatterError struct {
+	Line    int // 1-based line in the file, 0 when unknown
+	Message string
+}
+
+// Error implements error
+func (e *FrontmatterError) Error() string {
+	if e.Line == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// yamlLinePattern finds the line number in yaml.v3 error messages
+var yamlLinePattern = regexp.MustCompile(`line (\d+): `)
+
+// ParseFrontmatter splits content into its YAML frontmatter and the body
+// after it. found is false when content does not start with frontmatter.
+// Errors are *FrontmatterError values carrying the file line.
+func ParseFrontmatter(content string) (meta Metadata, body string, found bool, err error) {
+	lines := strings.Split(content, "\n")
+	if len(lines) == 0 || strings.TrimRight(lines[0], " \t\r") != "---" {
+		return meta, content, false, nil
+	}
+
+	// Find closing ---
+	closing := -1
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == "---" {
+			closing = i
+			break
+		}
+	}
+	if closing == -1 {
+		return meta, content, true, &FrontmatterError{Line: 1, Message: "frontmatter is not closed with ---"}
+	}
+
+	body = strings.Join(lines[closing+1:], "\n")
+	source := strings.Join(lines[1:closing], "\n")
+	if err := yaml.Unmarshal([]byte(source), &meta); err != nil {
+		return Metadata{}, body, true, frontmatterYAMLError(err)
+	}
+	return meta, body, true, nil
+}
+
+// frontmatterYAMLError converts a yaml.v3 error into a FrontmatterError,
+// shifting its line past the opening ---
+func frontmatterYAMLError(err error) error {
+	message := err.Error()
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) && len(typeErr.Errors) > 0 {
+		message = typeErr.Errors[0]
+	}
+	message = strings.TrimPrefix(message, "yaml: ")
+
+	line := 0
+	if m := yamlLinePattern.FindStringSubmatchIndex(message); m != nil {
+		n, _ := strconv.Atoi(message[m[2]:m[3]])
+		line = n + 1
+		message = message[:m[0]] + message[m[1]:]
+	}
+	return &FrontmatterError{Line: line, Message: "invalid YAML: " + message}
+}
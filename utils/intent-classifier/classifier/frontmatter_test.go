@@ -0,0 +1,168 @@
+package classifier
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFrontmatter(t *testing.T) {
+	content := `---
+name: python-expert
+description: >
+  Expert Python help.
+  name: not-the-name
+priority: high
+keywords: [django, flask]
+examples:
+  - build a REST API with FastAPI
+  - fix my pandas dataframe
+aliases: py
+tags:
+  - language
+threshold: 0.45
+not_for: explain this database schema
+negative_examples:
+  - my SQL query is slow
+tools: Read, Grep
+model: sonnet
+---
+Body text`
+
+	meta, body, found, err := ParseFrontmatter(content)
+	if err != nil || !found {
+		t.Fatalf("ParseFrontmatter() found = %v, error = %v", found, err)
+	}
+	if body != "Body text" {
+		t.Errorf("body = %q", body)
+	}
+
+	threshold := float32(0.45)
+	expected := Metadata{
+		Name:        "python-expert",
+		Description: "Expert Python help. name: not-the-name\n",
+		Priority:    "high",
+		Keywords:    StringList{"django", "flask"},
+		Examples:    StringList{"build a REST API with FastAPI", "fix my pandas dataframe"},
+		Aliases:     StringList{"py"},
+		Tags:        StringList{"language"},
+		Threshold:   &threshold,
+
+		NotFor:           StringList{"explain this database schema"},
+		NegativeExamples: StringList{"my SQL query is slow"},
+
+		Extra: map[string]any{"tools": "Read, Grep", "model": "sonnet"},
+	}
+	if !reflect.DeepEqual(meta, expected) {
+		t.Errorf("ParseFrontmatter() =\n%+v\nexpected\n%+v", meta, expected)
+	}
+}
+
+func TestParseFrontmatterErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		expectedLine int
+		message      string
+	}{
+		{
+			name:         "bad indentation",
+			content:      "---\nname: x\n  bad: indent\n---\nBody",
+			expectedLine: 3,
+			message:      "mapping values are not allowed",
+		},
+		{
+			name:         "wrong type",
+			content:      "---\nname: x\npriority: high\nkeywords:\n  nested: map\n---\nBody",
+			expectedLine: 5,
+			message:      "cannot unmarshal",
+		},
+		{
+			name:         "not closed",
+			content:      "---\nname: x\nBody",
+			expectedLine: 1,
+			message:      "not closed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, found, err := ParseFrontmatter(tt.content)
+			if !found {
+				t.Error("expected frontmatter to be found")
+			}
+			var fmErr *FrontmatterError
+			if !errors.As(err, &fmErr) {
+				t.Fatalf("ParseFrontmatter() error = %v, expected *FrontmatterError", err)
+			}
+			if fmErr.Line != tt.expectedLine {
+				t.Errorf("line = %d, expected %d (%v)", fmErr.Line, tt.expectedLine, err)
+			}
+			if !strings.Contains(fmErr.Message, tt.message) {
+				t.Errorf("message = %q, expected it to contain %q", fmErr.Message, tt.message)
+			}
+		})
+	}
+
+	t.Run("no frontmatter", func(t *testing.T) {
+		_, body, found, err := ParseFrontmatter("# Title\nname: x")
+		if found || err != nil || body != "# Title\nname: x" {
+			t.Errorf("ParseFrontmatter() found = %v, error = %v, body = %q", found, err, body)
+		}
+	})
+}
+
+func TestScanItems(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"skills/good.md":     "---\nname: good\ndescription: Does good things\n---\nBody",
+		"skills/broken.md":   "---\nname: broken\nkeywords: [a, b\n---\nBody",
+		"skills/nameless.md": "---\npriority: high\n---\nBody",
+		"skills/README.md":   "# Skills\n\nDocumentation only",
+		"skills/notes.txt":   "---\nname: notes\n---\n",
+		"commands/deploy.md": "Deploy the app",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	items, diagnostics, err := ScanItems(root)
+	if err != nil {
+		t.Fatalf("ScanItems() error = %v", err)
+	}
+
+	var names []string
+	for _, item := range items {
+		names = append(names, item.Name)
+	}
+	if strings.Join(names, ",") != "deploy,good" {
+		t.Errorf("items = %v, expected [deploy good]", names)
+	}
+	if items[1].Metadata.Description != "Does good things" {
+		t.Errorf("metadata not attached: %+v", items[1].Metadata)
+	}
+
+	if len(diagnostics) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %+v", diagnostics)
+	}
+	if !strings.HasSuffix(diagnostics[0].Path, "broken.md") || diagnostics[0].Line == 0 {
+		t.Errorf("unexpected diagnostic %s", diagnostics[0])
+	}
+	if !strings.HasSuffix(diagnostics[1].Path, "nameless.md") || !strings.Contains(diagnostics[1].Message, "no name") {
+		t.Errorf("unexpected diagnostic %s", diagnostics[1])
+	}
+
+	// A single broken file is an error that names the problem
+	if _, _, err := ScanItems(filepath.Join(root, "skills", "broken.md")); err == nil || !strings.Contains(err.Error(), "broken.md:") {
+		t.Errorf("ScanItems(broken file) error = %v", err)
+	}
+}
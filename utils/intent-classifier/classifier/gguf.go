@@ -0,0 +1,68 @@
+package classifier
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ggufMagic starts every GGUF file
+const ggufMagic = "GGUF"
+
+// ggufMaxCount bounds the tensor and metadata counts of a plausible header
+const ggufMaxCount = 1 << 24
+
+// GGUFHeader is the fixed-size start of a GGUF file
+type GGUFHeader struct {
+	Version       uint32
+	TensorCount   uint64
+	MetadataCount uint64
+}
+
+// ReadGGUFHeader reads the header of the GGUF file at path, see ParseGGUFHeader
+func ReadGGUFHeader(path string) (GGUFHeader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return GGUFHeader{}, err
+	}
+	defer file.Close()
+
+	header, err := ParseGGUFHeader(file)
+	if err != nil {
+		return header, fmt.Errorf("%s: %w", path, err)
+	}
+	return header, nil
+}
+
+// ParseGGUFHeader reads a GGUF header from r and checks that llama.cpp
+// could load the file: the magic, a supported version (2 or 3) and
+// plausible counts. It catches HTML error pages and truncated downloads
+// before they reach llama.cpp.
+func ParseGGUFHeader(r io.Reader) (GGUFHeader, error) {
+	var header GGUFHeader
+
+	buf := make([]byte, len(ggufMagic)+4+8+8)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return header, errors.New("not a GGUF model: file too short")
+		}
+		return header, err
+	}
+	if string(buf[:len(ggufMagic)]) != ggufMagic {
+		return header, fmt.Errorf("not a GGUF model: bad magic %q", buf[:len(ggufMagic)])
+	}
+
+	fields := buf[len(ggufMagic):]
+	header.Version = binary.LittleEndian.Uint32(fields)
+	header.TensorCount = binary.LittleEndian.Uint64(fields[4:])
+	header.MetadataCount = binary.LittleEndian.Uint64(fields[12:])
+	if header.Version < 2 || header.Version > 3 {
+		return header, fmt.Errorf("unsupported GGUF version %d", header.Version)
+	}
+	if header.TensorCount == 0 || header.TensorCount > ggufMaxCount || header.MetadataCount > ggufMaxCount {
+		return header, fmt.Errorf("corrupt GGUF header: %d tensors, %d metadata entries", header.TensorCount, header.MetadataCount)
+	}
+	return header, nil
+}
@@ -0,0 +1,51 @@
+package classifier
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// ggufBytes returns a GGUF header with the given fields
+func ggufBytes(magic string, version uint32, tensors, metadata uint64) []byte {
+	data := []byte(magic)
+	data = binary.LittleEndian.AppendUint32(data, version)
+	data = binary.LittleEndian.AppendUint64(data, tensors)
+	return binary.LittleEndian.AppendUint64(data, metadata)
+}
+
+func TestReadGGUFHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{"version 3", ggufBytes("GGUF", 3, 101, 24), false},
+		{"version 2", ggufBytes("GGUF", 2, 1, 0), false},
+		{"html error page", []byte("<!DOCTYPE html><html><body>Not Found</body></html>"), true},
+		{"truncated", ggufBytes("GGUF", 3, 101, 24)[:10], true},
+		{"version 1", ggufBytes("GGUF", 1, 101, 24), true},
+		{"future version", ggufBytes("GGUF", 4, 101, 24), true},
+		{"no tensors", ggufBytes("GGUF", 3, 0, 24), true},
+		{"garbage counts", ggufBytes("GGUF", 3, 1<<40, 24), true},
+		{"empty", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "model.gguf")
+			if err := os.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			header, err := ReadGGUFHeader(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadGGUFHeader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && header.TensorCount == 0 {
+				t.Errorf("ReadGGUFHeader() = %+v, expected the counts to be read", header)
+			}
+		})
+	}
+}
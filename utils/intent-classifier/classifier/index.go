@@ -0,0 +1,220 @@
+package classifier
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Index holds everything needed to classify against a directory without
+// reading it: the item files, their preprocessed texts and their
+// embeddings. It depends only on the items, so rebuilding an unchanged
+// tree writes the same index on any machine.
+type Index struct {
+	Root       string       // absolute path the index was built from
+	Model      string       // identity of the embedding model, see BuildIndex
+	Chunking   ChunkOptions // chunk size and overlap the texts were produced with
+	Preprocess string       // PreprocessVersion the texts were produced with
+	Entries    []IndexEntry // sorted by path
+}
+
+// IndexEntry is one item file of an Index
+type IndexEntry struct {
+	Path    string
+	Hash    string // HashContent of Content
+	Content string
+
+	Chunks       []string
+	Examples     []string
+	RawExamples  []string
+	Negatives    []string
+	RawNegatives []string
+	Vectors      [][]float32 // one per text, in the order of itemTexts.all
+}
+
+// IndexStats reports what an index build did
+type IndexStats struct {
+	Added     int // new item files
+	Updated   int // item files whose content changed
+	Unchanged int // item files reused from the previous index
+	Removed   int // item files that disappeared
+}
+
+// String summarizes the build, e.g. "2 added, 1 updated, 10 unchanged, 0 removed"
+func (s IndexStats) String() string {
+	return fmt.Sprintf("%d added, %d updated, %d unchanged, %d removed", s.Added, s.Updated, s.Unchanged, s.Removed)
+}
+
+// texts returns the preprocessed texts of the entry
+func (e IndexEntry) texts() itemTexts {
+	return itemTexts{
+		chunks:       e.Chunks,
+		examples:     e.Examples,
+		raw:          e.RawExamples,
+		negatives:    e.Negatives,
+		rawNegatives: e.RawNegatives,
+	}
+}
+
+// BuildIndex embeds the items under root and returns them as an Index.
+// model identifies the embedder; an index built with another model,
+// chunking or preprocessing is never reused. Entries of previous whose file
+// has the same content hash are carried over without embedding them again.
+func (c *Classifier) BuildIndex(ctx context.Context, root string, model string, chunking ChunkOptions, previous *Index) (*Index, IndexStats, []Diagnostic, error) {
+	var stats IndexStats
+
+	chunking, err := chunking.withDefaults()
+	if err != nil {
+		return nil, stats, nil, err
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return nil, stats, nil, err
+	}
+	if previous != nil && (previous.Model != model || previous.Preprocess != PreprocessVersion ||
+		previous.Chunking.Size != chunking.Size || previous.Chunking.Overlap != chunking.Overlap) {
+		previous = nil
+	}
+
+	known := make(map[string]IndexEntry)
+	if previous != nil {
+		for _, entry := range previous.Entries {
+			known[entry.Path] = entry
+		}
+	}
+
+	idx := &Index{
+		Root:       root,
+		Model:      model,
+		Chunking:   ChunkOptions{Size: chunking.Size, Overlap: chunking.Overlap},
+		Preprocess: PreprocessVersion,
+	}
+	tokenizer, _ := c.embedder.(Tokenizer)
+	embeddings := make(map[string][]float32)
+	var pending []int // entries that still need their vectors
+	var missing []string
+	var diagnostics []Diagnostic
+
+	err = filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(strings.ToLower(p), ".md") {
+			return nil
+		}
+
+		old, seen := known[p]
+		delete(known, p)
+
+		content, err := os.ReadFile(p)
+		if err != nil {
+			diagnostics = append(diagnostics, Diagnostic{Path: p, Message: fmt.Sprintf("failed to read: %v", err)})
+			return nil
+		}
+		hash := HashContent(string(content))
+		if seen && old.Hash == hash {
+			stats.Unchanged++
+			idx.Entries = append(idx.Entries, old)
+			return nil
+		}
+
+		item, diagnostic, ok := loadItem(p, string(content))
+		if diagnostic != nil {
+			diagnostics = append(diagnostics, *diagnostic)
+		}
+		if !ok {
+			return nil
+		}
+		texts, err := c.itemTexts(item, chunking, tokenizer)
+		if err != nil {
+			return fmt.Errorf("failed to chunk %s: %w", item.Name, err)
+		}
+
+		if seen {
+			stats.Updated++
+		} else {
+			stats.Added++
+		}
+		pending = append(pending, len(idx.Entries))
+		missing = append(missing, c.lookupEmbeddings(texts.all(), 0, embeddings)...)
+		idx.Entries = append(idx.Entries, IndexEntry{
+			Path:         p,
+			Hash:         hash,
+			Content:      string(content),
+			Chunks:       texts.chunks,
+			Examples:     texts.examples,
+			RawExamples:  texts.raw,
+			Negatives:    texts.negatives,
+			RawNegatives: texts.rawNegatives,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, stats, diagnostics, err
+	}
+	stats.Removed = len(known)
+
+	uncached, err := c.embedMissing(ctx, missing, embeddings)
+	diagnostics = append(diagnostics, uncached...)
+	if err != nil {
+		return nil, stats, diagnostics, err
+	}
+	failed := make(map[int]bool)
+	for _, i := range pending {
+		entry := &idx.Entries[i]
+		for _, text := range entry.texts().all() {
+			if embeddings[text] == nil {
+				diagnostics = append(diagnostics, Diagnostic{Path: entry.Path, Message: "failed to embed"})
+				failed[i] = true
+				break
+			}
+			entry.Vectors = append(entry.Vectors, embeddings[text])
+		}
+	}
+	if len(failed) > 0 {
+		entries := idx.Entries[:0]
+		for i, entry := range idx.Entries {
+			if !failed[i] {
+				entries = append(entries, entry)
+			}
+		}
+		idx.Entries = entries
+	}
+
+	sort.Slice(idx.Entries, func(i, j int) bool {
+		return idx.Entries[i].Path < idx.Entries[j].Path
+	})
+	return idx, stats, diagnostics, nil
+}
+
+// UseIndex makes the texts and embeddings of idx resident, so classifying
+// its items with the chunk size and overlap of idx.Chunking neither
+// preprocesses nor embeds them. It returns the items without touching the
+// files they came from; entries that no longer parse are reported as
+// diagnostics.
+func (c *Classifier) UseIndex(idx *Index) ([]Item, []Diagnostic) {
+	var items []Item
+	var diagnostics []Diagnostic
+	for _, entry := range idx.Entries {
+		item, diagnostic, ok := loadItem(entry.Path, entry.Content)
+		if diagnostic != nil {
+			diagnostics = append(diagnostics, *diagnostic)
+		}
+		if !ok {
+			continue
+		}
+		items = append(items, item)
+
+		texts := entry.texts()
+		c.texts.put(textsKey(item, idx.Chunking), texts)
+		for i, text := range texts.all() {
+			if i < len(entry.Vectors) {
+				c.memo.put(text, entry.Vectors[i])
+			}
+		}
+	}
+	return items, diagnostics
+}
@@ -0,0 +1,285 @@
+package classifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeItems creates the given item files under a new skills directory
+func writeItems(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "skills"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, "skills", name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestBuildIndex(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	root := writeItems(t, map[string]string{
+		"python.md": "---\nname: python-expert\n---\nPython django",
+		"go.md":     "---\nname: go-expert\n---\nGo goroutines",
+		"review.md": "---\nname: reviewer\n---\nReview code",
+		"notes.txt": "python",
+	})
+	embedder := newFakeEmbedder()
+	c := New(embedder, nil)
+
+	idx, stats, _, err := c.BuildIndex(context.Background(), root, "fake", ChunkOptions{}, nil)
+	if err != nil {
+		t.Fatalf("BuildIndex() error = %v", err)
+	}
+	if stats != (IndexStats{Added: 3}) || len(idx.Entries) != 3 || len(embedder.calls) != 1 {
+		t.Fatalf("unexpected first build: %s, %d entries, %d embed calls", stats, len(idx.Entries), len(embedder.calls))
+	}
+
+	path := filepath.Join(root, "index.bin")
+	if err := SaveIndex(path, idx); err != nil {
+		t.Fatalf("SaveIndex() error = %v", err)
+	}
+	loaded, err := LoadIndex(path)
+	if err != nil {
+		t.Fatalf("LoadIndex() error = %v", err)
+	}
+
+	// Nothing but the items goes into the file, so a fresh build of the
+	// same tree at another time writes the same bytes
+	later := time.Now().Add(time.Hour)
+	for _, name := range []string{"python.md", "go.md", "review.md"} {
+		if err := os.Chtimes(filepath.Join(root, "skills", name), later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rebuilt, _, _, err := c.BuildIndex(context.Background(), root, "fake", ChunkOptions{}, nil)
+	if err != nil {
+		t.Fatalf("BuildIndex() error = %v", err)
+	}
+	if err := SaveIndex(filepath.Join(root, "rebuilt.bin"), rebuilt); err != nil {
+		t.Fatalf("SaveIndex() error = %v", err)
+	}
+	first, _ := os.ReadFile(path)
+	second, _ := os.ReadFile(filepath.Join(root, "rebuilt.bin"))
+	if !bytes.Equal(first, second) {
+		t.Error("rebuilding an unchanged tree changed the index file")
+	}
+
+	// Change one file, touch another without changing it and remove a third
+	later = later.Add(time.Hour)
+	if err := os.WriteFile(filepath.Join(root, "skills", "python.md"), []byte("---\nname: python-expert\n---\nPython django review"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(root, "skills", "go.md"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, "skills", "review.md")); err != nil {
+		t.Fatal(err)
+	}
+
+	embedder.calls = nil
+	idx, stats, _, err = c.BuildIndex(context.Background(), root, "fake", ChunkOptions{}, loaded)
+	if err != nil {
+		t.Fatalf("BuildIndex() error = %v", err)
+	}
+	if stats != (IndexStats{Updated: 1, Unchanged: 1, Removed: 1}) {
+		t.Errorf("incremental build stats = %s", stats)
+	}
+	if len(embedder.calls) != 1 || len(embedder.calls[0]) != 1 || !strings.Contains(embedder.calls[0][0], "review") {
+		t.Errorf("expected only the changed file to be embedded, got %v", embedder.calls)
+	}
+
+	// Texts of older preprocessing are never reused
+	stale := *idx
+	stale.Preprocess = "0"
+	_, stats, _, err = c.BuildIndex(context.Background(), root, "fake", ChunkOptions{}, &stale)
+	if err != nil {
+		t.Fatalf("BuildIndex() error = %v", err)
+	}
+	if stats != (IndexStats{Added: 2}) {
+		t.Errorf("build over older preprocessing stats = %s", stats)
+	}
+
+	// Another model never reuses the index
+	_, stats, _, err = c.BuildIndex(context.Background(), root, "other", ChunkOptions{}, idx)
+	if err != nil {
+		t.Fatalf("BuildIndex() error = %v", err)
+	}
+	if stats != (IndexStats{Added: 2}) {
+		t.Errorf("build for another model stats = %s", stats)
+	}
+}
+
+func TestClassifyWithIndex(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	root := writeItems(t, map[string]string{
+		"python.md": "---\nname: python-expert\nexamples: django please\n---\nPython",
+		"go.md":     "---\nname: go-expert\n---\nGo goroutines",
+	})
+	idx, _, _, err := New(newFakeEmbedder(), nil).BuildIndex(context.Background(), root, "fake", ChunkOptions{}, nil)
+	if err != nil {
+		t.Fatalf("BuildIndex() error = %v", err)
+	}
+
+	// The files and the embedding cache are gone; only the index is left
+	if err := os.RemoveAll(root); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	embedder := newFakeEmbedder()
+	c := New(embedder, nil)
+	items, diagnostics := c.UseIndex(idx)
+	if len(items) != 2 || len(diagnostics) != 0 {
+		t.Fatalf("UseIndex() = %d items, %v", len(items), diagnostics)
+	}
+
+	result, err := c.Classify(context.Background(), Request{Prompt: "django", Threshold: 0.5, Chunking: idx.Chunking}, items)
+	if err != nil {
+		t.Fatalf("Classify() error = %v", err)
+	}
+	if got := strings.Join(matchNames(result.Matches), ","); got != "python-expert" {
+		t.Errorf("Classify() matches = %s", got)
+	}
+	if len(embedder.calls) != 1 {
+		t.Errorf("expected only the prompt to be embedded, got %v", embedder.calls)
+	}
+}
+
+func TestIndexIsPortable(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	checkout := writeItems(t, map[string]string{
+		"python.md": "---\nname: python-expert\nexamples: [django please]\nnot_for: goroutines\n---\nPython",
+	})
+	idx, _, _, err := New(newFakeEmbedder(), nil).BuildIndex(context.Background(), checkout, "fake", ChunkOptions{}, nil)
+	if err != nil {
+		t.Fatalf("BuildIndex() error = %v", err)
+	}
+	if err := SaveIndex(filepath.Join(checkout, "intent-index.bin"), idx); err != nil {
+		t.Fatalf("SaveIndex() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(checkout, "intent-index.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), indexMagic+"\x04\x00\x00\x00") {
+		t.Errorf("expected a little-endian version after the magic, got %q", data[:8])
+	}
+	if strings.Contains(string(data), checkout) {
+		t.Errorf("index contains the absolute path %s", checkout)
+	}
+
+	// A second checkout of the same tree finds its own files
+	other := filepath.Join(t.TempDir(), "clone")
+	if err := os.Rename(checkout, other); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadIndex(filepath.Join(other, "intent-index.bin"))
+	if err != nil {
+		t.Fatalf("LoadIndex() error = %v", err)
+	}
+	if loaded.Root != other || loaded.Entries[0].Path != filepath.Join(other, "skills", "python.md") {
+		t.Errorf("LoadIndex() root = %s, path = %s", loaded.Root, loaded.Entries[0].Path)
+	}
+	entry, original := loaded.Entries[0], idx.Entries[0]
+	if entry.Hash != original.Hash || len(entry.Vectors) != 3 ||
+		entry.Vectors[1][1] != original.Vectors[1][1] || entry.RawNegatives[0] != "goroutines" || loaded.Chunking != idx.Chunking {
+		t.Errorf("LoadIndex() entry = %+v, expected %+v", entry, original)
+	}
+}
+
+// indexFile prefixes payload with the magic, the version and the checksum
+func indexFile(payload string) string {
+	header := binary.LittleEndian.AppendUint32([]byte(indexMagic), IndexVersion)
+	header = binary.LittleEndian.AppendUint32(header, crc32.ChecksumIEEE([]byte(payload)))
+	return string(header) + payload
+}
+
+func TestLoadIndexErrors(t *testing.T) {
+	dir := t.TempDir()
+	// model "m", chunking and preprocess version, then root "." and entries
+	header := func(preprocess string) string {
+		return "\x01\x00\x00\x00m" + strings.Repeat("\x00", 8) + string(rune(len(preprocess))) + "\x00\x00\x00" + preprocess + "\x01\x00\x00\x00."
+	}
+	// one entry "a.md" up to its vectors
+	entry := header(PreprocessVersion) + "\x01\x00\x00\x00" + "\x04\x00\x00\x00a.md" + strings.Repeat("\x00\x00\x00\x00", 7)
+	tests := []struct {
+		name    string
+		content string
+		errMsg  string
+	}{
+		{"not an index", "---\nname: x\n---\n", "not an intent-classifier index"},
+		{"other version", indexMagic + "\x63\x00\x00\x00", "version 99"},
+		{"gob index of version 1", indexMagic + "\x01\x00\x00\x00garbage", "version 1"},
+		{"index of version 2", indexMagic + "\x02\x00\x00\x00\xff\x00\x00\x00model", "version 2"},
+		{"index of version 3", indexMagic + "\x03\x00\x00\x00\x00\x00\x00\x00", "version 3"},
+		{"no checksum", indexMagic + "\x04\x00\x00\x00\x00\x00", "checksum mismatch"},
+		{"checksum mismatch", indexFile("\x01\x00\x00\x00m")[:12] + "\x01\x00\x00\x00n", "checksum mismatch"},
+		{"truncated", indexFile("\xff\x00\x00\x00model"), "failed to decode"},
+		{"older preprocessing", indexFile(header("0") + "\x00\x00\x00\x00"), "preprocessing version 0"},
+		{"zero dimension", indexFile(entry + "\x00\x00\x00\x00\xff\xff\xff\xff"), "vectors of dimension 0"},
+		{"vector count beyond the data", indexFile(entry + "\x80\x01\x00\x00\xff\xff\xff\x7f"), "unexpected end of file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "-"))
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadIndex(path); err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("LoadIndex() error = %v, expected %q", err, tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestClassifyWithStaleIndex(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	root := writeItems(t, map[string]string{
+		"python.md": "---\nname: python-expert\n---\nPython django",
+		"go.md":     "---\nname: go-expert\n---\nGo goroutines",
+	})
+	idx, _, _, err := New(newFakeEmbedder(), nil).BuildIndex(context.Background(), root, "fake", ChunkOptions{}, nil)
+	if err != nil {
+		t.Fatalf("BuildIndex() error = %v", err)
+	}
+
+	// Edited after the index was checked in
+	if err := os.WriteFile(filepath.Join(root, "skills", "go.md"), []byte("---\nname: go-expert\n---\nGo goroutines review"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	embedder := newFakeEmbedder()
+	c := New(embedder, nil)
+	c.UseIndex(idx)
+	items, _, err := ScanItems(root)
+	if err != nil {
+		t.Fatalf("ScanItems() error = %v", err)
+	}
+	if _, err := c.Classify(context.Background(), Request{Prompt: "python", Chunking: idx.Chunking}, items); err != nil {
+		t.Fatalf("Classify() error = %v", err)
+	}
+
+	// The prompt and the stale item are embedded live, the fresh item is not
+	if len(embedder.calls) != 2 || len(embedder.calls[1]) != 1 || !strings.Contains(embedder.calls[1][0], "review") {
+		t.Errorf("expected only the edited item to be embedded, got %v", embedder.calls)
+	}
+}
@@ -0,0 +1,240 @@
+package classifier
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// IndexFileName is the index picked up from the embed directory, e.g.
+// .claude/intent-index.bin
+const IndexFileName = "intent-index.bin"
+
+// IndexVersion is bumped on incompatible changes to the index file format
+const IndexVersion = 4
+
+// indexMagic starts every index file
+const indexMagic = "ICIX"
+
+// The index file is little-endian throughout, so it can be checked in and
+// shared between machines:
+//
+//	magic "ICIX", uint32 version, uint32 CRC-32 of everything that follows
+//	string model, uint32 chunk size, uint32 chunk overlap, string preprocess version
+//	string root, relative to the index file's directory
+//	uint32 entry count, then per entry:
+//	  string path (relative to root), string hash, string content,
+//	  string lists chunks, examples, raw examples, negatives, raw negatives,
+//	  uint32 dimension, uint32 vector count, float32 values
+//
+// Strings are a uint32 byte length followed by UTF-8, string lists a uint32
+// count followed by strings. Paths use forward slashes. Nothing depends on
+// the machine or the time of the build, so an unchanged tree always gives
+// the same file.
+
+// errIndexTruncated is reported for files that end in the middle of a value
+var errIndexTruncated = errors.New("unexpected end of file")
+
+// SaveIndex writes idx to path. Paths are stored relative to the directory
+// of path, so the index stays valid wherever the tree is checked out.
+func SaveIndex(path string, idx *Index) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	root, err := filepath.Rel(filepath.Dir(absPath), idx.Root)
+	if err != nil {
+		return fmt.Errorf("index root %s: %w", idx.Root, err)
+	}
+
+	var w indexWriter
+	w.string(idx.Model)
+	w.uint32(uint32(idx.Chunking.Size))
+	w.uint32(uint32(idx.Chunking.Overlap))
+	w.string(idx.Preprocess)
+	w.string(filepath.ToSlash(root))
+
+	w.uint32(uint32(len(idx.Entries)))
+	for _, entry := range idx.Entries {
+		rel, err := filepath.Rel(idx.Root, entry.Path)
+		if err != nil {
+			return fmt.Errorf("index entry %s: %w", entry.Path, err)
+		}
+		w.string(filepath.ToSlash(rel))
+		w.string(entry.Hash)
+		w.string(entry.Content)
+		w.strings(entry.Chunks)
+		w.strings(entry.Examples)
+		w.strings(entry.RawExamples)
+		w.strings(entry.Negatives)
+		w.strings(entry.RawNegatives)
+		w.vectors(entry.Vectors)
+	}
+
+	payload := w.buf.Bytes()
+	data := append([]byte(indexMagic), binary.LittleEndian.AppendUint32(nil, IndexVersion)...)
+	data = binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(payload))
+	return WriteFileAtomic(path, append(data, payload...))
+}
+
+// LoadIndex reads an index written by SaveIndex. Paths in the returned
+// index are absolute again.
+func LoadIndex(path string) (*Index, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(data, []byte(indexMagic)) {
+		return nil, fmt.Errorf("%s is not an intent-classifier index", path)
+	}
+	r := indexReader{data: data[len(indexMagic):]}
+	if version := r.uint32(); r.err != nil {
+		return nil, fmt.Errorf("%s is not an intent-classifier index", path)
+	} else if version != IndexVersion {
+		return nil, fmt.Errorf("index %s has version %d, expected %d: rebuild it", path, version, IndexVersion)
+	}
+	// A truncated file or a bad merge is reported rather than decoded
+	if checksum := r.uint32(); r.err != nil || crc32.ChecksumIEEE(r.data) != checksum {
+		return nil, fmt.Errorf("index %s is corrupt (checksum mismatch): rebuild it", path)
+	}
+
+	idx := &Index{Model: r.string()}
+	idx.Chunking.Size = int(r.uint32())
+	idx.Chunking.Overlap = int(r.uint32())
+	idx.Preprocess = r.string()
+	idx.Root = filepath.Join(filepath.Dir(absPath), filepath.FromSlash(r.string()))
+
+	count := r.uint32()
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		entry := IndexEntry{Path: filepath.Join(idx.Root, filepath.FromSlash(r.string()))}
+		entry.Hash = r.string()
+		entry.Content = r.string()
+		entry.Chunks = r.strings()
+		entry.Examples = r.strings()
+		entry.RawExamples = r.strings()
+		entry.Negatives = r.strings()
+		entry.RawNegatives = r.strings()
+		entry.Vectors = r.vectors()
+		idx.Entries = append(idx.Entries, entry)
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("failed to decode index %s: %w", path, r.err)
+	}
+	if idx.Preprocess != PreprocessVersion {
+		return nil, fmt.Errorf("index %s has texts of preprocessing version %s, expected %s: rebuild it", path, idx.Preprocess, PreprocessVersion)
+	}
+	return idx, nil
+}
+
+// indexWriter appends little-endian values to a buffer
+type indexWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *indexWriter) uint32(v uint32) {
+	w.buf.Write(binary.LittleEndian.AppendUint32(nil, v))
+}
+
+func (w *indexWriter) string(s string) {
+	w.uint32(uint32(len(s)))
+	w.buf.WriteString(s)
+}
+
+func (w *indexWriter) strings(list []string) {
+	w.uint32(uint32(len(list)))
+	for _, s := range list {
+		w.string(s)
+	}
+}
+
+func (w *indexWriter) vectors(vectors [][]float32) {
+	dim := 0
+	if len(vectors) > 0 {
+		dim = len(vectors[0])
+	}
+	w.uint32(uint32(dim))
+	w.uint32(uint32(len(vectors)))
+	for _, vector := range vectors {
+		for _, v := range vector {
+			w.uint32(math.Float32bits(v))
+		}
+	}
+}
+
+// indexReader decodes little-endian values, remembering the first error
+type indexReader struct {
+	data []byte
+	err  error
+}
+
+// next returns the following n bytes, or nil once the data is exhausted
+func (r *indexReader) next(n uint64) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if uint64(len(r.data)) < n {
+		r.err = errIndexTruncated
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *indexReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *indexReader) string() string {
+	return string(r.next(uint64(r.uint32())))
+}
+
+func (r *indexReader) strings() []string {
+	count := r.uint32()
+	var list []string
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		list = append(list, r.string())
+	}
+	return list
+}
+
+func (r *indexReader) vectors() [][]float32 {
+	dim, count := uint64(r.uint32()), uint64(r.uint32())
+	if r.err != nil || count == 0 {
+		return nil
+	}
+	// Check the counts against the data before allocating for them
+	if dim == 0 {
+		r.err = fmt.Errorf("%d vectors of dimension 0", count)
+		return nil
+	}
+	if count > uint64(len(r.data))/(dim*4) {
+		r.err = errIndexTruncated
+		return nil
+	}
+	values := r.next(dim * count * 4)
+	if values == nil {
+		return nil
+	}
+	vectors := make([][]float32, count)
+	for i := range vectors {
+		vectors[i] = make([]float32, dim)
+		for j := range vectors[i] {
+			vectors[i][j] = math.Float32frombits(binary.LittleEndian.Uint32(values[(uint64(i)*dim+uint64(j))*4:]))
+		}
+	}
+	return vectors
+}
@@ -0,0 +1,167 @@
+package classifier
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Diagnostic reports a problem that kept a file from being loaded or scored
+// as an item. Problems that did not change the result, such as a cache entry
+// that could not be written, have no Path.
+type Diagnostic struct {
+	Path    string `json:"path"`
+	Line    int    `json:"line,omitempty"` // 1-based, 0 when not tied to a line
+	Message string `json:"message"`
+}
+
+// String formats the diagnostic as path:line: message
+func (d Diagnostic) String() string {
+	if d.Path == "" {
+		return d.Message
+	}
+	if d.Line == 0 {
+		return fmt.Sprintf("%s: %s", d.Path, d.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", d.Path, d.Line, d.Message)
+}
+
+// ScanItems reads file or directory and loads content. Markdown files whose
+// frontmatter is present but invalid (bad YAML, no name) are reported as
+// diagnostics; other files without frontmatter are skipped silently.
+func ScanItems(path string) ([]Item, []Diagnostic, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Single file
+	if !info.IsDir() {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		item, diagnostic, ok := loadItem(path, string(content))
+		if diagnostic != nil {
+			return nil, []Diagnostic{*diagnostic}, fmt.Errorf("invalid item file %s", diagnostic)
+		}
+		if !ok {
+			return nil, nil, fmt.Errorf("file must be .md with valid frontmatter (name field required)")
+		}
+		return []Item{item}, nil, nil
+	}
+
+	// Directory - recursively walk and read all files
+	var items []Item
+	var diagnostics []Diagnostic
+	err = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		content, err := os.ReadFile(p)
+		if err != nil {
+			diagnostics = append(diagnostics, Diagnostic{Path: p, Message: fmt.Sprintf("failed to read: %v", err)})
+			return nil // Continue walking
+		}
+
+		item, diagnostic, ok := loadItem(p, string(content))
+		if diagnostic != nil {
+			diagnostics = append(diagnostics, *diagnostic)
+		}
+		if ok {
+			items = append(items, item)
+		}
+		return nil
+	})
+
+	return items, diagnostics, err
+}
+
+// loadItem builds the item for the file at path. ok is false for files that
+// are not items; diagnostic explains why a file that looks like one is not.
+func loadItem(path string, content string) (item Item, diagnostic *Diagnostic, ok bool) {
+	// Must be .md file
+	if !strings.HasSuffix(strings.ToLower(path), ".md") {
+		return item, nil, false
+	}
+
+	meta, _, found, err := ParseFrontmatter(content)
+	if err != nil {
+		var fmErr *FrontmatterError
+		if errors.As(err, &fmErr) {
+			return item, &Diagnostic{Path: path, Line: fmErr.Line, Message: fmErr.Message}, false
+		}
+		return item, &Diagnostic{Path: path, Message: err.Error()}, false
+	}
+
+	// Slash commands are named after their file, so frontmatter is optional
+	isCommand := typeFromPath(path) == "command"
+	if !found && !isCommand {
+		return item, nil, false // Skip silently, e.g. a README
+	}
+	if meta.Name == "" && !isCommand {
+		return item, &Diagnostic{Path: path, Line: 1, Message: "frontmatter has no name field"}, false
+	}
+
+	name, priority, itemType := metadataDefaults(meta, path)
+	return Item{
+		Name:     name,
+		Path:     path,
+		Content:  content,
+		Priority: priority,
+		Type:     itemType,
+		Metadata: meta,
+	}, nil, true
+}
+
+// metadataDefaults returns the name, priority and type from meta, filling
+// what is missing from path and defaults. Only commands may lack a name;
+// loadItem rejects other items without one.
+func metadataDefaults(meta Metadata, path string) (string, string, string) {
+	name := strings.TrimSpace(meta.Name)
+	priority := strings.TrimSpace(meta.Priority)
+	itemType := strings.TrimSpace(meta.Type)
+
+	if priority == "" {
+		priority = "medium" // default priority
+	}
+
+	// Commands are invoked by file name (commands/deploy.md is /deploy)
+	if name == "" && typeFromPath(path) == "command" {
+		name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	// Auto-detect type from path if not specified in frontmatter
+	if itemType == "" {
+		itemType = typeFromPath(path)
+	}
+	if itemType == "" {
+		// Default to skill if can't determine
+		itemType = "skill"
+	}
+
+	return name, priority, itemType
+}
+
+// typeFromPath detects the item type from an agents/, skills/ or commands/
+// directory in path, returning "" when there is none
+func typeFromPath(path string) string {
+	if strings.Contains(path, "/agents/") || strings.Contains(path, "\\agents\\") {
+		return "agent"
+	}
+	if strings.Contains(path, "/skills/") || strings.Contains(path, "\\skills\\") {
+		return "skill"
+	}
+	if strings.Contains(path, "/commands/") || strings.Contains(path, "\\commands\\") {
+		return "command"
+	}
+	return ""
+}
@@ -0,0 +1,258 @@
+package classifier
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hybridgroup/yzma/pkg/llama"
+)
+
+// InitLlama loads the llama.cpp shared library from libPath and its
+// backends. It must be called once before any GGUF model is loaded.
+// logLevel 0 silences llama.cpp.
+func InitLlama(libPath string, logLevel int) error {
+	// Load llama.cpp library
+	if err := llama.Load(libPath); err != nil {
+		return llamaLoadError(err)
+	}
+
+	// Initialize llama.cpp
+	llama.Init()
+
+	// Set llama.cpp log level (0 = silent)
+	if logLevel == 0 {
+		llama.LogSet(llama.LogSilent())
+	}
+
+	// Load backends from the library path
+	llama.GGMLBackendLoadAllFromPath(libPath)
+	return nil
+}
+
+// FreeLlama releases the llama.cpp backend once all models are closed
+func FreeLlama() {
+	llama.BackendFree()
+}
+
+// llamaLoadError turns a llama.Load failure into an actionable error message
+func llamaLoadError(err error) error {
+	if strings.Contains(err.Error(), "libffi") {
+		return fmt.Errorf("missing libffi dependency\n\n" +
+			"Install libffi for your system:\n" +
+			"  • Ubuntu/Debian: sudo apt install libffi8\n" +
+			"  • Fedora/RHEL:   sudo dnf install libffi\n" +
+			"  • Arch Linux:    sudo pacman -S libffi\n" +
+			"  • macOS:         brew install libffi\n" +
+			"  • Nix:           nix profile install nixpkgs#libffi")
+	}
+	return fmt.Errorf("failed to load llama.cpp library: %v\n"+
+		"Hint: Ensure llama.cpp shared library is available\n"+
+		"      You can specify it with --lib /path/to/libllama.so", err)
+}
+
+// fingerprintHeadBytes is how much of a GGUF file is hashed into its
+// fingerprint; it covers the header and most of the metadata
+const fingerprintHeadBytes = 1 << 20
+
+// poolingNames names llama.cpp's pooling types in fingerprints
+var poolingNames = map[llama.PoolingType]string{
+	llama.PoolingTypeNone: "none",
+	llama.PoolingTypeMean: "mean",
+	llama.PoolingTypeCLS:  "cls",
+	llama.PoolingTypeLast: "last",
+	llama.PoolingTypeRank: "rank",
+}
+
+// LlamaEmbedder embeds texts with a GGUF sentence embedding model
+type LlamaEmbedder struct {
+	model       llama.Model
+	file        string
+	fingerprint string
+}
+
+// NewLlamaEmbedder loads the embedding model at modelPath; InitLlama must
+// have been called
+func NewLlamaEmbedder(modelPath string) (*LlamaEmbedder, error) {
+	model := llama.ModelLoadFromFile(modelPath, llama.ModelDefaultParams())
+	if model == 0 {
+		return nil, fmt.Errorf("failed to load embedding model from %s", modelPath)
+	}
+
+	fingerprint, err := modelFingerprint(modelPath, model)
+	if err != nil {
+		llama.ModelFree(model)
+		return nil, err
+	}
+	return &LlamaEmbedder{model: model, file: filepath.Base(modelPath), fingerprint: fingerprint}, nil
+}
+
+// modelFingerprint identifies the model at path by the hash of its first
+// bytes, its size, its dimension and the pooling its embeddings use
+func modelFingerprint(path string, model llama.Model) (string, error) {
+	fingerprint, err := fileFingerprint(path)
+	if err != nil {
+		return "", err
+	}
+
+	lctx := llama.InitFromModel(model, embeddingContextParams())
+	if lctx == 0 {
+		return "", fmt.Errorf("failed to create context from model")
+	}
+	pooling := llama.GetPoolingType(lctx)
+	llama.Free(lctx)
+
+	poolingName, ok := poolingNames[pooling]
+	if !ok {
+		poolingName = strconv.Itoa(int(pooling))
+	}
+	return fmt.Sprintf("%s n_embd=%d pooling=%s", fingerprint, llama.ModelNEmbd(model), poolingName), nil
+}
+
+// fileFingerprint identifies the GGUF file at path by the hash of its
+// first bytes and its size
+func fileFingerprint(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	head := sha256.New()
+	if _, err := io.CopyN(head, file, fingerprintHeadBytes); err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to fingerprint %s: %w", path, err)
+	}
+	return fmt.Sprintf("gguf=%x size=%d", head.Sum(nil)[:16], info.Size()), nil
+}
+
+// File returns the GGUF file name of the model
+func (e *LlamaEmbedder) File() string {
+	return e.file
+}
+
+// Fingerprint implements Fingerprinter
+func (e *LlamaEmbedder) Fingerprint() string {
+	return e.fingerprint
+}
+
+// Description returns llama.cpp's model description (architecture, size, quantization)
+func (e *LlamaEmbedder) Description() string {
+	return llama.ModelDesc(e.model)
+}
+
+// Close releases the model
+func (e *LlamaEmbedder) Close() {
+	llama.ModelFree(e.model)
+}
+
+// Embed implements Embedder
+func (e *LlamaEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	ctxParams := embeddingContextParams()
+
+	embeddings := make([][]float32, 0, len(texts))
+	for _, text := range texts {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// Create fresh context for each text to avoid state accumulation
+		lctx := llama.InitFromModel(e.model, ctxParams)
+		if lctx == 0 {
+			return nil, fmt.Errorf("failed to create context from model")
+		}
+
+		embedding, err := getEmbedding(e.model, lctx, text)
+		llama.Free(lctx)
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, embedding)
+	}
+
+	return embeddings, nil
+}
+
+// CountTokens implements Tokenizer, counting text without special tokens
+func (e *LlamaEmbedder) CountTokens(text string) (int, error) {
+	count := llama.Tokenize(llama.ModelGetVocab(e.model), text, nil, false, false)
+	if count < 0 {
+		return 0, fmt.Errorf("tokenization failed")
+	}
+	return int(count), nil
+}
+
+// MaxTokens implements TokenLimiter: getEmbedding keeps this many tokens
+// of a text
+func (e *LlamaEmbedder) MaxTokens() int {
+	return int(embeddingContextParams().NCtx) - embeddingReservedTokens
+}
+
+// embeddingReservedTokens is the room getEmbedding leaves in the context
+// for special tokens
+const embeddingReservedTokens = 10
+
+// embeddingContextParams returns the context parameters used for embeddings
+func embeddingContextParams() llama.ContextParams {
+	ctxParams := llama.ContextDefaultParams()
+	ctxParams.NCtx = 512
+	ctxParams.NBatch = 512
+	ctxParams.NUbatch = 512  // Set micro-batch size to match batch size
+	ctxParams.Embeddings = 1 // Enable embeddings mode
+	return ctxParams
+}
+
+// getEmbedding tokenizes text, encodes it and returns the normalized embedding
+func getEmbedding(model llama.Model, lctx llama.Context, text string) ([]float32, error) {
+	// Get max context size and reserve room for special tokens
+	maxTokens := int(llama.NCtx(lctx)) - embeddingReservedTokens
+
+	// Tokenize
+	vocab := llama.ModelGetVocab(model)
+	count := llama.Tokenize(vocab, text, nil, true, true)
+	if count <= 0 {
+		return nil, fmt.Errorf("tokenization returned no tokens")
+	}
+
+	// llama.cpp fills nothing when the buffer is too small, so tokenize
+	// everything and truncate afterwards. Chunks normally fit already.
+	tokens := make([]llama.Token, count)
+	llama.Tokenize(vocab, text, tokens, true, true)
+	if len(tokens) > maxTokens {
+		tokens = tokens[:maxTokens]
+	}
+
+	// Encode (use Encode for embedding models like BERT)
+	batch := llama.BatchGetOne(tokens)
+	if llama.Encode(lctx, batch) != 0 {
+		return nil, fmt.Errorf("encode failed")
+	}
+
+	// Get embeddings
+	nEmbd := llama.ModelNEmbd(model)
+	vec := llama.GetEmbeddingsSeq(lctx, 0, nEmbd)
+
+	// Normalize
+	var sum float64
+	for _, v := range vec {
+		sum += float64(v * v)
+	}
+	sum = math.Sqrt(sum)
+	norm := float32(1.0 / sum)
+
+	normalized := make([]float32, len(vec))
+	for i, v := range vec {
+		normalized[i] = v * norm
+	}
+
+	return normalized, nil
+}
@@ -0,0 +1,300 @@
+package classifier
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hybridgroup/yzma/pkg/llama"
+)
+
+const (
+	// llmContextSize fits the instructions, the prompt and a truncated item
+	llmContextSize = 2048
+
+	// llmMaxItemChars bounds how much of an item's content is shown to the LLM
+	llmMaxItemChars = 1500
+
+	// llmMaxPromptChars bounds how much of the user's prompt is shown to the
+	// LLM, so a long prompt still leaves room for the item
+	llmMaxPromptChars = 1000
+
+	// llmMaxResponseTokens is enough for "100" plus an end-of-generation token
+	llmMaxResponseTokens = 4
+
+	// llmPromptVersion is part of the cache key; bump it when the prompt changes
+	llmPromptVersion = "1"
+)
+
+// llmSystemPrompt instructs the model to answer with a bare confidence
+const llmSystemPrompt = "You decide whether a skill or agent should be used to handle a user's request. " +
+	"Reply with a single integer from 0 to 100: the confidence that it is relevant."
+
+// llmScoreGrammar constrains generation to an integer between 0 and 100
+const llmScoreGrammar = `root ::= "100" | [1-9] [0-9] | [0-9]`
+
+// LlamaScorer rates items against a prompt using a generative GGUF model
+type LlamaScorer struct {
+	model       llama.Model
+	lctx        llama.Context
+	vocab       llama.Vocab
+	template    string
+	file        string
+	fingerprint string // identifies the model in cache keys
+}
+
+// NewLlamaScorer loads a generative model; InitLlama must have been called
+func NewLlamaScorer(modelPath string) (*LlamaScorer, error) {
+	model := llama.ModelLoadFromFile(modelPath, llama.ModelDefaultParams())
+	if model == 0 {
+		return nil, fmt.Errorf("failed to load LLM from %s", modelPath)
+	}
+
+	ctxParams := llama.ContextDefaultParams()
+	ctxParams.NCtx = llmContextSize
+	ctxParams.NBatch = llmContextSize // The whole prompt is decoded in one batch
+
+	lctx := llama.InitFromModel(model, ctxParams)
+	if lctx == 0 {
+		llama.ModelFree(model)
+		return nil, fmt.Errorf("failed to create LLM context")
+	}
+
+	template := llama.ModelChatTemplate(model, "")
+	if template == "" {
+		template = "chatml"
+	}
+
+	// Two models sharing a file name must not share cached confidences
+	fingerprint, err := fileFingerprint(modelPath)
+	if err != nil {
+		llama.Free(lctx)
+		llama.ModelFree(model)
+		return nil, err
+	}
+
+	return &LlamaScorer{
+		model:       model,
+		lctx:        lctx,
+		vocab:       llama.ModelGetVocab(model),
+		template:    template,
+		file:        filepath.Base(modelPath),
+		fingerprint: fingerprint,
+	}, nil
+}
+
+// File returns the GGUF file name of the model
+func (s *LlamaScorer) File() string {
+	return s.file
+}
+
+// Fingerprint identifies the model file in LLM cache keys
+func (s *LlamaScorer) Fingerprint() string {
+	return s.fingerprint
+}
+
+// Description returns llama.cpp's model description (architecture, size, quantization)
+func (s *LlamaScorer) Description() string {
+	return llama.ModelDesc(s.model)
+}
+
+// Close releases the LLM context and model
+func (s *LlamaScorer) Close() {
+	llama.Free(s.lctx)
+	llama.ModelFree(s.model)
+}
+
+// uncachedError accompanies a valid confidence whose LLM response could not
+// be cached
+type uncachedError struct {
+	item string
+	err  error
+}
+
+func (e *uncachedError) Error() string {
+	return fmt.Sprintf("failed to cache LLM response for %s: %v", e.item, e.err)
+}
+
+func (e *uncachedError) Unwrap() error {
+	return e.err
+}
+
+// Score implements Scorer with the LLM's confidence that item is relevant to
+// prompt. A response that cannot be cached still yields the confidence,
+// together with an *uncachedError.
+func (s *LlamaScorer) Score(ctx context.Context, prompt string, item Item) (float32, error) {
+	itemText := llmItemText(item.Content)
+	prompt = llmPromptText(prompt)
+	key := strings.Join([]string{s.fingerprint, llmPromptVersion, prompt, item.Name, itemText}, "\x00")
+
+	// Try to load from cache first
+	model := cacheModel{id: s.fingerprint, label: s.file + " (" + s.fingerprint + ")"}
+	response, cached := loadCachedLLMResponse(model, key)
+	var cacheErr error
+	if !cached {
+		var err error
+		response, err = s.generate(ctx, buildLLMPrompt(prompt, item, itemText))
+		if err != nil {
+			return 0, err
+		}
+
+		// Save to cache for next time
+		cacheErr = saveCachedLLMResponse(model, key, response)
+	}
+
+	confidence, err := parseLLMScore(response)
+	if err == nil && cacheErr != nil {
+		err = &uncachedError{item: item.Name, err: cacheErr}
+	}
+	return confidence, err
+}
+
+// generate runs the chat-formatted request through the model with the
+// confidence grammar applied and returns the raw response
+func (s *LlamaScorer) generate(ctx context.Context, userMessage string) (string, error) {
+	messages := []llama.ChatMessage{
+		llama.NewChatMessage("system", llmSystemPrompt),
+		llama.NewChatMessage("user", userMessage),
+	}
+
+	buf := make([]byte, 8192)
+	n := llama.ChatApplyTemplate(s.template, messages, true, buf)
+	if n < 0 {
+		return "", fmt.Errorf("failed to apply chat template")
+	}
+	if int(n) > len(buf) {
+		buf = make([]byte, n)
+		n = llama.ChatApplyTemplate(s.template, messages, true, buf)
+	}
+	text := string(buf[:n])
+
+	// Tokenize
+	count := llama.Tokenize(s.vocab, text, nil, true, true)
+	if count <= 0 {
+		return "", fmt.Errorf("tokenization returned no tokens")
+	}
+	if int(count)+llmMaxResponseTokens > llmContextSize {
+		return "", fmt.Errorf("LLM prompt too long (%d tokens)", count)
+	}
+	tokens := make([]llama.Token, count)
+	llama.Tokenize(s.vocab, text, tokens, true, true)
+
+	// Every item is judged independently
+	if mem := llama.GetMemory(s.lctx); mem != 0 {
+		llama.MemoryClear(mem, true)
+	}
+
+	sampler := llama.SamplerChainInit(llama.SamplerChainDefaultParams())
+	defer llama.SamplerFree(sampler)
+	llama.SamplerChainAdd(sampler, llama.SamplerInitGrammar(s.vocab, llmScoreGrammar, "root"))
+	llama.SamplerChainAdd(sampler, llama.SamplerInitGreedy())
+
+	var response strings.Builder
+	batch := llama.BatchGetOne(tokens)
+	for i := 0; i < llmMaxResponseTokens; i++ {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		if llama.Decode(s.lctx, batch) != 0 {
+			return "", fmt.Errorf("decode failed")
+		}
+
+		token := llama.SamplerSample(sampler, s.lctx, -1)
+		if llama.VocabIsEOG(s.vocab, token) {
+			break
+		}
+
+		piece := make([]byte, 32)
+		l := llama.TokenToPiece(s.vocab, token, piece, 0, false)
+		response.Write(piece[:l])
+
+		batch = llama.BatchGetOne([]llama.Token{token})
+	}
+
+	return response.String(), nil
+}
+
+// llmItemText prepares item content for the LLM. Unlike preprocessText it
+// keeps stop words, since the LLM reads sentences rather than bags of words.
+func llmItemText(content string) string {
+	text := strings.TrimSpace(normalizeWhitespace(stripFrontmatter(content)))
+	return truncateText(text, llmMaxItemChars)
+}
+
+// llmPromptText bounds the user's prompt for the LLM. Without the bound a
+// long prompt would overflow the context for every item.
+func llmPromptText(prompt string) string {
+	return truncateText(strings.TrimSpace(prompt), llmMaxPromptChars)
+}
+
+// truncateText cuts text to at most max bytes on a rune boundary, so the
+// LLM prompt stays valid UTF-8
+func truncateText(text string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+	n := max
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	return text[:n]
+}
+
+// buildLLMPrompt builds the user message asking for a confidence score
+func buildLLMPrompt(prompt string, item Item, itemText string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "User request: %s\n\n", prompt)
+	fmt.Fprintf(&b, "Candidate %s: %s\n", item.Type, item.Name)
+	fmt.Fprintf(&b, "Description: %s\n\n", itemText)
+	b.WriteString("How confident are you (0-100) that this candidate should be used for the request?")
+	return b.String()
+}
+
+// llmScorePattern finds the first number in an LLM response
+var llmScorePattern = regexp.MustCompile(`\d+(\.\d+)?`)
+
+// parseLLMScore extracts a confidence from an LLM response. Integers are
+// read as percentages and fractions up to 1 as-is; the result is clamped
+// to 0.0-1.0.
+func parseLLMScore(response string) (float32, error) {
+	match := llmScorePattern.FindString(response)
+	if match == "" {
+		return 0, fmt.Errorf("no confidence score in LLM response %q", response)
+	}
+
+	value, err := strconv.ParseFloat(match, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid confidence score %q: %w", match, err)
+	}
+
+	if strings.Contains(match, ".") && value <= 1 {
+		return float32(value), nil
+	}
+
+	value /= 100
+	if value > 1 {
+		value = 1
+	}
+	return float32(value), nil
+}
+
+// loadCachedLLMResponse loads an LLM response from cache if it exists
+func loadCachedLLMResponse(model cacheModel, key string) (string, bool) {
+	path := getCacheFile(HashContent(key), CacheLLM, model)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	touchCacheFile(path)
+	return string(data), true
+}
+
+// saveCachedLLMResponse saves an LLM response to cache
+func saveCachedLLMResponse(model cacheModel, key string, response string) error {
+	return writeCacheFile(getCacheFile(HashContent(key), CacheLLM, model), model, []byte(response))
+}
@@ -0,0 +1,129 @@
+package classifier
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestParseLLMScore(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		expected float32
+		wantErr  bool
+	}{
+		{name: "percentage", response: "87", expected: 0.87},
+		{name: "zero", response: "0", expected: 0},
+		{name: "hundred", response: "100", expected: 1},
+		{name: "surrounding text", response: "Confidence: 42%", expected: 0.42},
+		{name: "fraction", response: "0.75", expected: 0.75},
+		{name: "clamped", response: "250", expected: 1},
+		{name: "no number", response: "yes", wantErr: true},
+		{name: "empty", response: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseLLMScore(tt.response)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseLLMScore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			diff := result - tt.expected
+			if diff < -0.001 || diff > 0.001 {
+				t.Errorf("parseLLMScore() = %v, expected %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLLMItemText(t *testing.T) {
+	result := llmItemText("---\nname: python-expert\n---\nExpert   Python\n\nassistance for the web")
+	if result != "Expert Python assistance for the web" {
+		t.Errorf("llmItemText() = %q", result)
+	}
+
+	long := llmItemText("---\nname: x\n---\n" + strings.Repeat("word ", 1000))
+	if len(long) != llmMaxItemChars {
+		t.Errorf("expected truncation to %d chars, got %d", llmMaxItemChars, len(long))
+	}
+
+	// A multi-byte rune straddling the limit is dropped, not split
+	multi := llmItemText(strings.Repeat("a", llmMaxItemChars-1) + "é and more")
+	if !utf8.ValidString(multi) || len(multi) != llmMaxItemChars-1 {
+		t.Errorf("expected valid UTF-8 cut before the rune, got %d bytes ending in %q", len(multi), multi[len(multi)-3:])
+	}
+}
+
+func TestLLMPromptText(t *testing.T) {
+	if got := llmPromptText("  review my django app\n"); got != "review my django app" {
+		t.Errorf("llmPromptText() = %q", got)
+	}
+
+	long := llmPromptText(strings.Repeat("ü", llmMaxPromptChars))
+	if !utf8.ValidString(long) || len(long) != llmMaxPromptChars {
+		t.Errorf("expected a valid UTF-8 cut to %d bytes, got %d", llmMaxPromptChars, len(long))
+	}
+}
+
+func TestBuildLLMPrompt(t *testing.T) {
+	item := Item{Name: "python-expert", Type: "skill"}
+	result := buildLLMPrompt("review my django app", item, "Expert Python assistance")
+
+	for _, want := range []string{"review my django app", "skill: python-expert", "Expert Python assistance", "0-100"} {
+		if !strings.Contains(result, want) {
+			t.Errorf("expected prompt to contain %q, got %q", want, result)
+		}
+	}
+}
+
+func TestLLMResponseCache(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	model := cacheModel{id: "model.gguf", label: "model.gguf"}
+	key := "model\x001\x00prompt\x00item\x00text"
+	if _, found := loadCachedLLMResponse(model, key); found {
+		t.Fatal("expected empty cache")
+	}
+
+	if err := saveCachedLLMResponse(model, key, "64"); err != nil {
+		t.Fatalf("saveCachedLLMResponse() error = %v", err)
+	}
+
+	response, found := loadCachedLLMResponse(model, key)
+	if !found {
+		t.Fatal("expected to find cached response")
+	}
+	if response != "64" {
+		t.Errorf("response = %q, expected %q", response, "64")
+	}
+}
+
+func TestFileFingerprint(t *testing.T) {
+	// Same file name, different models
+	a := filepath.Join(t.TempDir(), "model.gguf")
+	b := filepath.Join(t.TempDir(), "model.gguf")
+	if err := os.WriteFile(a, []byte("GGUF model a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte("GGUF model b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fa, err := fileFingerprint(a)
+	if err != nil {
+		t.Fatalf("fileFingerprint() error = %v", err)
+	}
+	fb, err := fileFingerprint(b)
+	if err != nil {
+		t.Fatalf("fileFingerprint() error = %v", err)
+	}
+	if fa == fb || !strings.HasPrefix(fa, "gguf=") || !strings.HasSuffix(fa, " size=12") {
+		t.Errorf("fingerprints %q and %q, expected distinct gguf=<hash> size=12", fa, fb)
+	}
+	if _, err := fileFingerprint(filepath.Join(t.TempDir(), "missing.gguf")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,41 @@
+//go:build !windows
+
+package classifier
+
+import (
+	"os"
+	"syscall"
+)
+
+// FileLock is an exclusive advisory lock shared by all processes using the
+// same lock file
+type FileLock struct {
+	file *os.File
+}
+
+// LockFile blocks until it holds the lock on path, creating the file if
+// needed. The kernel releases the lock if the process dies.
+func LockFile(path string) (*FileLock, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &FileLock{file: file}, nil
+}
+
+// Unlock releases the lock. The lock file is kept: removing it would let a
+// waiter lock a file that a newcomer no longer sees.
+func (l *FileLock) Unlock() error {
+	syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+	return l.file.Close()
+}
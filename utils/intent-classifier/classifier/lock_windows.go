@@ -0,0 +1,37 @@
+//go:build windows
+
+package classifier
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// FileLock is an exclusive lock shared by all processes using the same
+// lock file
+type FileLock struct {
+	file *os.File
+}
+
+// LockFile blocks until it holds the lock on path, creating the file if
+// needed. Windows releases the lock if the process dies.
+func LockFile(path string) (*FileLock, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	// Lock the first byte; the lock is mandatory but nothing reads the file
+	if err := windows.LockFileEx(windows.Handle(file.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, new(windows.Overlapped)); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &FileLock{file: file}, nil
+}
+
+// Unlock releases the lock. The lock file is kept: removing it would let a
+// waiter lock a file that a newcomer no longer sees.
+func (l *FileLock) Unlock() error {
+	windows.UnlockFileEx(windows.Handle(l.file.Fd()), 0, 1, 0, new(windows.Overlapped))
+	return l.file.Close()
+}
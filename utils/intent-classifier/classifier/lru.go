@@ -0,0 +1,63 @@
+package classifier
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lru is a map bounded to max entries that evicts the least recently used
+// one when full. It is safe for concurrent use.
+type lru[V any] struct {
+	mu      sync.Mutex
+	max     int
+	order   *list.List // of *lruEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+// lruEntry is a key and its value in lru.order
+type lruEntry[V any] struct {
+	key   string
+	value V
+}
+
+// newLRU creates an empty lru holding at most max entries
+func newLRU[V any](max int) *lru[V] {
+	return &lru[V]{max: max, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// get returns the value for key and marks it used
+func (l *lru[V]) get(key string) (V, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if elem, ok := l.entries[key]; ok {
+		l.order.MoveToFront(elem)
+		return elem.Value.(*lruEntry[V]).value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// put stores value for key, evicting the least recently used entry if the
+// lru is full
+func (l *lru[V]) put(key string, value V) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if elem, ok := l.entries[key]; ok {
+		elem.Value.(*lruEntry[V]).value = value
+		l.order.MoveToFront(elem)
+		return
+	}
+	l.entries[key] = l.order.PushFront(&lruEntry[V]{key: key, value: value})
+	if l.order.Len() > l.max {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.entries, oldest.Value.(*lruEntry[V]).key)
+	}
+}
+
+// len returns the number of entries
+func (l *lru[V]) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.order.Len()
+}
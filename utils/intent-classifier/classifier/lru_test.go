@@ -0,0 +1,26 @@
+package classifier
+
+import "testing"
+
+func TestLRU(t *testing.T) {
+	l := newLRU[int](2)
+	l.put("a", 1)
+	l.put("b", 2)
+	if _, ok := l.get("a"); !ok {
+		t.Fatal("expected a to be resident")
+	}
+
+	// b is now the least recently used
+	l.put("c", 3)
+	if _, ok := l.get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	if v, ok := l.get("a"); !ok || v != 1 {
+		t.Errorf("get(a) = %v, %v, expected 1", v, ok)
+	}
+
+	l.put("c", 4)
+	if v, _ := l.get("c"); v != 4 || l.len() != 2 {
+		t.Errorf("get(c) = %v with %d entries, expected 4 with 2", v, l.len())
+	}
+}
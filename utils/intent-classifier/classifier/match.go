@@ -0,0 +1,386 @@
+package classifier
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// itemTexts holds the preprocessed texts an item is embedded as
+type itemTexts struct {
+	chunks   []string // body chunks
+	length   int      // characters of the preprocessed body before chunking
+	examples []string // example prompts, each an anchor of its own
+	raw      []string // the examples as written, for explanations
+
+	negatives    []string // not_for prompts, anchors that suppress the item
+	rawNegatives []string
+}
+
+// itemScore records how similar an item is to the prompt
+type itemScore struct {
+	similarity   float32 // max of body and best example
+	body         float32 // chunk similarities aggregated
+	chunk        int     // index of the most similar chunk
+	chunks       int
+	chunkScore   float32
+	chunkText    string
+	example      int // index of the most similar example, -1 without examples
+	exampleScore float32
+
+	negative      int // index of the most similar negative, -1 without negatives
+	negativeScore float32
+}
+
+// suppressed reports whether the prompt is at least as close to a negative
+// anchor as to the item itself
+func (s itemScore) suppressed() bool {
+	return s.negative >= 0 && s.negativeScore >= s.similarity
+}
+
+// newItemTexts preprocesses and chunks the body of item and its examples
+func newItemTexts(item Item, chunking ChunkOptions, tokenizer Tokenizer) (itemTexts, error) {
+	var texts itemTexts
+
+	// Preprocess text before embedding (removes stop words, whitespace, frontmatter)
+	body := preprocessText(strings.ToLower(item.Content))
+	chunks, err := chunkText(body, chunking, tokenizer)
+	if err != nil {
+		return texts, err
+	}
+	texts.chunks = chunks
+	texts.length = utf8.RuneCountInString(body)
+
+	// Examples are short prompts, so they are preprocessed like the prompt
+	for _, example := range item.Metadata.Examples {
+		processed := preprocessText(strings.ToLower(example))
+		if processed == "" {
+			continue
+		}
+		texts.examples = append(texts.examples, processed)
+		texts.raw = append(texts.raw, example)
+	}
+
+	negatives := append(append([]string(nil), item.Metadata.NotFor...), item.Metadata.NegativeExamples...)
+	for _, negative := range negatives {
+		processed := preprocessText(strings.ToLower(negative))
+		if processed == "" {
+			continue
+		}
+		texts.negatives = append(texts.negatives, processed)
+		texts.rawNegatives = append(texts.rawNegatives, negative)
+	}
+	return texts, nil
+}
+
+// all returns every text to embed
+func (t itemTexts) all() []string {
+	all := append(append([]string(nil), t.chunks...), t.examples...)
+	return append(all, t.negatives...)
+}
+
+// truncated reports whether the embedder cuts any of the texts short. It
+// is false when the embedder cannot count or does not limit tokens.
+func (t itemTexts) truncated(embedder Embedder) bool {
+	tokenizer, ok := embedder.(Tokenizer)
+	limiter, limited := embedder.(TokenLimiter)
+	if !ok || !limited {
+		return false
+	}
+	for _, text := range t.all() {
+		if count, err := tokenizer.CountTokens(text); err == nil && count > limiter.MaxTokens() {
+			return true
+		}
+	}
+	return false
+}
+
+// textsKey identifies the texts of item under chunking
+func textsKey(item Item, chunking ChunkOptions) string {
+	parts := []string{fmt.Sprintf("%d/%d", chunking.Size, chunking.Overlap), item.Content}
+	parts = append(parts, item.Metadata.Examples...)
+	parts = append(parts, "")
+	parts = append(parts, item.Metadata.NotFor...)
+	parts = append(parts, item.Metadata.NegativeExamples...)
+	return HashContent(strings.Join(parts, "\x00"))
+}
+
+// memoMaxTexts bounds the item texts kept in memory; evicted texts are
+// preprocessed again when next needed
+const memoMaxTexts = 5000
+
+// textsMemo holds preprocessed item texts in memory, keyed by textsKey
+type textsMemo struct {
+	texts *lru[itemTexts]
+}
+
+// newTextsMemo creates an empty in-memory text store
+func newTextsMemo() *textsMemo {
+	return &textsMemo{texts: newLRU[itemTexts](memoMaxTexts)}
+}
+
+// get returns the resident texts for key; a nil memo never hits
+func (m *textsMemo) get(key string) (itemTexts, bool) {
+	if m == nil {
+		return itemTexts{}, false
+	}
+	return m.texts.get(key)
+}
+
+// put stores the texts for key; a nil memo discards them
+func (m *textsMemo) put(key string, texts itemTexts) {
+	if m == nil {
+		return
+	}
+	m.texts.put(key, texts)
+}
+
+// itemTexts returns the texts of item, preprocessing it only once
+func (c *Classifier) itemTexts(item Item, chunking ChunkOptions, tokenizer Tokenizer) (itemTexts, error) {
+	key := textsKey(item, chunking)
+	if texts, ok := c.texts.get(key); ok {
+		return texts, nil
+	}
+	texts, err := newItemTexts(item, chunking, tokenizer)
+	if err != nil {
+		return texts, err
+	}
+	c.texts.put(key, texts)
+	return texts, nil
+}
+
+// lookupEmbeddings fills embeddings with the resident or cached embedding of
+// each text and returns the texts that still need to be embedded. Cached
+// embeddings must have dim dimensions unless dim is 0.
+func (c *Classifier) lookupEmbeddings(texts []string, dim int, embeddings map[string][]float32) []string {
+	var missing []string
+	for _, text := range texts {
+		if _, seen := embeddings[text]; seen {
+			continue
+		}
+		if embedding, cached := c.memo.get(text); cached {
+			embeddings[text] = embedding
+		} else if embedding, cached := loadCachedEmbedding(c.cache, embeddingCacheKey(c.fingerprint, text), dim); cached {
+			embeddings[text] = embedding
+			c.memo.put(text, embedding)
+		} else {
+			embeddings[text] = nil
+			missing = append(missing, text)
+		}
+	}
+	return missing
+}
+
+// matchItems computes similarity between prompt and item contents. Long
+// items are split into chunks and scored by aggregating the chunk
+// similarities; example prompts from the frontmatter are anchors that can
+// raise the score to their own similarity. Items whose not_for anchors are
+// at least as similar to the prompt as the item itself are suppressed.
+// Each item must reach its own threshold, resolved from thresholds with
+// threshold as the fallback. With explainAll, items below it are explained
+// too. Items that could not be embedded are reported as diagnostics.
+func (c *Classifier) matchItems(ctx context.Context, promptEmbed []float32, items []Item, threshold float32, thresholds Thresholds, chunking ChunkOptions, explain, explainAll bool) ([]Match, []Explanation, []Diagnostic, error) {
+	tokenizer, _ := c.embedder.(Tokenizer)
+
+	texts := make([]itemTexts, len(items))
+	embeddings := make(map[string][]float32)
+	var missing []string
+	embedded := make(map[string]bool) // texts embedded by this call rather than cached
+	for i, item := range items {
+		var err error
+		texts[i], err = c.itemTexts(item, chunking, tokenizer)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to chunk %s: %w", item.Name, err)
+		}
+
+		// Try resident embeddings first, then the on-disk cache
+		missing = append(missing, c.lookupEmbeddings(texts[i].all(), len(promptEmbed), embeddings)...)
+	}
+	for _, text := range missing {
+		embedded[text] = true
+	}
+
+	// Embed everything that is not cached in one batch
+	diagnostics, err := c.embedMissing(ctx, missing, embeddings)
+	if err != nil {
+		return nil, nil, diagnostics, err
+	}
+
+	var matches []Match
+	var explanations []Explanation
+	for i, item := range items {
+		score, ok := scoreItem(promptEmbed, texts[i], embeddings, chunking)
+		if !ok {
+			diagnostics = append(diagnostics, Diagnostic{Path: item.Path, Message: "failed to embed"})
+			continue
+		}
+		itemThreshold, source := thresholds.resolve(item, threshold)
+		below := score.similarity < itemThreshold
+		if below && !explainAll {
+			continue
+		}
+
+		suppressed := score.suppressed()
+		if !below && !suppressed {
+			matches = append(matches, Match{
+				Name:       item.Name,
+				Path:       item.Path,
+				Similarity: score.similarity,
+				Priority:   item.Priority,
+				Type:       item.Type,
+				Threshold:  itemThreshold,
+			})
+		}
+		if explain {
+			explanation := Explanation{
+				Name:       item.Name,
+				Path:       item.Path,
+				Similarity: score.similarity,
+				BodyScore:  score.body,
+				Aggregate:  chunking.Aggregate,
+				Chunk:      score.chunk,
+				Chunks:     score.chunks,
+				ChunkScore: score.chunkScore,
+				ChunkText:  score.chunkText,
+
+				Threshold:       itemThreshold,
+				ThresholdSource: source,
+
+				Winner:     WinnerBody,
+				TextLength: texts[i].length,
+				Truncated:  texts[i].truncated(c.embedder),
+				Cached:     true,
+			}
+			if score.example >= 0 {
+				explanation.Example = texts[i].raw[score.example]
+				explanation.ExampleScore = score.exampleScore
+				if score.chunks == 0 || score.exampleScore > score.body {
+					explanation.Winner = WinnerExample
+				}
+			}
+			for _, text := range texts[i].all() {
+				if embedded[text] {
+					explanation.Cached = false
+				}
+			}
+			if score.negative >= 0 {
+				explanation.NegativeExample = texts[i].rawNegatives[score.negative]
+				explanation.NegativeScore = score.negativeScore
+				explanation.Suppressed = suppressed
+			}
+			explanations = append(explanations, explanation)
+		}
+	}
+
+	return matches, explanations, diagnostics, nil
+}
+
+// scoreItem compares the prompt with an item's chunks and examples. ok is
+// false when none of them could be embedded.
+func scoreItem(promptEmbed []float32, texts itemTexts, embeddings map[string][]float32, chunking ChunkOptions) (score itemScore, ok bool) {
+	score.example = -1
+	score.negative = -1
+
+	// Compute cosine similarity per chunk
+	var scores []float32
+	var scored []string
+	for _, chunk := range texts.chunks {
+		if embeddings[chunk] == nil {
+			continue // Failed to embed, reported once per item
+		}
+		scores = append(scores, cosineSimilarity(promptEmbed, embeddings[chunk]))
+		scored = append(scored, chunk)
+	}
+	if len(scores) > 0 {
+		score.body, score.chunk = aggregateScores(scores, chunking)
+		score.chunks = len(scores)
+		score.chunkScore = scores[score.chunk]
+		score.chunkText = scored[score.chunk]
+		score.similarity = score.body
+		ok = true
+	}
+
+	// The best example anchor wins if it beats the body
+	for i, example := range texts.examples {
+		if embeddings[example] == nil {
+			continue
+		}
+		similarity := cosineSimilarity(promptEmbed, embeddings[example])
+		if score.example == -1 || similarity > score.exampleScore {
+			score.example = i
+			score.exampleScore = similarity
+		}
+		if !ok || similarity > score.similarity {
+			score.similarity = similarity
+		}
+		ok = true
+	}
+
+	for i, negative := range texts.negatives {
+		if embeddings[negative] == nil {
+			continue
+		}
+		similarity := cosineSimilarity(promptEmbed, embeddings[negative])
+		if score.negative == -1 || similarity > score.negativeScore {
+			score.negative = i
+			score.negativeScore = similarity
+		}
+	}
+
+	return score, ok
+}
+
+// embedMissing embeds the texts in missing into embeddings. When the batch
+// fails the texts are retried one by one, so a single bad text only costs
+// its own chunk. Embeddings that could not be cached are reported as a
+// diagnostic.
+func (c *Classifier) embedMissing(ctx context.Context, missing []string, embeddings map[string][]float32) ([]Diagnostic, error) {
+	if len(missing) == 0 {
+		return nil, nil
+	}
+
+	vecs, err := c.embedder.Embed(ctx, missing)
+	if err == nil && len(vecs) != len(missing) {
+		err = fmt.Errorf("embedder returned %d embeddings for %d texts", len(vecs), len(missing))
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		vecs = make([][]float32, len(missing))
+		for i := range missing {
+			one, err := c.embedder.Embed(ctx, missing[i:i+1])
+			if err == nil && len(one) != 1 {
+				err = fmt.Errorf("embedder returned %d embeddings for 1 text", len(one))
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				continue // Items left without any embedding are reported by matchItems
+			}
+			vecs[i] = one[0]
+		}
+	}
+
+	var uncached int
+	var cacheErr error
+	for i, text := range missing {
+		if vecs[i] == nil {
+			continue
+		}
+		embeddings[text] = vecs[i]
+		c.memo.put(text, vecs[i])
+
+		// Save to cache for next time
+		if err := saveCachedEmbedding(c.cache, embeddingCacheKey(c.fingerprint, text), vecs[i]); err != nil {
+			uncached++
+			cacheErr = err
+		}
+	}
+	if uncached > 0 {
+		return []Diagnostic{{Message: fmt.Sprintf("failed to cache %d embeddings: %v", uncached, cacheErr)}}, nil
+	}
+	return nil, nil
+}
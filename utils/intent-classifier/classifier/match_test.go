@@ -0,0 +1,445 @@
+package classifier
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+// fakeEmbedder embeds texts as normalized bags of words over a fixed vocabulary
+type fakeEmbedder struct {
+	vocab       []string
+	calls       [][]string
+	failOn      string // texts containing this word fail to embed
+	fingerprint string
+}
+
+func (f *fakeEmbedder) Fingerprint() string {
+	return f.fingerprint
+}
+
+func (f *fakeEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.calls = append(f.calls, texts)
+
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		if f.failOn != "" && strings.Contains(text, f.failOn) {
+			return nil, errors.New("cannot embed " + f.failOn)
+		}
+
+		vec := make([]float32, len(f.vocab))
+		var sum float64
+		for j, word := range f.vocab {
+			vec[j] = float32(strings.Count(text, word))
+			sum += float64(vec[j] * vec[j])
+		}
+		if sum > 0 {
+			for j := range vec {
+				vec[j] /= float32(math.Sqrt(sum))
+			}
+		}
+		embeddings[i] = vec
+	}
+	return embeddings, nil
+}
+
+// fakeScorer returns a fixed confidence per item name
+type fakeScorer struct {
+	scores map[string]float32
+	scored []string
+}
+
+func (f *fakeScorer) Score(ctx context.Context, prompt string, item Item) (float32, error) {
+	f.scored = append(f.scored, item.Name)
+	return f.scores[item.Name], nil
+}
+
+var fakeItems = []Item{
+	{Name: "python-expert", Path: "/skills/python.md", Content: "---\nname: python-expert\n---\nPython django flask", Priority: "high", Type: "skill"},
+	{Name: "go-expert", Path: "/skills/go.md", Content: "---\nname: go-expert\n---\nGo goroutines channels", Priority: "medium", Type: "skill"},
+	{Name: "reviewer", Path: "/agents/reviewer.md", Content: "---\nname: reviewer\n---\nReview python and go code", Priority: "low", Type: "agent"},
+}
+
+func newFakeEmbedder() *fakeEmbedder {
+	return &fakeEmbedder{vocab: []string{"python", "django", "goroutines", "review"}}
+}
+
+func matchNames(matches []Match) []string {
+	var names []string
+	for _, match := range matches {
+		names = append(names, match.Name)
+	}
+	return names
+}
+
+func TestClassifyEmbedding(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	tests := []struct {
+		name      string
+		prompt    string
+		threshold float32
+		expected  []string
+	}{
+		{name: "single match", prompt: "python django app", threshold: 0.9, expected: []string{"python-expert"}},
+		{name: "lower threshold", prompt: "python django app", threshold: 0.4, expected: []string{"python-expert", "reviewer"}},
+		{name: "no match", prompt: "bake bread", threshold: 0.1, expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(newFakeEmbedder(), nil)
+			result, err := c.Classify(context.Background(), Request{Prompt: tt.prompt, Threshold: tt.threshold}, fakeItems)
+			if err != nil {
+				t.Fatalf("Classify() error = %v", err)
+			}
+			if got := strings.Join(matchNames(result.Matches), ","); got != strings.Join(tt.expected, ",") {
+				t.Errorf("Classify() matches = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestClassifyBatchesAndMemoizes(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	embedder := newFakeEmbedder()
+	c := New(embedder, nil)
+	req := Request{Prompt: "python", Threshold: 0.5}
+
+	if _, err := c.Classify(context.Background(), req, fakeItems); err != nil {
+		t.Fatalf("Classify() error = %v", err)
+	}
+	// One call for the prompt, one batch for every item
+	if len(embedder.calls) != 2 || len(embedder.calls[1]) != len(fakeItems) {
+		t.Fatalf("expected prompt call and one batch of %d, got %v", len(fakeItems), embedder.calls)
+	}
+
+	if _, err := c.Classify(context.Background(), req, fakeItems); err != nil {
+		t.Fatalf("Classify() error = %v", err)
+	}
+	// Item embeddings are resident now, only the prompt is embedded again
+	if len(embedder.calls) != 3 || len(embedder.calls[2]) != 1 {
+		t.Errorf("expected only the prompt to be embedded, got %v", embedder.calls[2:])
+	}
+}
+
+func TestClassifySkipsItemsThatFailToEmbed(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	embedder := newFakeEmbedder()
+	embedder.failOn = "goroutines"
+	c := New(embedder, nil)
+
+	result, err := c.Classify(context.Background(), Request{Prompt: "python review", Threshold: 0}, fakeItems)
+	if err != nil {
+		t.Fatalf("Classify() error = %v", err)
+	}
+	if got := strings.Join(matchNames(result.Matches), ","); got != "reviewer,python-expert" {
+		t.Errorf("Classify() matches = %v, expected the items that could be embedded", got)
+	}
+	if len(result.Diagnostics) != 1 || result.Diagnostics[0].Path != "/skills/go.md" {
+		t.Errorf("Classify() diagnostics = %v, expected go-expert to be reported", result.Diagnostics)
+	}
+}
+
+func TestClassifyHybrid(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	scorer := &fakeScorer{scores: map[string]float32{"python-expert": 0.9, "reviewer": 0.2, "go-expert": 0.8}}
+	c := New(newFakeEmbedder(), scorer)
+
+	result, err := c.Classify(context.Background(), Request{
+		Prompt:       "python django review",
+		Mode:         ModeHybrid,
+		Threshold:    0.1,
+		LLMThreshold: 0.5,
+		Shortlist:    2,
+	}, fakeItems)
+	if err != nil {
+		t.Fatalf("Classify() error = %v", err)
+	}
+
+	// go-expert is not similar enough to be shortlisted
+	if got := strings.Join(scorer.scored, ","); got != "python-expert,reviewer" {
+		t.Errorf("scored %v, expected the shortlist only", got)
+	}
+	if len(result.Matches) != 1 || result.Matches[0].Name != "python-expert" || result.Matches[0].Similarity != 0.9 {
+		t.Errorf("Classify() matches = %+v", result.Matches)
+	}
+}
+
+func TestClassifyErrors(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	t.Run("llm mode without scorer", func(t *testing.T) {
+		c := New(newFakeEmbedder(), nil)
+		if _, err := c.Classify(context.Background(), Request{Prompt: "x", Mode: ModeLLM}, fakeItems); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("invalid mode", func(t *testing.T) {
+		c := New(newFakeEmbedder(), nil)
+		if _, err := c.Classify(context.Background(), Request{Prompt: "x", Mode: "deep"}, fakeItems); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		c := New(newFakeEmbedder(), nil)
+		if _, err := c.Classify(ctx, Request{Prompt: "python"}, fakeItems); !errors.Is(err, context.Canceled) {
+			t.Errorf("Classify() error = %v, expected context.Canceled", err)
+		}
+	})
+}
+
+func TestClassifyExplainAll(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	c := New(newFakeEmbedder(), nil)
+	result, err := c.Classify(context.Background(), Request{Prompt: "python django app", Threshold: 0.9, ExplainAll: true}, fakeItems)
+	if err != nil {
+		t.Fatalf("Classify() error = %v", err)
+	}
+	if got := strings.Join(matchNames(result.Matches), ","); got != "python-expert" {
+		t.Errorf("matches = %v, expected only python-expert", got)
+	}
+	if len(result.Explanations) != len(fakeItems) {
+		t.Fatalf("expected every item to be explained, got %+v", result.Explanations)
+	}
+	for _, e := range result.Explanations[1:] {
+		if e.Similarity >= e.Threshold {
+			t.Errorf("%s: expected a score below its threshold, got %.3f >= %.3f", e.Name, e.Similarity, e.Threshold)
+		}
+	}
+}
+
+// limitedEmbedder counts words as tokens and keeps at most max of them
+type limitedEmbedder struct {
+	*fakeEmbedder
+	max int
+}
+
+func (l limitedEmbedder) CountTokens(text string) (int, error) {
+	return len(strings.Fields(text)), nil
+}
+
+func (l limitedEmbedder) MaxTokens() int {
+	return l.max
+}
+
+func TestClassifyExplainDetails(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	items := []Item{fakeItems[0], {
+		Name:     "django-guide",
+		Path:     "/skills/django.md",
+		Content:  "---\nname: django-guide\n---\nSettings and views",
+		Type:     "skill",
+		Metadata: Metadata{Examples: StringList{"django please"}},
+	}}
+	// The embedder keeps two words: the example fits, python-expert's body does not
+	c := New(limitedEmbedder{newFakeEmbedder(), 2}, nil)
+	req := Request{Prompt: "The Django app", Threshold: 0.5, ExplainAll: true, Chunking: ChunkOptions{Size: 4}}
+
+	result, err := c.Classify(context.Background(), req, items)
+	if err != nil {
+		t.Fatalf("Classify() error = %v", err)
+	}
+	if result.Prompt != "django app" {
+		t.Errorf("prompt = %q, expected the preprocessed prompt", result.Prompt)
+	}
+	explained := map[string]Explanation{}
+	for _, e := range result.Explanations {
+		explained[e.Name] = e
+		if e.Cached {
+			t.Errorf("%s: expected freshly embedded vectors, got cached", e.Name)
+		}
+	}
+	python, django := explained["python-expert"], explained["django-guide"]
+	if python.Winner != WinnerBody || python.TextLength != len("python django flask") || !python.Truncated {
+		t.Errorf("unexpected python-expert explanation %+v", python)
+	}
+	if django.Winner != WinnerExample || django.Truncated {
+		t.Errorf("unexpected django-guide explanation %+v", django)
+	}
+
+	result, err = c.Classify(context.Background(), req, items)
+	if err != nil {
+		t.Fatalf("Classify() error = %v", err)
+	}
+	for _, e := range result.Explanations {
+		if !e.Cached {
+			t.Errorf("%s: expected vectors from the cache the second time", e.Name)
+		}
+	}
+
+	req.ExplainAll = false
+	if result, err = c.Classify(context.Background(), req, items); err != nil || result.Prompt != "" {
+		t.Errorf("expected no prompt without explain, got %q (error %v)", result.Prompt, err)
+	}
+}
+
+func TestClassifyExampleAnchors(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	// A procedural body that shares no words with the prompt
+	item := Item{
+		Name:    "deploy-guide",
+		Path:    "/skills/deploy.md",
+		Content: "---\nname: deploy-guide\n---\nRun the release checklist step by step",
+		Type:    "skill",
+		Metadata: Metadata{
+			Examples: StringList{"review this python code", "django please"},
+		},
+	}
+
+	embedder := newFakeEmbedder()
+	c := New(embedder, nil)
+	req := Request{Prompt: "django", Threshold: 0.5, Explain: true}
+
+	result, err := c.Classify(context.Background(), req, []Item{item})
+	if err != nil {
+		t.Fatalf("Classify() error = %v", err)
+	}
+	if len(result.Matches) != 1 || result.Matches[0].Similarity < 0.99 {
+		t.Fatalf("expected the example anchor to match, got %+v", result.Matches)
+	}
+	e := result.Explanations[0]
+	if e.Example != "django please" || e.BodyScore != 0 || e.ExampleScore != result.Matches[0].Similarity {
+		t.Errorf("unexpected explanation %+v", e)
+	}
+
+	// Body and anchors are embedded together in the batch and cached after
+	if len(embedder.calls) != 2 || len(embedder.calls[1]) != 3 {
+		t.Fatalf("expected one batch with the body and both examples, got %v", embedder.calls)
+	}
+	if _, err := c.Classify(context.Background(), req, []Item{item}); err != nil {
+		t.Fatalf("Classify() error = %v", err)
+	}
+	if len(embedder.calls) != 3 {
+		t.Errorf("expected anchors to come from the cache, got %v", embedder.calls[2:])
+	}
+
+	// A fresh classifier finds the anchors in the on-disk cache
+	fresh := newFakeEmbedder()
+	if _, err := New(fresh, nil).Classify(context.Background(), req, []Item{item}); err != nil {
+		t.Fatalf("Classify() error = %v", err)
+	}
+	if len(fresh.calls) != 1 {
+		t.Errorf("expected only the prompt to be embedded, got %v", fresh.calls)
+	}
+}
+
+func TestClassifyNegativeAnchors(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	item := Item{
+		Name:    "database-expert",
+		Path:    "/agents/database-expert.md",
+		Content: "---\nname: database-expert\n---\npython django review",
+		Type:    "agent",
+		Metadata: Metadata{
+			NotFor:           StringList{"goroutines"},
+			NegativeExamples: StringList{"django goroutines"},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		prompt     string
+		matched    bool
+		suppressed bool
+		negative   string
+	}{
+		{"prompt closer to the item", "python django", true, false, "django goroutines"},
+		{"prompt closer to a negative", "goroutines", false, true, "goroutines"},
+		{"prompt mentions both equally", "django goroutines", false, true, "django goroutines"},
+	}
+
+	c := New(newFakeEmbedder(), nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := c.Classify(context.Background(), Request{Prompt: tt.prompt, Threshold: -1, Explain: true}, []Item{item})
+			if err != nil {
+				t.Fatalf("Classify() error = %v", err)
+			}
+			if got := len(result.Matches) == 1; got != tt.matched {
+				t.Errorf("matched = %v, expected %v (%+v)", got, tt.matched, result.Matches)
+			}
+			if len(result.Explanations) != 1 {
+				t.Fatalf("expected one explanation, got %+v", result.Explanations)
+			}
+			e := result.Explanations[0]
+			if e.Suppressed != tt.suppressed || e.NegativeExample != tt.negative {
+				t.Errorf("unexpected explanation %+v", e)
+			}
+		})
+	}
+}
+
+func TestClassifyThresholds(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	strict := float32(0.99)
+	items := []Item{
+		{Name: "python-skill", Path: "/skills/python.md", Content: "python django", Type: "skill", Priority: "medium"},
+		{Name: "python-agent", Path: "/agents/python.md", Content: "python django", Type: "agent", Priority: "medium"},
+		{Name: "python-strict", Path: "/skills/strict.md", Content: "python django", Type: "skill", Priority: "medium", Metadata: Metadata{Threshold: &strict}},
+	}
+	req := Request{
+		Prompt:     "python",
+		Threshold:  0.5,
+		Thresholds: Thresholds{Types: map[string]float32{"agent": 0.9}},
+		Explain:    true,
+	}
+
+	result, err := New(newFakeEmbedder(), nil).Classify(context.Background(), req, items)
+	if err != nil {
+		t.Fatalf("Classify() error = %v", err)
+	}
+	if got := strings.Join(matchNames(result.Matches), ","); got != "python-skill" {
+		t.Fatalf("expected only the skill to pass its threshold, got %s", got)
+	}
+	if result.Matches[0].Threshold != 0.5 {
+		t.Errorf("match threshold = %v, expected 0.5", result.Matches[0].Threshold)
+	}
+	if e := result.Explanations[0]; e.Threshold != 0.5 || e.ThresholdSource != ThresholdDefault {
+		t.Errorf("unexpected explanation %+v", e)
+	}
+}
+
+func TestClassifySelection(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	req := Request{Prompt: "python review", Threshold: 0, Selection: Selection{TopK: 1}, Explain: true}
+	result, err := New(newFakeEmbedder(), nil).Classify(context.Background(), req, fakeItems)
+	if err != nil {
+		t.Fatalf("Classify() error = %v", err)
+	}
+	if got := strings.Join(matchNames(result.Matches), ","); got != "reviewer" {
+		t.Fatalf("Classify() matches = %s, expected only the best match", got)
+	}
+
+	// Explanations are ranked like matches and say why the rest was left out
+	var explained []string
+	for _, e := range result.Explanations {
+		explained = append(explained, e.Name+":"+e.Dropped)
+	}
+	if got := strings.Join(explained, ","); got != "reviewer:,python-expert:top-k,go-expert:top-k" {
+		t.Errorf("explanations = %s", got)
+	}
+
+	req.Selection.TopK = -1
+	if _, err := New(newFakeEmbedder(), nil).Classify(context.Background(), req, fakeItems); err == nil {
+		t.Error("expected error for negative top-k")
+	}
+}
@@ -0,0 +1,71 @@
+package classifier
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Reasons a match above its threshold was left out of the result
+const (
+	DroppedMargin = "margin"   // more than Selection.MinMargin below the best match
+	DroppedType   = "type-cap" // its type already had Selection.MaxPerType matches
+	DroppedTopK   = "top-k"    // ranked below Selection.TopK
+)
+
+// Selection limits how many of the matches above their threshold are kept.
+// Zero values disable a limit.
+type Selection struct {
+	TopK       int            // keep at most this many matches
+	MinMargin  float32        // keep matches within this distance of the best score
+	MaxPerType map[string]int // keep at most this many matches of an item type
+}
+
+// Validate checks that the limits are not negative and name known item types
+func (s Selection) Validate() error {
+	if s.TopK < 0 {
+		return fmt.Errorf("top-k must not be negative, got %d", s.TopK)
+	}
+	if s.MinMargin < 0 {
+		return fmt.Errorf("min-margin must not be negative, got %g", s.MinMargin)
+	}
+	for itemType, max := range s.MaxPerType {
+		if !isItemType(itemType) {
+			return fmt.Errorf("unknown item type %q in per-type caps: must be one of skill, agent, command", itemType)
+		}
+		if max < 0 {
+			return fmt.Errorf("cap for %s must not be negative, got %d", itemType, max)
+		}
+	}
+	return nil
+}
+
+// rankMatches sorts matches from most to least similar. Ties keep their
+// original order.
+func rankMatches(matches []Match) {
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Similarity > matches[j].Similarity
+	})
+}
+
+// selectMatches ranks matches and applies the limits of s. dropped maps the
+// path of every match that was left out to the reason.
+func selectMatches(matches []Match, s Selection) (selected []Match, dropped map[string]string) {
+	rankMatches(matches)
+	dropped = make(map[string]string)
+
+	perType := make(map[string]int)
+	for _, match := range matches {
+		switch {
+		case s.MinMargin > 0 && matches[0].Similarity-match.Similarity > s.MinMargin:
+			dropped[match.Path] = DroppedMargin
+		case s.MaxPerType[match.Type] > 0 && perType[match.Type] >= s.MaxPerType[match.Type]:
+			dropped[match.Path] = DroppedType
+		case s.TopK > 0 && len(selected) >= s.TopK:
+			dropped[match.Path] = DroppedTopK
+		default:
+			perType[match.Type]++
+			selected = append(selected, match)
+		}
+	}
+	return selected, dropped
+}
@@ -0,0 +1,91 @@
+package classifier
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSelectMatches(t *testing.T) {
+	matches := []Match{
+		{Name: "low", Path: "/skills/low.md", Similarity: 0.30, Type: "skill"},
+		{Name: "best", Path: "/skills/best.md", Similarity: 0.62, Type: "skill"},
+		{Name: "agent", Path: "/agents/agent.md", Similarity: 0.55, Type: "agent"},
+		{Name: "close", Path: "/skills/close.md", Similarity: 0.58, Type: "skill"},
+	}
+
+	tests := []struct {
+		name      string
+		selection Selection
+		expected  string
+		dropped   map[string]string
+	}{
+		{
+			name:     "ranks without limits",
+			expected: "best,close,agent,low",
+		},
+		{
+			name:      "top-k",
+			selection: Selection{TopK: 2},
+			expected:  "best,close",
+			dropped:   map[string]string{"/agents/agent.md": DroppedTopK, "/skills/low.md": DroppedTopK},
+		},
+		{
+			name:      "min margin",
+			selection: Selection{MinMargin: 0.05},
+			expected:  "best,close",
+			dropped:   map[string]string{"/agents/agent.md": DroppedMargin, "/skills/low.md": DroppedMargin},
+		},
+		{
+			name:      "per-type cap",
+			selection: Selection{MaxPerType: map[string]int{"skill": 1}},
+			expected:  "best,agent",
+			dropped:   map[string]string{"/skills/close.md": DroppedType, "/skills/low.md": DroppedType},
+		},
+		{
+			name:      "cap leaves room for top-k",
+			selection: Selection{TopK: 2, MaxPerType: map[string]int{"skill": 1}},
+			expected:  "best,agent",
+			dropped:   map[string]string{"/skills/close.md": DroppedType, "/skills/low.md": DroppedType},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, dropped := selectMatches(append([]Match(nil), matches...), tt.selection)
+			if got := strings.Join(matchNames(selected), ","); got != tt.expected {
+				t.Errorf("selectMatches() = %s, expected %s", got, tt.expected)
+			}
+			if len(dropped) != len(tt.dropped) {
+				t.Fatalf("dropped = %v, expected %v", dropped, tt.dropped)
+			}
+			for path, reason := range tt.dropped {
+				if dropped[path] != reason {
+					t.Errorf("dropped[%s] = %q, expected %q", path, dropped[path], reason)
+				}
+			}
+		})
+	}
+}
+
+func TestSelectionValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		selection Selection
+		valid     bool
+	}{
+		{"zero value", Selection{}, true},
+		{"all limits", Selection{TopK: 3, MinMargin: 0.1, MaxPerType: map[string]int{"agent": 1}}, true},
+		{"negative top-k", Selection{TopK: -1}, false},
+		{"negative margin", Selection{MinMargin: -0.1}, false},
+		{"unknown type", Selection{MaxPerType: map[string]int{"agents": 1}}, false},
+		{"negative cap", Selection{MaxPerType: map[string]int{"agent": -1}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.selection.Validate(); (err == nil) != tt.valid {
+				t.Errorf("Validate() error = %v, expected valid = %v", err, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package classifier
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// PreprocessVersion is part of the embedding cache key and of index files;
+// bump it when preprocessText or chunkText change what is embedded
+const PreprocessVersion = "1"
+
+// Common English stop words (lightweight list)
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "by": true, "for": true, "from": true, "has": true, "he": true,
+	"in": true, "is": true, "it": true, "its": true, "of": true, "on": true,
+	"that": true, "the": true, "to": true, "was": true, "will": true, "with": true,
+	"this": true, "these": true, "those": true, "or": true, "but": true, "can": true,
+	"have": true, "do": true, "does": true, "did": true, "doing": true,
+}
+
+// preprocessText compacts text for embedding by removing noise and redundancy
+func preprocessText(text string) string {
+	// 1. Strip YAML frontmatter (already parsed, just noise for embedding)
+	text = stripFrontmatter(text)
+
+	// 2. Normalize whitespace - collapse multiple spaces/newlines
+	text = normalizeWhitespace(text)
+
+	// 3. Remove stop words to reduce dimensionality
+	text = removeStopWords(text)
+
+	// 4. Final whitespace cleanup
+	text = strings.TrimSpace(text)
+
+	return text
+}
+
+// stripFrontmatter removes YAML frontmatter from text
+func stripFrontmatter(text string) string {
+	lines := strings.Split(text, "\n")
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "---") {
+		// Find closing ---
+		for i := 1; i < len(lines); i++ {
+			if strings.TrimSpace(lines[i]) == "---" {
+				// Return everything after frontmatter
+				return strings.Join(lines[i+1:], "\n")
+			}
+		}
+	}
+	return text
+}
+
+// normalizeWhitespace collapses multiple spaces, tabs, and newlines
+func normalizeWhitespace(text string) string {
+	// Replace multiple whitespace with single space
+	re := regexp.MustCompile(`\s+`)
+	return re.ReplaceAllString(text, " ")
+}
+
+// removeStopWords removes common English stop words
+func removeStopWords(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	var filtered []string
+	for _, word := range words {
+		lower := strings.ToLower(word)
+		if !stopWords[lower] && len(word) > 1 { // Keep words > 1 char
+			filtered = append(filtered, word)
+		}
+	}
+
+	return strings.Join(filtered, " ")
+}
@@ -0,0 +1,133 @@
+package classifier
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileName is the config looked up in the embed directory when none is given
+const ConfigFileName = "intent-classifier.yaml"
+
+// Threshold sources reported in explanations
+const (
+	ThresholdFrontmatter = "frontmatter" // the item's own threshold: field
+	ThresholdFlag        = "flag"        // a --<type>-threshold flag
+	ThresholdItem        = "item"        // thresholds.items in the config
+	ThresholdPriority    = "priority"    // thresholds.priorities in the config
+	ThresholdType        = "type"        // thresholds.types in the config
+	ThresholdDefault     = "default"     // the request threshold
+)
+
+// Config holds the settings read from an intent-classifier.yaml file
+type Config struct {
+	Thresholds Thresholds `yaml:"thresholds"`
+}
+
+// Thresholds overrides the request threshold for some items. The item's
+// frontmatter wins, then Flags, which the command line sets and so
+// outrank the config, then the most specific config setting: Items by
+// name, then Priorities, then Types.
+type Thresholds struct {
+	Flags      map[string]float32 `yaml:"-" json:"flags,omitempty"`                         // keyed by item type, from the --<type>-threshold flags
+	Types      map[string]float32 `yaml:"types,omitempty" json:"types,omitempty"`           // keyed by item type: skill, agent, command
+	Priorities map[string]float32 `yaml:"priorities,omitempty" json:"priorities,omitempty"` // keyed by priority: critical, high, medium, low
+	Items      map[string]float32 `yaml:"items,omitempty" json:"items,omitempty"`           // keyed by item name
+}
+
+// LoadConfig reads a config file. Unknown keys are rejected so that typos
+// do not silently fall back to the defaults.
+func LoadConfig(path string) (Config, error) {
+	var config Config
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return config, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if err := config.Thresholds.Validate(); err != nil {
+		return config, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Validate checks that every type threshold names a known item type
+func (t Thresholds) Validate() error {
+	var unknown []string
+	for itemType := range t.Types {
+		if !isItemType(itemType) {
+			unknown = append(unknown, itemType)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown item type %s in thresholds: must be one of skill, agent, command", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// isItemType reports whether itemType is one of the item types
+func isItemType(itemType string) bool {
+	for _, known := range outputItemTypes {
+		if itemType == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Merge returns t with the settings of override taking precedence
+func (t Thresholds) Merge(override Thresholds) Thresholds {
+	return Thresholds{
+		Flags:      mergeThresholds(t.Flags, override.Flags),
+		Types:      mergeThresholds(t.Types, override.Types),
+		Priorities: mergeThresholds(t.Priorities, override.Priorities),
+		Items:      mergeThresholds(t.Items, override.Items),
+	}
+}
+
+// mergeThresholds copies base and override into a new map
+func mergeThresholds(base, override map[string]float32) map[string]float32 {
+	if len(base) == 0 && len(override) == 0 {
+		return nil
+	}
+	merged := make(map[string]float32, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		merged[key] = value
+	}
+	return merged
+}
+
+// resolve returns the threshold that applies to item and where it came from
+func (t Thresholds) resolve(item Item, fallback float32) (float32, string) {
+	if item.Metadata.Threshold != nil {
+		return *item.Metadata.Threshold, ThresholdFrontmatter
+	}
+	if threshold, ok := t.Flags[item.Type]; ok {
+		return threshold, ThresholdFlag
+	}
+	if threshold, ok := t.Items[item.Name]; ok {
+		return threshold, ThresholdItem
+	}
+	if threshold, ok := t.Priorities[item.Priority]; ok {
+		return threshold, ThresholdPriority
+	}
+	if threshold, ok := t.Types[item.Type]; ok {
+		return threshold, ThresholdType
+	}
+	return fallback, ThresholdDefault
+}
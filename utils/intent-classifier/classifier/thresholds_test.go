@@ -0,0 +1,100 @@
+package classifier
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestThresholdsResolve(t *testing.T) {
+	own := float32(0.9)
+	thresholds := Thresholds{
+		Types:      map[string]float32{"agent": 0.4},
+		Priorities: map[string]float32{"critical": 0.1},
+		Items:      map[string]float32{"database-expert": 0.6},
+		Flags:      map[string]float32{"command": 0.7},
+	}
+
+	tests := []struct {
+		name      string
+		item      Item
+		expected  float32
+		expSource string
+	}{
+		{"frontmatter wins", Item{Name: "database-expert", Type: "agent", Priority: "critical", Metadata: Metadata{Threshold: &own}}, 0.9, ThresholdFrontmatter},
+		{"item by name", Item{Name: "database-expert", Type: "agent", Priority: "critical"}, 0.6, ThresholdItem},
+		{"priority before type", Item{Name: "security", Type: "agent", Priority: "critical"}, 0.1, ThresholdPriority},
+		{"type", Item{Name: "reviewer", Type: "agent", Priority: "medium"}, 0.4, ThresholdType},
+		{"flag before item and priority", Item{Name: "database-expert", Type: "command", Priority: "critical"}, 0.7, ThresholdFlag},
+		{"default", Item{Name: "python", Type: "skill", Priority: "medium"}, 0.2, ThresholdDefault},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			threshold, source := thresholds.resolve(tt.item, 0.2)
+			if threshold != tt.expected || source != tt.expSource {
+				t.Errorf("resolve() = %v, %q, expected %v, %q", threshold, source, tt.expected, tt.expSource)
+			}
+		})
+	}
+}
+
+func TestThresholdsMerge(t *testing.T) {
+	base := Thresholds{Types: map[string]float32{"agent": 0.4, "skill": 0.2}}
+	merged := base.Merge(Thresholds{Types: map[string]float32{"agent": 0.5}})
+
+	expected := Thresholds{Types: map[string]float32{"agent": 0.5, "skill": 0.2}}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("Merge() = %+v, expected %+v", merged, expected)
+	}
+	if base.Types["agent"] != 0.4 {
+		t.Errorf("Merge() modified the receiver: %+v", base)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected Config
+		errMsg   string
+	}{
+		{
+			name:    "all thresholds",
+			content: "thresholds:\n  types:\n    agent: 0.35\n  priorities:\n    critical: 0.15\n  items:\n    database-expert: 0.5\n",
+			expected: Config{Thresholds: Thresholds{
+				Types:      map[string]float32{"agent": 0.35},
+				Priorities: map[string]float32{"critical": 0.15},
+				Items:      map[string]float32{"database-expert": 0.5},
+			}},
+		},
+		{name: "empty file", content: ""},
+		{name: "unknown key", content: "threshold:\n  agent: 0.3\n", errMsg: "field threshold not found"},
+		{name: "unknown type", content: "thresholds:\n  types:\n    agents: 0.3\n", errMsg: "unknown item type agents"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), ConfigFileName)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			config, err := LoadConfig(path)
+			if tt.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("LoadConfig() error = %v, expected %q", err, tt.errMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+			if !reflect.DeepEqual(config, tt.expected) {
+				t.Errorf("LoadConfig() = %+v, expected %+v", config, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package classifier
+
+import "fmt"
+
+// Output types select which item types are matched
+const (
+	OutputAuto     = "auto"
+	OutputSkills   = "skills"
+	OutputAgents   = "agents"
+	OutputCommands = "commands"
+)
+
+// outputItemTypes maps explicit output types to the item type they keep
+var outputItemTypes = map[string]string{
+	OutputSkills:   "skill",
+	OutputAgents:   "agent",
+	OutputCommands: "command",
+}
+
+// ValidateOutputType checks that outputType is a supported output type
+func ValidateOutputType(outputType string) error {
+	if outputType == OutputAuto || outputItemTypes[outputType] != "" {
+		return nil
+	}
+	return fmt.Errorf("invalid output type %q: must be one of auto, skills, agents, commands", outputType)
+}
+
+// FilterByOutputType keeps the items of the types selected by
+// outputType. With "auto" every item with a type is kept, whether the type
+// came from its directory or its frontmatter; if no item has a type, every
+// item is kept.
+func FilterByOutputType(items []Item, outputType string) ([]Item, error) {
+	if outputType == "" {
+		outputType = OutputAuto
+	}
+	if err := ValidateOutputType(outputType); err != nil {
+		return nil, err
+	}
+
+	keep := map[string]bool{}
+	if outputType == OutputAuto {
+		for _, item := range items {
+			if item.Type != "" {
+				keep[item.Type] = true
+			}
+		}
+		if len(keep) == 0 {
+			return items, nil
+		}
+	} else {
+		keep[outputItemTypes[outputType]] = true
+	}
+
+	var filtered []Item
+	for _, item := range items {
+		if keep[item.Type] {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered, nil
+}
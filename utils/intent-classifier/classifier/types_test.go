@@ -0,0 +1,97 @@
+package classifier
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestValidateOutputType(t *testing.T) {
+	for _, outputType := range []string{"auto", "skills", "agents", "commands"} {
+		if err := ValidateOutputType(outputType); err != nil {
+			t.Errorf("ValidateOutputType(%q) error = %v", outputType, err)
+		}
+	}
+	for _, outputType := range []string{"", "skill", "all", "Agents"} {
+		if err := ValidateOutputType(outputType); err == nil {
+			t.Errorf("ValidateOutputType(%q) expected error", outputType)
+		}
+	}
+}
+
+func TestFilterByOutputType(t *testing.T) {
+	items := []Item{
+		{Name: "python-expert", Type: "skill"},
+		{Name: "code-reviewer", Type: "agent"},
+		{Name: "deploy", Type: "command"},
+	}
+
+	tests := []struct {
+		name       string
+		items      []Item
+		outputType string
+		expected   []string
+	}{
+		{name: "skills", items: items, outputType: "skills", expected: []string{"python-expert"}},
+		{name: "agents", items: items, outputType: "agents", expected: []string{"code-reviewer"}},
+		{name: "commands", items: items, outputType: "commands", expected: []string{"deploy"}},
+		{name: "auto keeps every type", items: items, outputType: "auto", expected: []string{"code-reviewer", "deploy", "python-expert"}},
+		{name: "auto defaults when empty", items: items, outputType: "", expected: []string{"code-reviewer", "deploy", "python-expert"}},
+		{
+			name:       "auto drops untyped items next to typed ones",
+			items:      []Item{{Name: "code-reviewer", Type: "agent"}, {Name: "notes"}},
+			outputType: "auto",
+			expected:   []string{"code-reviewer"},
+		},
+		{
+			name:       "auto without types",
+			items:      []Item{{Name: "notes"}, {Name: "todo"}},
+			outputType: "auto",
+			expected:   []string{"notes", "todo"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filtered, err := FilterByOutputType(tt.items, tt.outputType)
+			if err != nil {
+				t.Fatalf("FilterByOutputType() error = %v", err)
+			}
+			var names []string
+			for _, item := range filtered {
+				names = append(names, item.Name)
+			}
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, tt.expected) {
+				t.Errorf("FilterByOutputType() = %v, expected %v", names, tt.expected)
+			}
+		})
+	}
+
+	t.Run("frontmatter type without a directory", func(t *testing.T) {
+		root := writeItems(t, map[string]string{"python.md": "---\nname: python-expert\n---\nPython"})
+		agent := filepath.Join(root, "reviewer.md")
+		if err := os.WriteFile(agent, []byte("---\nname: code-reviewer\ntype: agent\n---\nReview"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		loaded, _, err := ScanItems(root)
+		if err != nil {
+			t.Fatalf("ScanItems() error = %v", err)
+		}
+		filtered, err := FilterByOutputType(loaded, "auto")
+		if err != nil {
+			t.Fatalf("FilterByOutputType() error = %v", err)
+		}
+		if len(filtered) != 2 {
+			t.Errorf("FilterByOutputType() = %+v, expected the skill and the agent", filtered)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if _, err := FilterByOutputType(items, "everything"); err == nil {
+			t.Error("expected error for invalid output type")
+		}
+	})
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"intent-classifier/classifier"
+)
+
+const (
+	// defaultIdleTimeout is how long the daemon stays up without requests
+	defaultIdleTimeout = 10 * time.Minute
+
+	// daemonStartTimeout bounds how long a client waits for a spawned daemon
+	daemonStartTimeout = 30 * time.Second
+
+	// daemonRequestTimeout bounds a single request, including a first model load
+	daemonRequestTimeout = 2 * time.Minute
+)
+
+// errDaemonUnavailable means the request should be served in-process instead
+var errDaemonUnavailable = errors.New("classifier daemon unavailable")
+
+// daemonResponse is the daemon's answer to a classifyRequest
+type daemonResponse struct {
+	Result classifyResult `json:"result"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// requestHandler classifies prompts on behalf of the daemon
+type requestHandler interface {
+	classify(req classifyRequest) (classifyResult, error)
+}
+
+// daemonSocketPath returns the socket of the daemon serving the model and
+// backend selected by opts, so differently configured daemons never collide.
+// An offline client never shares a daemon that may download, and a client
+// of another release never talks to a daemon with other code and another
+// request schema.
+func daemonSocketPath(opts classifyOptions) string {
+	if socket := os.Getenv("IC_SOCKET"); socket != "" {
+		return socket
+	}
+	parts := []string{"version=" + version, opts.EmbeddingModel, opts.LLMModel, opts.LibPath, opts.Processor}
+	for _, env := range []string{"IC_MODEL_DIR", "IC_LIB_DIR"} {
+		if dir := os.Getenv(env); dir != "" {
+			parts = append(parts, env+"="+dir)
+		}
+	}
+	if opts.LlamaVersion != "" {
+		parts = append(parts, "llama="+opts.LlamaVersion)
+	}
+	if opts.Offline {
+		parts = append(parts, "offline")
+	}
+	key := classifier.HashContent(strings.Join(parts, "\x00"))
+	return filepath.Join(classifier.CacheDir(), "daemon", key[:16]+".sock")
+}
+
+// classifyViaDaemon sends the request to the daemon, spawning it if needed.
+// Any failure to reach the daemon is reported as errDaemonUnavailable.
+func classifyViaDaemon(prompt string, opts classifyOptions) (classifyResult, error) {
+	req := opts.request(prompt)
+
+	// The daemon does not share our working directory
+	embed, err := filepath.Abs(req.Embed)
+	if err != nil {
+		return classifyResult{}, fmt.Errorf("%w: %v", errDaemonUnavailable, err)
+	}
+	req.Embed = embed
+	if req.Index != "" {
+		if req.Index, err = filepath.Abs(req.Index); err != nil {
+			return classifyResult{}, fmt.Errorf("%w: %v", errDaemonUnavailable, err)
+		}
+	}
+	if req.Config != "" {
+		if req.Config, err = filepath.Abs(req.Config); err != nil {
+			return classifyResult{}, fmt.Errorf("%w: %v", errDaemonUnavailable, err)
+		}
+	}
+
+	socket := daemonSocketPath(opts)
+	conn, err := net.DialTimeout("unix", socket, time.Second)
+	if err != nil {
+		exited, err := spawnDaemon(opts, socket)
+		if err != nil {
+			return classifyResult{}, fmt.Errorf("%w: %v", errDaemonUnavailable, err)
+		}
+		conn, err = waitForDaemon(socket, daemonStartTimeout, exited)
+		if err != nil {
+			return classifyResult{}, fmt.Errorf("%w: %v", errDaemonUnavailable, err)
+		}
+	}
+
+	return sendDaemonRequest(conn, req)
+}
+
+// sendDaemonRequest performs one request/response exchange and closes conn
+func sendDaemonRequest(conn net.Conn, req classifyRequest) (classifyResult, error) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(daemonRequestTimeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return classifyResult{}, fmt.Errorf("%w: %v", errDaemonUnavailable, err)
+	}
+
+	var resp daemonResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return classifyResult{}, fmt.Errorf("%w: %v", errDaemonUnavailable, err)
+	}
+
+	if resp.Error != "" {
+		return classifyResult{}, errors.New(resp.Error)
+	}
+	resp.Result.Daemon = true
+	return resp.Result, nil
+}
+
+// spawnDaemon starts a detached "serve" process for the model in opts. The
+// returned channel receives the process's exit status should it exit.
+func spawnDaemon(opts classifyOptions, socket string) (<-chan error, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(socket), 0700); err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"serve",
+		"--socket", socket,
+		"--embedding-model", opts.EmbeddingModel,
+		"--llm-model", opts.LLMModel,
+		"--processor", opts.Processor,
+		"--llama-log-level", strconv.Itoa(opts.LlamaLogLevel),
+		"--idle-timeout", opts.IdleTimeout.String(),
+	}
+	if opts.LibPath != "" {
+		args = append(args, "--lib", opts.LibPath)
+	}
+	if opts.LlamaVersion != "" {
+		args = append(args, "--llama-version", opts.LlamaVersion)
+	}
+	if opts.Offline {
+		args = append(args, "--offline")
+	}
+
+	// Daemon output goes to a log next to the socket, never to our stdout
+	logFile, err := os.OpenFile(strings.TrimSuffix(socket, ".sock")+".log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = detachedProcAttr()
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+	return exited, nil
+}
+
+// waitForDaemon polls the socket until the daemon accepts connections. It
+// gives up early when the daemon exits, e.g. because offline mode found a
+// model missing, instead of waiting out the timeout.
+func waitForDaemon(socket string, timeout time.Duration, exited <-chan error) (net.Conn, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.DialTimeout("unix", socket, time.Second)
+		if err == nil {
+			return conn, nil
+		}
+		select {
+		case status := <-exited:
+			if status == nil {
+				status = errors.New("exit status 0")
+			}
+			return nil, fmt.Errorf("daemon exited during startup (%v), see %s", status, strings.TrimSuffix(socket, ".sock")+".log")
+		default:
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("daemon did not start within %s: %w", timeout, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// listenDaemonSocket claims the socket, removing a stale one left by a crash
+func listenDaemonSocket(socket string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(socket), 0700); err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("unix", socket)
+	if err == nil {
+		return ln, nil
+	}
+
+	// Someone answers - another daemon already serves this socket
+	if conn, dialErr := net.DialTimeout("unix", socket, time.Second); dialErr == nil {
+		conn.Close()
+		return nil, fmt.Errorf("a daemon is already listening on %s", socket)
+	}
+
+	if removeErr := os.Remove(socket); removeErr != nil && !os.IsNotExist(removeErr) {
+		return nil, err
+	}
+	return net.Listen("unix", socket)
+}
+
+// runServe implements the "serve" subcommand
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	var opts classifyOptions
+	addEngineFlags(fs, &opts)
+	socket := fs.String("socket", "", "Unix socket path (default: derived from model and backend, env: IC_SOCKET)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s serve [options]\n\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Keeps the embedding model loaded and answers classification requests")
+		fmt.Fprintln(os.Stderr, "over a Unix socket. Normally started automatically by the CLI.")
+		fmt.Fprintln(os.Stderr, "")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	applyEngineEnv(fs, &opts)
+
+	if *socket == "" {
+		*socket = daemonSocketPath(opts)
+	}
+
+	// Claim the socket before loading the model so concurrent spawns back off
+	ln, err := listenDaemonSocket(*socket)
+	if err != nil {
+		return err
+	}
+
+	eng, err := newEngine(opts)
+	if err != nil {
+		ln.Close()
+		return err
+	}
+	defer eng.close()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		ln.Close()
+	}()
+
+	fmt.Fprintf(os.Stderr, "intent-classifier daemon listening on %s (idle timeout %s)\n", *socket, opts.IdleTimeout)
+	return serveDaemon(ln, eng, opts.IdleTimeout)
+}
+
+// serveDaemon accepts requests until the listener is closed or no request
+// arrives within idle (0 disables the idle shutdown)
+func serveDaemon(ln net.Listener, h requestHandler, idle time.Duration) error {
+	var idleTimer *time.Timer
+	resetIdle := func() {}
+	if idle > 0 {
+		idleTimer = time.AfterFunc(idle, func() { ln.Close() })
+		defer idleTimer.Stop()
+		resetIdle = func() { idleTimer.Reset(idle) }
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		resetIdle()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handleDaemonConn(conn, h)
+			resetIdle()
+		}()
+	}
+}
+
+// handleDaemonConn answers a single request on conn
+func handleDaemonConn(conn net.Conn, h requestHandler) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(daemonRequestTimeout))
+
+	var req classifyRequest
+	var resp daemonResponse
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		resp.Error = fmt.Sprintf("invalid request: %v", err)
+	} else if result, err := h.classify(req); err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Result = result
+	}
+
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to answer request: %v\n", err)
+	}
+}
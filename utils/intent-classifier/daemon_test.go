@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"intent-classifier/classifier"
+)
+
+// fakeHandler answers daemon requests without a model
+type fakeHandler struct {
+	matches []classifier.Match
+	err     error
+	got     classifyRequest
+}
+
+func (f *fakeHandler) classify(req classifyRequest) (classifyResult, error) {
+	f.got = req
+	return classifyResult{Matches: f.matches}, f.err
+}
+
+func startTestDaemon(t *testing.T, h requestHandler, idle time.Duration) (string, chan error) {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "d.sock")
+	ln, err := listenDaemonSocket(socket)
+	if err != nil {
+		t.Fatalf("listenDaemonSocket() error = %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- serveDaemon(ln, h, idle) }()
+	t.Cleanup(func() { ln.Close() })
+	return socket, done
+}
+
+func TestDaemonRoundTrip(t *testing.T) {
+	h := &fakeHandler{matches: []classifier.Match{{Name: "python-expert", Similarity: 0.5, Priority: "high", Type: "skill"}}}
+	socket, _ := startTestDaemon(t, h, 0)
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatalf("dial error = %v", err)
+	}
+
+	result, err := sendDaemonRequest(conn, classifyRequest{Prompt: "python help", Embed: "/skills", Threshold: 0.3, OutputType: classifier.OutputAgents, Mode: classifier.ModeHybrid, Shortlist: 3})
+	if err != nil {
+		t.Fatalf("sendDaemonRequest() error = %v", err)
+	}
+
+	if len(result.Matches) != 1 || result.Matches[0].Name != "python-expert" {
+		t.Errorf("unexpected matches: %+v", result.Matches)
+	}
+	if !result.Daemon {
+		t.Errorf("expected result to be marked as served by the daemon")
+	}
+	if h.got.Prompt != "python help" || h.got.Embed != "/skills" || h.got.Threshold != 0.3 || h.got.OutputType != classifier.OutputAgents || h.got.Mode != classifier.ModeHybrid || h.got.Shortlist != 3 {
+		t.Errorf("handler got %+v", h.got)
+	}
+}
+
+func TestDaemonReportsClassificationErrors(t *testing.T) {
+	h := &fakeHandler{err: errors.New("failed to load items: no such directory")}
+	socket, _ := startTestDaemon(t, h, 0)
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatalf("dial error = %v", err)
+	}
+
+	_, err = sendDaemonRequest(conn, classifyRequest{Prompt: "x", Embed: "/missing"})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	// Classification errors must not trigger the in-process fallback
+	if errors.Is(err, errDaemonUnavailable) {
+		t.Errorf("classification error reported as unavailable: %v", err)
+	}
+}
+
+func TestDaemonIdleTimeout(t *testing.T) {
+	_, done := startTestDaemon(t, &fakeHandler{}, 50*time.Millisecond)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("serveDaemon() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("daemon did not shut down after idle timeout")
+	}
+}
+
+func TestListenDaemonSocket(t *testing.T) {
+	t.Run("removes stale socket", func(t *testing.T) {
+		socket := filepath.Join(t.TempDir(), "stale.sock")
+		if err := os.WriteFile(socket, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		ln, err := listenDaemonSocket(socket)
+		if err != nil {
+			t.Fatalf("listenDaemonSocket() error = %v", err)
+		}
+		ln.Close()
+	})
+
+	t.Run("refuses live socket", func(t *testing.T) {
+		socket := filepath.Join(t.TempDir(), "live.sock")
+		ln, err := listenDaemonSocket(socket)
+		if err != nil {
+			t.Fatalf("listenDaemonSocket() error = %v", err)
+		}
+		defer ln.Close()
+
+		if second, err := listenDaemonSocket(socket); err == nil {
+			second.Close()
+			t.Error("expected error for socket already in use")
+		}
+	})
+}
+
+func TestDaemonSocketPath(t *testing.T) {
+	t.Setenv("IC_SOCKET", "")
+	t.Setenv("IC_MODEL_DIR", "")
+	t.Setenv("IC_LIB_DIR", "")
+
+	a := daemonSocketPath(classifyOptions{EmbeddingModel: "a.gguf", Processor: "cpu"})
+	b := daemonSocketPath(classifyOptions{EmbeddingModel: "b.gguf", Processor: "cpu"})
+	if a == b {
+		t.Errorf("different models share socket %s", a)
+	}
+	c := daemonSocketPath(classifyOptions{EmbeddingModel: "a.gguf", LLMModel: "llm.gguf", Processor: "cpu"})
+	if a == c {
+		t.Errorf("different LLM models share socket %s", a)
+	}
+	if a != daemonSocketPath(classifyOptions{EmbeddingModel: "a.gguf", Processor: "cpu"}) {
+		t.Errorf("socket path is not stable")
+	}
+	if a == daemonSocketPath(classifyOptions{EmbeddingModel: "a.gguf", Processor: "cpu", Offline: true}) {
+		t.Errorf("offline and online clients share socket %s", a)
+	}
+	defer func(v string) { version = v }(version)
+	version = "0.0.0-upgraded"
+	if a == daemonSocketPath(classifyOptions{EmbeddingModel: "a.gguf", Processor: "cpu"}) {
+		t.Errorf("another release shares socket %s", a)
+	}
+	t.Setenv("IC_MODEL_DIR", "/nix/store/models")
+	if a == daemonSocketPath(classifyOptions{EmbeddingModel: "a.gguf", Processor: "cpu"}) {
+		t.Errorf("IC_MODEL_DIR does not change the socket %s", a)
+	}
+
+	t.Setenv("IC_SOCKET", "/tmp/custom.sock")
+	if got := daemonSocketPath(classifyOptions{}); got != "/tmp/custom.sock" {
+		t.Errorf("IC_SOCKET ignored, got %s", got)
+	}
+}
+
+func TestWaitForDaemonExited(t *testing.T) {
+	exited := make(chan error, 1)
+	exited <- errors.New("exit status 1")
+
+	start := time.Now()
+	_, err := waitForDaemon(filepath.Join(t.TempDir(), "missing.sock"), 10*time.Second, exited)
+	if err == nil || !strings.Contains(err.Error(), "exited during startup") {
+		t.Errorf("expected the daemon exit to be reported, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("waitForDaemon() took %s after the daemon exited", elapsed)
+	}
+}
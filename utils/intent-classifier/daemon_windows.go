@@ -0,0 +1,13 @@
+//go:build windows
+
+package main
+
+import "syscall"
+
+// detachedProcess is the DETACHED_PROCESS creation flag
+const detachedProcess = 0x00000008
+
+// detachedProcAttr starts the daemon without a console so it outlives the CLI
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: detachedProcess | syscall.CREATE_NEW_PROCESS_GROUP}
+}
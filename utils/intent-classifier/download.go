@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"intent-classifier/classifier"
+)
+
+const (
+	// downloadAttempts is how often a download is tried before giving up
+	downloadAttempts = 5
+
+	// downloadBackoff is the wait before the first retry; it doubles up to downloadMaxBackoff
+	downloadBackoff    = time.Second
+	downloadMaxBackoff = 30 * time.Second
+
+	// downloadConnectTimeout bounds connecting and the TLS handshake
+	downloadConnectTimeout = 15 * time.Second
+
+	// downloadReadTimeout aborts an attempt that receives no data for this long
+	downloadReadTimeout = time.Minute
+
+	// partSuffix names the file a download is written to until it completes
+	partSuffix = classifier.DownloadPartSuffix
+)
+
+// downloader fetches files over HTTP, resuming partial files and retrying
+// with exponential backoff
+type downloader struct {
+	client      *http.Client
+	attempts    int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	readTimeout time.Duration
+	sleep       func(time.Duration)
+
+	log      io.Writer     // retries and progress, never stdout
+	terminal bool          // log is a terminal: progress redraws one line
+	interval time.Duration // minimum time between progress updates
+}
+
+// newDownloader returns a downloader reporting progress on stderr
+func newDownloader() *downloader {
+	dialer := &net.Dialer{Timeout: downloadConnectTimeout}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = downloadConnectTimeout
+	transport.ResponseHeaderTimeout = downloadReadTimeout
+
+	terminal := false
+	if info, err := os.Stderr.Stat(); err == nil {
+		terminal = info.Mode()&os.ModeCharDevice != 0
+	}
+	interval := 10 * time.Second
+	if terminal {
+		interval = 200 * time.Millisecond
+	}
+
+	return &downloader{
+		client:      &http.Client{Transport: transport},
+		attempts:    downloadAttempts,
+		backoff:     downloadBackoff,
+		maxBackoff:  downloadMaxBackoff,
+		readTimeout: downloadReadTimeout,
+		sleep:       time.Sleep,
+		log:         os.Stderr,
+		terminal:    terminal,
+		interval:    interval,
+	}
+}
+
+// downloadFile downloads a file from a URL to a local path, see downloader.download
+func downloadFile(url string, path string, pin string, validate func(io.Reader) error) (string, error) {
+	return newDownloader().download(url, path, pin, validate)
+}
+
+// permanentError marks a failure that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// download fetches url to path and returns its sha256. Data goes to
+// path.part, which a later call resumes with an HTTP Range request if this
+// one is interrupted; callers must hold a lock so that only one process
+// writes it. The part file only replaces path once complete, on disk,
+// matching the pin (unless pin is "") and accepted by validate (unless
+// nil), so a bad download never looks like a cached one.
+func (d *downloader) download(url string, path string, pin string, validate func(io.Reader) error) (string, error) {
+	partPath := path + partSuffix
+	part, err := os.OpenFile(partPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return "", err
+	}
+	discard := func(err error) (string, error) {
+		part.Close()
+		os.Remove(partPath)
+		return "", err
+	}
+
+	h := sha256.New()
+	offset, err := rehash(part, h)
+	if err != nil {
+		return discard(err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		offset, err = d.fetch(url, part, h, offset)
+		if err == nil {
+			break
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return discard(err)
+		}
+		if attempt >= d.attempts {
+			part.Close() // kept for the next run to resume
+			return "", fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		delay := d.delay(attempt)
+		fmt.Fprintf(d.log, "⚠️  Download interrupted (%v), retrying in %s...\n", err, delay)
+		d.sleep(delay)
+
+		// The part file is the truth: whatever the failed attempt wrote counts
+		if offset, err = rehash(part, h); err != nil {
+			return discard(err)
+		}
+	}
+
+	if offset == 0 {
+		return discard(errors.New("downloaded file is empty"))
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	if pin != "" && sum != pin {
+		return discard(checksumError(url, pin, sum))
+	}
+	if validate != nil {
+		if _, err := part.Seek(0, io.SeekStart); err != nil {
+			return discard(err)
+		}
+		if err := validate(part); err != nil {
+			return discard(err)
+		}
+	}
+
+	// Ensure data is flushed to disk before it becomes visible
+	if err := part.Sync(); err != nil {
+		return discard(err)
+	}
+	if err := part.Close(); err != nil {
+		os.Remove(partPath)
+		return "", err
+	}
+	return sum, os.Rename(partPath, path)
+}
+
+// delay returns the backoff after the given failed attempt (1-based)
+func (d *downloader) delay(attempt int) time.Duration {
+	delay := d.backoff << (attempt - 1)
+	if delay > d.maxBackoff || delay <= 0 {
+		delay = d.maxBackoff
+	}
+	return delay
+}
+
+// retry calls fn until it succeeds or the attempts are used up, for
+// downloads that cannot be resumed
+func (d *downloader) retry(fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= d.attempts {
+			return err
+		}
+		delay := d.delay(attempt)
+		fmt.Fprintf(d.log, "⚠️  Download failed (%v), retrying in %s...\n", err, delay)
+		d.sleep(delay)
+	}
+}
+
+// rehash resets h to the content of file and leaves the file positioned at
+// its end, returning its size
+func rehash(file *os.File, h hash.Hash) (int64, error) {
+	h.Reset()
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.Copy(h, file)
+}
+
+// fetch appends the bytes of url from offset on to part and h, starting
+// over if the server cannot resume. It returns the new size of part.
+func (d *downloader) fetch(url string, part *os.File, h hash.Hash, offset int64) (int64, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return offset, &permanentError{err}
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return offset, err
+	}
+	defer resp.Body.Close()
+
+	total := resp.ContentLength
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		start, size, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			return restart(part, h, fmt.Errorf("server resumed at the wrong offset (%q)", resp.Header.Get("Content-Range")))
+		}
+		total = size
+	case resp.StatusCode == http.StatusOK:
+		if offset > 0 {
+			// The server ignored the range: take the full body from the start
+			if _, err := restart(part, h, nil); err != nil {
+				return 0, err
+			}
+			offset = 0
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		return restart(part, h, errors.New("server cannot resume the partial file"))
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return offset, fmt.Errorf("bad status: %s", resp.Status)
+	default:
+		return offset, &permanentError{fmt.Errorf("bad status: %s", resp.Status)}
+	}
+
+	body := newIdleTimeoutReader(resp.Body, d.readTimeout, cancel)
+	defer body.stop()
+	progress := &progressWriter{d: d, done: offset, total: total, last: time.Now()}
+
+	n, err := io.Copy(io.MultiWriter(part, h, progress), body)
+	progress.finish()
+	if err != nil && body.expired() {
+		err = fmt.Errorf("no data received for %s", d.readTimeout)
+	}
+	return offset + n, err
+}
+
+// restart empties the part file so the next attempt starts from scratch
+func restart(part *os.File, h hash.Hash, cause error) (int64, error) {
+	h.Reset()
+	if err := part.Truncate(0); err != nil {
+		return 0, err
+	}
+	if _, err := part.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return 0, cause
+}
+
+// parseContentRange parses "bytes <start>-<end>/<size>"; size is -1 when
+// the server sends "*"
+func parseContentRange(value string) (start, size int64, ok bool) {
+	spec, found := strings.CutPrefix(value, "bytes ")
+	if !found {
+		return 0, 0, false
+	}
+	byteRange, sizeText, found := strings.Cut(spec, "/")
+	if !found {
+		return 0, 0, false
+	}
+	startText, _, found := strings.Cut(byteRange, "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	start, err := strconv.ParseInt(startText, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	size = -1
+	if sizeText != "*" {
+		if size, err = strconv.ParseInt(sizeText, 10, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+	return start, size, true
+}
+
+// idleTimeoutReader cancels a request when no read completes for timeout
+type idleTimeoutReader struct {
+	r       io.Reader
+	timeout time.Duration
+	timer   *time.Timer
+	fired   atomic.Bool
+}
+
+// newIdleTimeoutReader calls cancel once r has been idle for timeout
+func newIdleTimeoutReader(r io.Reader, timeout time.Duration, cancel func()) *idleTimeoutReader {
+	reader := &idleTimeoutReader{r: r, timeout: timeout}
+	reader.timer = time.AfterFunc(timeout, func() {
+		reader.fired.Store(true)
+		cancel()
+	})
+	return reader
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+	return n, err
+}
+
+// expired reports whether the timeout cancelled the request
+func (r *idleTimeoutReader) expired() bool {
+	return r.fired.Load()
+}
+
+// stop disarms the timeout
+func (r *idleTimeoutReader) stop() {
+	r.timer.Stop()
+}
+
+// progressWriter reports download progress on the downloader's log
+type progressWriter struct {
+	d     *downloader
+	done  int64
+	total int64 // -1 when unknown
+	last  time.Time
+	shown bool
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.done += int64(len(b))
+	if time.Since(p.last) >= p.d.interval {
+		p.print()
+	}
+	return len(b), nil
+}
+
+// print writes the current progress, redrawing the line on a terminal
+func (p *progressWriter) print() {
+	p.last = time.Now()
+	p.shown = true
+
+	line := "   " + formatSize(p.done)
+	if p.total > 0 {
+		line = fmt.Sprintf("   %3d%%  %s / %s", p.done*100/p.total, formatSize(p.done), formatSize(p.total))
+	}
+	if p.d.terminal {
+		fmt.Fprintf(p.d.log, "\r%-40s", line)
+	} else {
+		fmt.Fprintln(p.d.log, line)
+	}
+}
+
+// finish prints the final state if any progress was shown
+func (p *progressWriter) finish() {
+	if !p.shown {
+		return
+	}
+	p.print()
+	if p.d.terminal {
+		fmt.Fprintln(p.d.log)
+	}
+}
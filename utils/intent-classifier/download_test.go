@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"intent-classifier/classifier"
+)
+
+// testGGUF is the header of a small but valid GGUF file
+var testGGUF = func() []byte {
+	data := []byte("GGUF")
+	data = binary.LittleEndian.AppendUint32(data, 3)
+	data = binary.LittleEndian.AppendUint64(data, 1)
+	return binary.LittleEndian.AppendUint64(data, 0)
+}()
+
+// sha256Hex returns the hex sha256 of data
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// newModelServer serves testGGUF as /model.gguf, an HTML page as
+// /page.gguf and an empty body as /empty.gguf
+func newModelServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/model.gguf":
+			w.Write(testGGUF)
+		case "/page.gguf":
+			w.Write([]byte("<html>rate limited</html>"))
+		case "/empty.gguf":
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDownloadFile(t *testing.T) {
+	server := newModelServer(t)
+	validate := func(r io.Reader) error {
+		_, err := classifier.ParseGGUFHeader(r)
+		return err
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		pin     string
+		wantErr string
+	}{
+		{"complete", "/model.gguf", "", ""},
+		{"pinned", "/model.gguf", sha256Hex(testGGUF), ""},
+		{"wrong pin", "/model.gguf", sha256Hex([]byte("other")), "checksum mismatch"},
+		{"not a model", "/page.gguf", "", "not a GGUF model"},
+		{"not found", "/missing.gguf", "", "bad status"},
+		{"empty", "/empty.gguf", "", "empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			target := filepath.Join(dir, "model.gguf")
+
+			sum, err := downloadFile(server.URL+tt.path, target, tt.pin, validate)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("downloadFile() error = %v", err)
+				}
+				if sum != sha256Hex(testGGUF) {
+					t.Errorf("downloadFile() sum = %s, expected %s", sum, sha256Hex(testGGUF))
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("downloadFile() error = %v, expected it to contain %q", err, tt.wantErr)
+			}
+
+			// A failed download must not leave anything resolveModel would take for the model
+			if names, _ := os.ReadDir(dir); len(names) > 0 {
+				t.Errorf("expected no files to be left, got %v", names)
+			}
+		})
+	}
+}
+
+// testPayload is a download large enough to be split across attempts
+var testPayload = bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+// newTestDownloader returns a downloader with short timeouts whose sleeps
+// and log are recorded instead of happening
+func newTestDownloader() (*downloader, *[]time.Duration, *bytes.Buffer) {
+	var sleeps []time.Duration
+	var log bytes.Buffer
+	return &downloader{
+		client:      &http.Client{},
+		attempts:    4,
+		backoff:     10 * time.Millisecond,
+		maxBackoff:  25 * time.Millisecond,
+		readTimeout: time.Second,
+		sleep:       func(d time.Duration) { sleeps = append(sleeps, d) },
+		log:         &log,
+	}, &sleeps, &log
+}
+
+// serveRange serves testPayload honouring Range requests
+func serveRange(w http.ResponseWriter, r *http.Request) {
+	http.ServeContent(w, r, "model.gguf", time.Time{}, bytes.NewReader(testPayload))
+}
+
+func TestDownloadResumesPartialFile(t *testing.T) {
+	var mu sync.Mutex
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mu.Unlock()
+		serveRange(w, r)
+	}))
+	defer server.Close()
+
+	// A previous run was killed after the first 1000 bytes
+	target := filepath.Join(t.TempDir(), "model.gguf")
+	if err := os.WriteFile(target+partSuffix, testPayload[:1000], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d, _, _ := newTestDownloader()
+	sum, err := d.download(server.URL, target, sha256Hex(testPayload), nil)
+	if err != nil {
+		t.Fatalf("download() error = %v", err)
+	}
+	if sum != sha256Hex(testPayload) {
+		t.Errorf("download() sum = %s, expected %s", sum, sha256Hex(testPayload))
+	}
+	if data, _ := os.ReadFile(target); !bytes.Equal(data, testPayload) {
+		t.Errorf("downloaded %d bytes, expected %d", len(data), len(testPayload))
+	}
+	if _, err := os.Stat(target + partSuffix); !os.IsNotExist(err) {
+		t.Errorf("expected the part file to be renamed")
+	}
+	if !reflect.DeepEqual(ranges, []string{"bytes=1000-"}) {
+		t.Errorf("requested ranges %q, expected a single resume", ranges)
+	}
+}
+
+func TestDownloadRetriesAndResumes(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		n := requests
+		mu.Unlock()
+
+		switch n {
+		case 1:
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+		case 2:
+			// Promise everything, send half, then drop the connection
+			w.Header().Set("Content-Length", strconv.Itoa(len(testPayload)))
+			w.Write(testPayload[:len(testPayload)/2])
+			w.(http.Flusher).Flush()
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		default:
+			if r.Header.Get("Range") == "" {
+				t.Errorf("expected the third request to resume")
+			}
+			serveRange(w, r)
+		}
+	}))
+	defer server.Close()
+
+	target := filepath.Join(t.TempDir(), "model.gguf")
+	d, sleeps, log := newTestDownloader()
+	if _, err := d.download(server.URL, target, sha256Hex(testPayload), nil); err != nil {
+		t.Fatalf("download() error = %v", err)
+	}
+	if data, _ := os.ReadFile(target); !bytes.Equal(data, testPayload) {
+		t.Errorf("downloaded %d bytes, expected %d", len(data), len(testPayload))
+	}
+	if want := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}; !reflect.DeepEqual(*sleeps, want) {
+		t.Errorf("backoff = %v, expected %v", *sleeps, want)
+	}
+	if !strings.Contains(log.String(), "retrying") {
+		t.Errorf("expected retries to be reported, got %q", log.String())
+	}
+}
+
+func TestDownloadRestartsWhenRangeIsIgnored(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(testPayload)
+	}))
+	defer server.Close()
+
+	// A part file that does not even belong to this download
+	target := filepath.Join(t.TempDir(), "model.gguf")
+	if err := os.WriteFile(target+partSuffix, []byte("stale bytes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d, _, _ := newTestDownloader()
+	if _, err := d.download(server.URL, target, sha256Hex(testPayload), nil); err != nil {
+		t.Fatalf("download() error = %v", err)
+	}
+	if data, _ := os.ReadFile(target); !bytes.Equal(data, testPayload) {
+		t.Errorf("downloaded %d bytes, expected %d", len(data), len(testPayload))
+	}
+}
+
+func TestDownloadGivesUp(t *testing.T) {
+	stalled := make(chan struct{})
+	defer close(stalled)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			http.Error(w, "busy", http.StatusBadGateway)
+			return
+		}
+		w.Write(testPayload[:100])
+		w.(http.Flusher).Flush()
+		select {
+		case <-stalled:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	target := filepath.Join(t.TempDir(), "model.gguf")
+	d, sleeps, _ := newTestDownloader()
+	d.readTimeout = 50 * time.Millisecond
+	_, err := d.download(server.URL, target, "", nil)
+	if err == nil || !strings.Contains(err.Error(), "giving up after 4 attempts") {
+		t.Fatalf("download() error = %v, expected to give up", err)
+	}
+	if want := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 25 * time.Millisecond}; !reflect.DeepEqual(*sleeps, want) {
+		t.Errorf("backoff = %v, expected %v", *sleeps, want)
+	}
+
+	// The stalled attempt timed out, and what it received is kept for the next run
+	if info, err := os.Stat(target + partSuffix); err != nil || info.Size() != 100 {
+		t.Errorf("expected 100 bytes to be kept for resuming, got %v", err)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("expected no model after giving up")
+	}
+}
+
+func TestDownloadReadTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(testPayload[:100])
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	d, _, _ := newTestDownloader()
+	d.attempts = 1
+	d.readTimeout = 50 * time.Millisecond
+	_, err := d.download(server.URL, filepath.Join(t.TempDir(), "model.gguf"), "", nil)
+	if err == nil || !strings.Contains(err.Error(), "no data received for 50ms") {
+		t.Errorf("download() error = %v, expected a read timeout", err)
+	}
+}
+
+func TestDownloadProgress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(serveRange))
+	defer server.Close()
+
+	d, _, log := newTestDownloader()
+	if _, err := d.download(server.URL, filepath.Join(t.TempDir(), "model.gguf"), "", nil); err != nil {
+		t.Fatalf("download() error = %v", err)
+	}
+	if !strings.Contains(log.String(), "100%  64.0 KB / 64.0 KB") {
+		t.Errorf("expected progress on the log, got %q", log.String())
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		value string
+		start int64
+		size  int64
+		ok    bool
+	}{
+		{"bytes 1000-65535/65536", 1000, 65536, true},
+		{"bytes 0-99/*", 0, -1, true},
+		{"bytes */65536", 0, 0, false},
+		{"items 0-1/2", 0, 0, false},
+		{"", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		start, size, ok := parseContentRange(tt.value)
+		if start != tt.start || size != tt.size || ok != tt.ok {
+			t.Errorf("parseContentRange(%q) = %d, %d, %v, expected %d, %d, %v", tt.value, start, size, ok, tt.start, tt.size, tt.ok)
+		}
+	}
+}
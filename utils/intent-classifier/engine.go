@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"intent-classifier/classifier"
+)
+
+// classifyRequest describes one classification, whether served in-process or by the daemon
+type classifyRequest struct {
+	Prompt       string  `json:"prompt"`
+	Embed        string  `json:"embed"`
+	Threshold    float32 `json:"threshold"`
+	OutputType   string  `json:"output_type"`
+	Mode         string  `json:"mode"`
+	LLMThreshold float32 `json:"llm_threshold"`
+	Shortlist    int     `json:"shortlist"`
+
+	ChunkSize      int    `json:"chunk_size"`
+	ChunkOverlap   int    `json:"chunk_overlap"`
+	ChunkAggregate string `json:"chunk_aggregate"`
+	ChunkTopK      int    `json:"chunk_top_k"`
+	Explain        bool   `json:"explain"`
+	ExplainAll     bool   `json:"explain_all,omitempty"` // explain items below their threshold too
+
+	Index          string             `json:"index,omitempty"`           // index file answered from instead of Embed
+	Config         string             `json:"config,omitempty"`          // config file, default <embed>/intent-classifier.yaml
+	TypeThresholds map[string]float32 `json:"type_thresholds,omitempty"` // --<type>-threshold flags, override the config
+
+	TopK       int            `json:"top_k,omitempty"`
+	MinMargin  float32        `json:"min_margin,omitempty"`
+	MaxPerType map[string]int `json:"max_per_type,omitempty"` // --max-<type>s flags
+
+	MaxCacheSize int64 `json:"max_cache_size,omitempty"` // bytes, enforced after the cache was written to
+}
+
+// classifyResult is the outcome of one classification
+type classifyResult struct {
+	Matches      []classifier.Match       `json:"matches"`
+	Explanations []classifier.Explanation `json:"explanations,omitempty"`
+	Prompt       string                   `json:"prompt,omitempty"`      // preprocessed prompt, when explaining
+	Diagnostics  []classifier.Diagnostic  `json:"diagnostics,omitempty"` // item files that were skipped or not scored, cache writes that failed
+	Models       modelInfo                `json:"models"`
+	Timings      timings                  `json:"timings"`
+	Daemon       bool                     `json:"daemon"` // answered by the resident daemon
+}
+
+// modelInfo identifies the models a result was produced with
+type modelInfo struct {
+	Embedding modelIdentity  `json:"embedding"`
+	LLM       *modelIdentity `json:"llm,omitempty"`
+}
+
+// modelIdentity describes one loaded GGUF model
+type modelIdentity struct {
+	Spec        string `json:"spec"`                  // URL or path as given on the command line
+	File        string `json:"file"`                  // GGUF file name
+	Description string `json:"description"`           // llama.cpp model description (architecture, size, quantization)
+	Fingerprint string `json:"fingerprint,omitempty"` // cache key of the model, see classifier.Fingerprinter
+}
+
+// timings records where the time of a classification went, in milliseconds
+type timings struct {
+	LoadMs        float64 `json:"load"`         // llama.cpp and model setup (0 when resident)
+	ItemsMs       float64 `json:"items"`        // reading and parsing item files
+	EmbedPromptMs float64 `json:"embed_prompt"` // embedding the prompt
+	MatchMs       float64 `json:"match"`        // scoring items (embeddings and/or LLM)
+	TotalMs       float64 `json:"total"`        // wall time as seen by the caller
+}
+
+// indexModel identifies the model in index files. The spec is left out so
+// that a URL and a local copy of the same model share an index.
+func (m modelIdentity) indexModel() string {
+	return m.File + " (" + m.Description + "; " + m.Fingerprint + ")"
+}
+
+// millisSince returns the elapsed time since start in milliseconds
+func millisSince(start time.Time) float64 {
+	return float64(time.Since(start).Microseconds()) / 1000
+}
+
+// engine keeps llama.cpp and the models loaded so that several prompts can
+// be classified without paying the setup cost again
+type engine struct {
+	mu         sync.Mutex
+	classifier *classifier.Classifier
+	embedder   *classifier.LlamaEmbedder
+	info       modelIdentity
+	llm        *lazyScorer
+}
+
+// newEngine loads llama.cpp and the embedding model described by opts
+func newEngine(opts classifyOptions) (*engine, error) {
+	// Auto-download llama.cpp if not found (must happen before resolving models)
+	libPath := opts.LibPath
+	var libErr error
+	if libPath == "" {
+		libPath, libErr = ensureLlamaLib(opts.Processor, opts.LlamaVersion, opts.Offline)
+		if libErr != nil && !opts.Offline {
+			return nil, libErr
+		}
+	}
+
+	// Resolve embedding model to GGUF file path. Offline, a missing library
+	// and model are reported together.
+	embeddingModelPath, err := resolveModel(opts.EmbeddingModel, "embedding", opts.Offline)
+	if err := joinOffline(libErr, err); err != nil {
+		return nil, err
+	}
+
+	if err := classifier.InitLlama(libPath, opts.LlamaLogLevel); err != nil {
+		return nil, err
+	}
+
+	embedder, err := classifier.NewLlamaEmbedder(embeddingModelPath)
+	if err != nil {
+		classifier.FreeLlama()
+		return nil, err
+	}
+
+	llm := &lazyScorer{spec: opts.LLMModel, offline: opts.Offline}
+	return &engine{
+		classifier: classifier.New(embedder, llm),
+		embedder:   embedder,
+		llm:        llm,
+		info: modelIdentity{
+			Spec:        opts.EmbeddingModel,
+			File:        embedder.File(),
+			Description: embedder.Description(),
+			Fingerprint: embedder.Fingerprint(),
+		},
+	}, nil
+}
+
+// classify matches the request's prompt against the items under its embed path
+func (e *engine) classify(req classifyRequest) (classifyResult, error) {
+	result := classifyResult{Models: modelInfo{Embedding: e.info}}
+
+	mode := req.Mode
+	if mode == "" {
+		mode = classifier.ModeEmbedding
+	}
+	if err := classifier.ValidateMode(mode); err != nil {
+		return result, err
+	}
+
+	chunking := classifier.ChunkOptions{
+		Size:      req.ChunkSize,
+		Overlap:   req.ChunkOverlap,
+		Aggregate: req.ChunkAggregate,
+		TopK:      req.ChunkTopK,
+	}
+
+	start := time.Now()
+	items, diagnostics, err := e.loadItems(&req, &chunking)
+	result.Diagnostics = diagnostics
+	if err != nil {
+		return result, err
+	}
+
+	thresholds, err := requestThresholds(req)
+	if err != nil {
+		return result, err
+	}
+	result.Timings.ItemsMs = millisSince(start)
+
+	// llama.cpp contexts are not safe for concurrent use
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if mode != classifier.ModeEmbedding {
+		if err := e.llm.load(); err != nil {
+			return result, err
+		}
+		result.Models.LLM = e.llm.info
+	}
+
+	writes := classifier.CacheWrites()
+	defer enforceCacheLimit(req.MaxCacheSize, writes)
+
+	classified, err := e.classifier.Classify(context.Background(), classifier.Request{
+		Prompt:       req.Prompt,
+		Mode:         mode,
+		Threshold:    req.Threshold,
+		Thresholds:   thresholds,
+		LLMThreshold: req.LLMThreshold,
+		Shortlist:    req.Shortlist,
+		Chunking:     chunking,
+		Selection: classifier.Selection{
+			TopK:       req.TopK,
+			MinMargin:  req.MinMargin,
+			MaxPerType: req.MaxPerType,
+		},
+		Explain:    req.Explain,
+		ExplainAll: req.ExplainAll,
+	}, items)
+	result.Matches = classified.Matches
+	result.Explanations = classified.Explanations
+	result.Diagnostics = append(result.Diagnostics, classified.Diagnostics...)
+	result.Prompt = classified.Prompt
+	result.Timings.EmbedPromptMs = float64(classified.EmbedPrompt.Microseconds()) / 1000
+	result.Timings.MatchMs = float64(classified.Match.Microseconds()) / 1000
+
+	return result, err
+}
+
+// loadItems returns the items of the request's index, or of its embed file
+// or directory, limited to its output type. An index replaces req.Embed
+// with the directory it was built from and chunking's size and overlap
+// with the settings its texts were chunked with.
+func (e *engine) loadItems(req *classifyRequest, chunking *classifier.ChunkOptions) ([]classifier.Item, []classifier.Diagnostic, error) {
+	var items []classifier.Item
+	var diagnostics []classifier.Diagnostic
+	if req.Index != "" {
+		idx, err := classifier.LoadIndex(req.Index)
+		if err != nil {
+			return nil, nil, err
+		}
+		if idx.Model != e.info.indexModel() {
+			return nil, nil, fmt.Errorf("index %s was built with %s, not %s: run index build again", req.Index, idx.Model, e.info.indexModel())
+		}
+
+		// The texts in the index were chunked with its settings
+		req.Embed = idx.Root
+		chunking.Size, chunking.Overlap = idx.Chunking.Size, idx.Chunking.Overlap
+		items, diagnostics = e.classifier.UseIndex(idx)
+	} else {
+		var err error
+		items, diagnostics, err = classifier.ScanItems(req.Embed)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load items: %w", err)
+		}
+
+		// A checked-in index spares embedding the items that did not change
+		if diagnostic := e.useProjectIndex(req.Embed); diagnostic != nil {
+			diagnostics = append(diagnostics, *diagnostic)
+		}
+	}
+
+	// Only the requested types are embedded and scored
+	items, err := classifier.FilterByOutputType(items, req.OutputType)
+	return items, diagnostics, err
+}
+
+// useProjectIndex makes the vectors of <embed>/intent-index.bin resident.
+// Only items whose content still hashes the same find their texts in it;
+// the others are embedded as usual. An index that cannot be used is
+// reported as a diagnostic.
+func (e *engine) useProjectIndex(embed string) *classifier.Diagnostic {
+	path := filepath.Join(embed, classifier.IndexFileName)
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+
+	idx, err := classifier.LoadIndex(path)
+	if err != nil {
+		return &classifier.Diagnostic{Path: path, Message: err.Error()}
+	}
+	if idx.Model != e.info.indexModel() {
+		return &classifier.Diagnostic{Path: path, Message: fmt.Sprintf("index built with %s, not %s", idx.Model, e.info.indexModel())}
+	}
+	e.classifier.UseIndex(idx)
+	return nil
+}
+
+// requestThresholds combines the thresholds from the request's config file
+// with its type threshold flags. Without an explicit config the embed
+// directory's intent-classifier.yaml is used if there is one.
+func requestThresholds(req classifyRequest) (classifier.Thresholds, error) {
+	path := req.Config
+	if path == "" {
+		candidate := filepath.Join(req.Embed, classifier.ConfigFileName)
+		if _, err := os.Stat(candidate); err == nil {
+			path = candidate
+		}
+	}
+
+	var config classifier.Config
+	if path != "" {
+		var err error
+		config, err = classifier.LoadConfig(path)
+		if err != nil {
+			return classifier.Thresholds{}, err
+		}
+	}
+
+	return config.Thresholds.Merge(classifier.Thresholds{Flags: req.TypeThresholds}), nil
+}
+
+// close releases the models and the llama.cpp backend
+func (e *engine) close() {
+	e.llm.close()
+	e.embedder.Close()
+	classifier.FreeLlama()
+}
+
+// lazyScorer loads the LLM on first use, so embedding-only runs never pay for it
+type lazyScorer struct {
+	spec    string
+	offline bool
+	scorer  *classifier.LlamaScorer
+	info    *modelIdentity
+}
+
+// load resolves and loads the LLM unless it is already loaded
+func (s *lazyScorer) load() error {
+	if s.scorer != nil {
+		return nil
+	}
+
+	modelPath, err := resolveModel(s.spec, "llm", s.offline)
+	if err != nil {
+		return err
+	}
+	s.scorer, err = classifier.NewLlamaScorer(modelPath)
+	if err != nil {
+		return err
+	}
+	s.info = &modelIdentity{
+		Spec:        s.spec,
+		File:        s.scorer.File(),
+		Description: s.scorer.Description(),
+		Fingerprint: s.scorer.Fingerprint(),
+	}
+	return nil
+}
+
+// Score implements classifier.Scorer
+func (s *lazyScorer) Score(ctx context.Context, prompt string, item classifier.Item) (float32, error) {
+	if err := s.load(); err != nil {
+		return 0, err
+	}
+	return s.scorer.Score(ctx, prompt, item)
+}
+
+// close releases the LLM if it was loaded
+func (s *lazyScorer) close() {
+	if s.scorer != nil {
+		s.scorer.Close()
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"intent-classifier/classifier"
+)
+
+func TestRequestThresholds(t *testing.T) {
+	embed := t.TempDir()
+	config := "thresholds:\n  types:\n    agent: 0.35\n    skill: 0.25\n  priorities:\n    critical: 0.1\n  items:\n    database-expert: 0.5\n"
+	if err := os.WriteFile(filepath.Join(embed, classifier.ConfigFileName), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("config in embed directory", func(t *testing.T) {
+		thresholds, err := requestThresholds(classifyRequest{Embed: embed})
+		if err != nil {
+			t.Fatalf("requestThresholds() error = %v", err)
+		}
+		if thresholds.Types["agent"] != 0.35 || thresholds.Items["database-expert"] != 0.5 {
+			t.Errorf("unexpected thresholds %+v", thresholds)
+		}
+	})
+
+	t.Run("flags override the config", func(t *testing.T) {
+		thresholds, err := requestThresholds(classifyRequest{Embed: embed, TypeThresholds: map[string]float32{"agent": 0.6}})
+		if err != nil {
+			t.Fatalf("requestThresholds() error = %v", err)
+		}
+		// Flags get their own level, so they also beat priorities and items
+		if thresholds.Flags["agent"] != 0.6 || thresholds.Types["agent"] != 0.35 || thresholds.Priorities["critical"] != 0.1 {
+			t.Errorf("unexpected thresholds %+v", thresholds)
+		}
+	})
+
+	t.Run("no config", func(t *testing.T) {
+		thresholds, err := requestThresholds(classifyRequest{Embed: t.TempDir()})
+		if err != nil || thresholds.Types != nil || thresholds.Items != nil {
+			t.Errorf("requestThresholds() = %+v, %v", thresholds, err)
+		}
+	})
+
+	t.Run("missing explicit config", func(t *testing.T) {
+		if _, err := requestThresholds(classifyRequest{Embed: embed, Config: filepath.Join(embed, "missing.yaml")}); err == nil {
+			t.Error("expected error for a missing --config file")
+		}
+	})
+}
+
+func TestUseProjectIndex(t *testing.T) {
+	e := &engine{classifier: classifier.New(nil, nil), info: modelIdentity{File: "model.gguf", Description: "bert 22M"}}
+
+	embed := t.TempDir()
+	if d := e.useProjectIndex(embed); d != nil {
+		t.Errorf("expected no diagnostic without an index, got %s", d)
+	}
+
+	path := filepath.Join(embed, classifier.IndexFileName)
+	if err := classifier.SaveIndex(path, &classifier.Index{Root: embed, Model: "other.gguf (bert 22M)", Preprocess: classifier.PreprocessVersion}); err != nil {
+		t.Fatal(err)
+	}
+	if d := e.useProjectIndex(embed); d == nil || !strings.Contains(d.Message, "other.gguf") {
+		t.Errorf("expected a model mismatch diagnostic, got %v", d)
+	}
+
+	if err := os.WriteFile(path, []byte("not an index"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if d := e.useProjectIndex(embed); d == nil || d.Path != path {
+		t.Errorf("expected a diagnostic for a corrupt index, got %v", d)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"intent-classifier/classifier"
+)
+
+// datasetOptions holds the settings of the subcommands that classify the
+// prompts of a labelled dataset
+type datasetOptions struct {
+	classifyOptions
+	Dataset string
+	Format  string
+
+	threshold    float64
+	llmThreshold float64
+	minMargin    float64
+	explainAll   bool // explain every item, see classifier.Request.ExplainAll
+}
+
+// datasetFlagEnv maps the flags of addDatasetFlags and addMatchFlags to the
+// environment variables the CLI reads for them, so a dataset is classified
+// the way the hook classifies prompts
+var datasetFlagEnv = map[string]string{
+	"threshold":     "IC_THRESHOLD",
+	"mode":          "IC_MODE",
+	"llm-threshold": "IC_LLM_THRESHOLD",
+	"config":        "IC_CONFIG",
+}
+
+// addDatasetFlags registers the dataset, the items and the classification
+// settings
+func addDatasetFlags(fs *flag.FlagSet, opts *datasetOptions) {
+	fs.StringVar(&opts.Dataset, "dataset", "", "YAML file of labelled prompts (required)")
+	fs.StringVar(&opts.Embed, "embed", ".claude", "File or directory of items to classify against")
+	fs.StringVar(&opts.Index, "index", "", "Index file built by \"index build\" to use instead of --embed")
+	fs.Float64Var(&opts.threshold, "threshold", 0.2, "Similarity threshold (env: IC_THRESHOLD)")
+	fs.StringVar(&opts.Config, "config", "", "Config file with threshold overrides (default: <embed>/intent-classifier.yaml, env: IC_CONFIG)")
+	fs.StringVar(&opts.Format, "format", formatText, "Report format: text or json")
+	addEngineFlags(fs, &opts.classifyOptions)
+	addMaxCacheSizeFlag(fs, &opts.MaxCacheSize)
+}
+
+// addMatchFlags registers the mode and selection settings, which decide
+// what matches beyond the thresholds
+func addMatchFlags(fs *flag.FlagSet, opts *datasetOptions) {
+	fs.StringVar(&opts.Mode, "mode", classifier.ModeEmbedding, "Matching mode: embedding, llm, or hybrid (env: IC_MODE)")
+	fs.Float64Var(&opts.llmThreshold, "llm-threshold", 0.5, "LLM confidence threshold for llm/hybrid modes (env: IC_LLM_THRESHOLD)")
+	fs.IntVar(&opts.Shortlist, "shortlist", 5, "Hybrid mode: max embedding matches sent to the LLM")
+	fs.IntVar(&opts.TopK, "top-k", 0, "Keep at most this many matches, best first (0 = no limit)")
+	fs.Float64Var(&opts.minMargin, "min-margin", 0, "Keep matches within this distance of the best score (0 = no limit)")
+}
+
+// parseDatasetFlags parses args, applies the environment and validates the
+// settings
+func parseDatasetFlags(fs *flag.FlagSet, opts *datasetOptions, args []string) error {
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	flagsSet := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		flagsSet[f.Name] = true
+	})
+	for name, env := range datasetFlagEnv {
+		if value := os.Getenv(env); value != "" && fs.Lookup(name) != nil && !flagsSet[name] {
+			if err := fs.Set(name, value); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Invalid %s env var '%s', using default\n", env, value)
+			}
+		}
+	}
+	applyEngineEnv(fs, &opts.classifyOptions)
+
+	if opts.Dataset == "" {
+		fs.Usage()
+		return errors.New("--dataset is required")
+	}
+	if opts.Format != formatText && opts.Format != formatJSON {
+		return fmt.Errorf("invalid format %q: must be one of text, json", opts.Format)
+	}
+	if err := classifier.ValidateMode(opts.Mode); err != nil {
+		return err
+	}
+	opts.Threshold = float32(opts.threshold)
+	opts.LLMThreshold = float32(opts.llmThreshold)
+	opts.MinMargin = float32(opts.minMargin)
+	return classifier.Selection{TopK: opts.TopK, MinMargin: opts.MinMargin}.Validate()
+}
+
+// classifyDataset loads the engine and the dataset's items, checks that
+// every item the dataset names exists and classifies each case. The
+// returned results are in the order of the cases.
+func classifyDataset(opts datasetOptions, dataset classifier.Dataset) ([]classifier.Item, []classifyResult, error) {
+	eng, err := newEngine(opts.classifyOptions)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer eng.close()
+
+	req := opts.request("")
+	req.ExplainAll = opts.explainAll
+	itemsReq, chunking := req, classifier.ChunkOptions{}
+	items, diagnostics, err := eng.loadItems(&itemsReq, &chunking)
+	warnDiagnostics(diagnostics)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := dataset.CheckItems(items); err != nil {
+		return nil, nil, err
+	}
+
+	warned := make(map[string]bool)
+	for _, d := range diagnostics {
+		warned[d.String()] = true
+	}
+	results, err := classifyCases(eng, req, dataset.Cases, warned)
+	return items, results, err
+}
+
+// classifyCases classifies the prompt of each case with the settings of req.
+// Diagnostics are warned about once, unless warned already has them.
+func classifyCases(handler requestHandler, req classifyRequest, cases []classifier.EvalCase, warned map[string]bool) ([]classifyResult, error) {
+	if warned == nil {
+		warned = make(map[string]bool)
+	}
+	results := make([]classifyResult, len(cases))
+	for i, c := range cases {
+		req.Prompt = c.Prompt
+		result, err := handler.classify(req)
+		for _, d := range result.Diagnostics {
+			if !warned[d.String()] {
+				warned[d.String()] = true
+				warnDiagnostics([]classifier.Diagnostic{d})
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("case %q: %w", c.Name, err)
+		}
+		results[i] = result
+	}
+	return results, nil
+}
+
+// runEval implements the "eval" subcommand
+func runEval(args []string) error {
+	fs := flag.NewFlagSet("eval", flag.ExitOnError)
+	var opts datasetOptions
+	addDatasetFlags(fs, &opts)
+	addMatchFlags(fs, &opts)
+	var gates classifier.Gates
+	fs.Float64Var(&gates.Precision, "min-precision", 0, "Fail below this micro-averaged precision (default: the dataset's gates)")
+	fs.Float64Var(&gates.Recall, "min-recall", 0, "Fail below this micro-averaged recall (default: the dataset's gates)")
+	fs.Float64Var(&gates.MicroF1, "min-micro-f1", 0, "Fail below this micro F1 (default: the dataset's gates)")
+	fs.Float64Var(&gates.MacroF1, "min-macro-f1", 0, "Fail below this macro F1 (default: the dataset's gates)")
+	fs.Float64Var(&gates.MRR, "min-mrr", 0, "Fail below this mean reciprocal rank (default: the dataset's gates)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s eval --dataset cases.yaml [options]\n\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Classifies every prompt of a labelled dataset and reports per-item precision")
+		fmt.Fprintln(os.Stderr, "and recall, micro and macro F1, MRR and the false positives and negatives.")
+		fmt.Fprintln(os.Stderr, "Exits non-zero when a quality gate is not met.")
+		fmt.Fprintln(os.Stderr, "")
+		fs.PrintDefaults()
+	}
+	if err := parseDatasetFlags(fs, &opts, args); err != nil {
+		return err
+	}
+
+	dataset, err := classifier.LoadDataset(opts.Dataset)
+	if err != nil {
+		return err
+	}
+	gates = mergeGates(dataset.Gates, gates, fs)
+
+	_, results, err := classifyDataset(opts, dataset)
+	if err != nil {
+		return err
+	}
+	matches := make([][]classifier.Match, len(results))
+	for i, result := range results {
+		matches[i] = result.Matches
+	}
+	report := classifier.Evaluate(dataset.Cases, matches)
+
+	if opts.Format == formatJSON {
+		err = writeEvalJSON(os.Stdout, report, gates)
+	} else {
+		writeEvalReport(os.Stdout, report, opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	if failed := report.CheckGates(gates); len(failed) > 0 {
+		return fmt.Errorf("quality gates failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// mergeGates returns the dataset's gates overridden by the --min-* flags
+// that were given
+func mergeGates(dataset, flags classifier.Gates, fs *flag.FlagSet) classifier.Gates {
+	gates := dataset
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "min-precision":
+			gates.Precision = flags.Precision
+		case "min-recall":
+			gates.Recall = flags.Recall
+		case "min-micro-f1":
+			gates.MicroF1 = flags.MicroF1
+		case "min-macro-f1":
+			gates.MacroF1 = flags.MacroF1
+		case "min-mrr":
+			gates.MRR = flags.MRR
+		}
+	})
+	return gates
+}
+
+// evalJSON is the document written by eval --format json
+type evalJSON struct {
+	SchemaVersion int              `json:"schema_version"`
+	Gates         classifier.Gates `json:"gates"`
+	Failed        []string         `json:"failed_gates"`
+	classifier.EvalReport
+}
+
+// writeEvalJSON writes the report and the gates it was checked against
+func writeEvalJSON(w io.Writer, report classifier.EvalReport, gates classifier.Gates) error {
+	failed := report.CheckGates(gates)
+	if failed == nil {
+		failed = []string{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(evalJSON{SchemaVersion: outputSchemaVersion, Gates: gates, Failed: failed, EvalReport: report})
+}
+
+// writeEvalReport prints the report for humans
+func writeEvalReport(w io.Writer, report classifier.EvalReport, opts datasetOptions) {
+	fmt.Fprintf(w, "📊 Evaluated %d case%s (%s mode, threshold %.2f)\n\n", report.Cases, plural(report.Cases), opts.Mode, opts.Threshold)
+
+	width := len("item")
+	for _, s := range report.Items {
+		width = max(width, len(s.Name))
+	}
+	fmt.Fprintf(w, "%-*s  %9s  %6s  %5s  %3s  %3s  %3s\n", width, "item", "precision", "recall", "f1", "tp", "fp", "fn")
+	for _, s := range report.Items {
+		precision := metric(s.Precision, s.TruePositives+s.FalsePositives)
+		recall := metric(s.Recall, s.TruePositives+s.FalseNegatives)
+		f1 := metric(s.F1, s.TruePositives+s.FalsePositives+s.FalseNegatives)
+		fmt.Fprintf(w, "%-*s  %9s  %6s  %5s  %3d  %3d  %3d\n", width, s.Name, precision, recall, f1, s.TruePositives, s.FalsePositives, s.FalseNegatives)
+	}
+
+	fmt.Fprintf(w, "\nMicro  precision %.2f  recall %.2f  F1 %.2f\n", report.Precision, report.Recall, report.MicroF1)
+	fmt.Fprintf(w, "Macro  F1 %.2f\n", report.MacroF1)
+	fmt.Fprintf(w, "MRR    %.2f\n", report.MRR)
+
+	if len(report.FalsePositives) > 0 {
+		fmt.Fprintf(w, "\n❌ False positives (%d):\n", len(report.FalsePositives))
+		for _, c := range report.FalsePositives {
+			fmt.Fprintf(w, "   %s on %q: rank %d, %.3f ≥ %.3f\n", c.Item, c.Case, c.Rank, c.Similarity, c.Threshold)
+		}
+	}
+	if len(report.FalseNegatives) > 0 {
+		fmt.Fprintf(w, "\n⚠️  False negatives (%d):\n", len(report.FalseNegatives))
+		for _, c := range report.FalseNegatives {
+			fmt.Fprintf(w, "   %s on %q: not matched\n", c.Item, c.Case)
+		}
+	}
+}
+
+// metric formats a score, or "-" when it is undefined because its
+// denominator is zero
+func metric(value float64, denominator int) string {
+	if denominator == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", value)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"strings"
+	"testing"
+
+	"intent-classifier/classifier"
+)
+
+func TestClassifyCases(t *testing.T) {
+	cases := []classifier.EvalCase{{Name: "tests", Prompt: "run my tests"}}
+	handler := &fakeHandler{matches: []classifier.Match{{Name: "testing-agent"}}}
+
+	results, err := classifyCases(handler, classifyRequest{Embed: "/items", Threshold: 0.3}, cases, nil)
+	if err != nil {
+		t.Fatalf("classifyCases() error = %v", err)
+	}
+	if len(results) != 1 || len(results[0].Matches) != 1 || results[0].Matches[0].Name != "testing-agent" {
+		t.Errorf("classifyCases() = %+v", results)
+	}
+	if handler.got.Prompt != "run my tests" || handler.got.Embed != "/items" || handler.got.Threshold != 0.3 {
+		t.Errorf("handler got request %+v", handler.got)
+	}
+
+	handler.err = errors.New("model failed")
+	if _, err := classifyCases(handler, classifyRequest{}, cases, nil); err == nil || !strings.Contains(err.Error(), `case "tests"`) {
+		t.Errorf("expected the failing case to be named, got %v", err)
+	}
+}
+
+func TestMergeGates(t *testing.T) {
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	var flags classifier.Gates
+	fs.Float64Var(&flags.MicroF1, "min-micro-f1", 0, "")
+	fs.Float64Var(&flags.MRR, "min-mrr", 0, "")
+	if err := fs.Parse([]string{"--min-mrr", "0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// An explicit 0 disables a gate of the dataset, others are kept
+	gates := mergeGates(classifier.Gates{MicroF1: 0.8, MRR: 0.7}, flags, fs)
+	if gates.MicroF1 != 0.8 || gates.MRR != 0 {
+		t.Errorf("mergeGates() = %+v", gates)
+	}
+}
+
+func TestWriteEvalReport(t *testing.T) {
+	report := classifier.EvalReport{
+		Cases: 2,
+		Items: []classifier.ItemScore{
+			{Name: "python-agent", TruePositives: 1, FalsePositives: 1, Precision: 0.5, Recall: 1, F1: 0.667},
+			{Name: "fitness-skill"},
+		},
+		MicroF1:        0.5,
+		FalsePositives: []classifier.Confusion{{Case: "gym", Item: "python-agent", Rank: 1, Similarity: 0.25, Threshold: 0.2}},
+		FalseNegatives: []classifier.Confusion{{Case: "tests", Item: "testing-agent"}},
+	}
+	var opts datasetOptions
+	opts.Mode = classifier.ModeEmbedding
+	opts.Threshold = 0.2
+
+	var buf bytes.Buffer
+	writeEvalReport(&buf, report, opts)
+	out := buf.String()
+	for _, want := range []string{
+		"📊 Evaluated 2 cases (embedding mode, threshold 0.20)",
+		"python-agent        0.50    1.00   0.67    1    1    0",
+		"fitness-skill          -       -      -    0    0    0",
+		"F1 0.50",
+		`python-agent on "gym": rank 1, 0.250 ≥ 0.200`,
+		`testing-agent on "tests": not matched`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report does not contain %q:\n%s", want, out)
+		}
+	}
+}
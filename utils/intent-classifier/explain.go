@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"intent-classifier/classifier"
+)
+
+// explainExcerptChars bounds how much of the winning chunk is printed
+const explainExcerptChars = 120
+
+// writeExplanations prints how every item was scored for --explain
+func writeExplanations(w io.Writer, explanations []classifier.Explanation) {
+	if len(explanations) == 0 {
+		fmt.Fprintln(w, "🔍 No embedding matches to explain")
+		return
+	}
+
+	for _, e := range explanations {
+		if e.Suppressed {
+			fmt.Fprintf(w, "🚫 %s: %.3f suppressed, not_for scored %.3f: %s\n", e.Name, e.Similarity, e.NegativeScore, excerpt(e.NegativeExample, explainExcerptChars))
+			continue
+		}
+		fmt.Fprintf(w, "🔍 %s: %.3f (body %.3f, %s of %d chunk%s)\n", e.Name, e.Similarity, e.BodyScore, e.Aggregate, e.Chunks, plural(e.Chunks))
+		fmt.Fprintf(w, "   threshold %.3f (%s), %s\n", e.Threshold, e.ThresholdSource, matchStatus(e))
+		fmt.Fprintf(w, "   decided by the %s, %s\n", e.Winner, textDetails(e))
+		if e.Chunks > 0 {
+			fmt.Fprintf(w, "   best chunk %d/%d scored %.3f: %s\n", e.Chunk+1, e.Chunks, e.ChunkScore, excerpt(e.ChunkText, explainExcerptChars))
+		}
+		if e.Example != "" {
+			fmt.Fprintf(w, "   best example scored %.3f: %s\n", e.ExampleScore, excerpt(e.Example, explainExcerptChars))
+		}
+		if e.NegativeExample != "" {
+			fmt.Fprintf(w, "   closest not_for scored %.3f: %s\n", e.NegativeScore, excerpt(e.NegativeExample, explainExcerptChars))
+		}
+	}
+}
+
+// writeWhy prints everything about how the item called name was scored
+// for --why, including the prompt as it was embedded and the full text of
+// the winning chunk
+func writeWhy(w io.Writer, name string, result classifyResult) error {
+	var e *classifier.Explanation
+	for i := range result.Explanations {
+		if result.Explanations[i].Name == name {
+			e = &result.Explanations[i]
+			break
+		}
+	}
+	if e == nil {
+		return fmt.Errorf("no item named %q was scored (check the name, --output-type and that --mode is not llm)", name)
+	}
+
+	fmt.Fprintf(w, "🔎 %s (%s)\n", e.Name, e.Path)
+	fmt.Fprintf(w, "   prompt as embedded: %q\n", result.Prompt)
+	fmt.Fprintf(w, "   similarity %.3f, threshold %.3f (%s): %s\n", e.Similarity, e.Threshold, e.ThresholdSource, matchStatus(*e))
+	fmt.Fprintf(w, "   body %.3f (%s of %d chunk%s), decided by the %s\n", e.BodyScore, e.Aggregate, e.Chunks, plural(e.Chunks), e.Winner)
+	fmt.Fprintf(w, "   %s\n", textDetails(*e))
+	if e.Chunks > 0 {
+		fmt.Fprintf(w, "   best chunk %d/%d scored %.3f:\n      %s\n", e.Chunk+1, e.Chunks, e.ChunkScore, e.ChunkText)
+	}
+	if e.Example != "" {
+		fmt.Fprintf(w, "   best example scored %.3f: %s\n", e.ExampleScore, e.Example)
+	}
+	if e.NegativeExample != "" {
+		fmt.Fprintf(w, "   closest not_for scored %.3f: %s\n", e.NegativeScore, e.NegativeExample)
+	}
+	return nil
+}
+
+// matchStatus says whether an explained item matched, and if not why
+func matchStatus(e classifier.Explanation) string {
+	switch {
+	case e.Suppressed:
+		return "suppressed by not_for"
+	case e.Similarity < e.Threshold:
+		return fmt.Sprintf("below it by %.3f", e.Threshold-e.Similarity)
+	case e.Dropped != "":
+		return fmt.Sprintf("dropped by %s limit", e.Dropped)
+	}
+	return "matched"
+}
+
+// textDetails describes the preprocessed text of an explained item and
+// where its vectors came from
+func textDetails(e classifier.Explanation) string {
+	details := fmt.Sprintf("text %d chars", e.TextLength)
+	if e.Truncated {
+		details += ", truncated by the embedding model"
+	}
+	if e.Cached {
+		return details + ", vectors from cache"
+	}
+	return details + ", vectors embedded now"
+}
+
+// plural returns "s" unless n is one
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+// excerpt shortens text to at most n bytes on a rune boundary
+func excerpt(text string, n int) string {
+	if len(text) <= n {
+		return text
+	}
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	return text[:n] + "…"
+}
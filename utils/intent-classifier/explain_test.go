@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"intent-classifier/classifier"
+)
+
+func TestWriteExplanations(t *testing.T) {
+	var buf bytes.Buffer
+	writeExplanations(&buf, []classifier.Explanation{{
+		Name:         "python-expert",
+		Similarity:   0.74,
+		BodyScore:    0.61,
+		Aggregate:    classifier.AggregateMax,
+		Chunk:        2,
+		Chunks:       4,
+		ChunkScore:   0.61,
+		ChunkText:    strings.Repeat("django ", 40),
+		Example:      "build a django app",
+		ExampleScore: 0.74,
+
+		Threshold:       0.35,
+		ThresholdSource: classifier.ThresholdType,
+
+		Winner:     classifier.WinnerExample,
+		TextLength: 280,
+		Truncated:  true,
+		Cached:     true,
+	}, {
+		Name:            "go-expert",
+		Similarity:      0.19,
+		BodyScore:       0.19,
+		Aggregate:       classifier.AggregateMax,
+		Chunks:          1,
+		Threshold:       0.2,
+		ThresholdSource: classifier.ThresholdDefault,
+		Winner:          classifier.WinnerBody,
+		TextLength:      42,
+	}, {
+		Name:            "database-expert",
+		Similarity:      0.42,
+		NegativeExample: "my database migration broke the build",
+		NegativeScore:   0.58,
+		Suppressed:      true,
+	}})
+
+	result := buf.String()
+	for _, want := range []string{"python-expert: 0.740 (body 0.610, max of 4 chunks)", "threshold 0.350 (type), matched", "decided by the example, text 280 chars, truncated by the embedding model, vectors from cache", "threshold 0.200 (default), below it by 0.010", "decided by the body, text 42 chars, vectors embedded now", "best chunk 3/4 scored 0.610", "…", "best example scored 0.740: build a django app", "🚫 database-expert: 0.420 suppressed, not_for scored 0.580: my database migration broke the build"} {
+		if !strings.Contains(result, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, result)
+		}
+	}
+
+	buf.Reset()
+	writeExplanations(&buf, nil)
+	if !strings.Contains(buf.String(), "No embedding matches") {
+		t.Errorf("unexpected output for no explanations: %q", buf.String())
+	}
+}
+
+func TestWriteWhy(t *testing.T) {
+	chunk := strings.Repeat("django ", 40)
+	result := classifyResult{
+		Prompt: "build django app",
+		Explanations: []classifier.Explanation{{
+			Name:            "python-expert",
+			Path:            "/skills/python.md",
+			Similarity:      0.61,
+			BodyScore:       0.61,
+			Aggregate:       classifier.AggregateMax,
+			Chunks:          2,
+			ChunkScore:      0.61,
+			ChunkText:       chunk,
+			Threshold:       0.3,
+			ThresholdSource: classifier.ThresholdItem,
+			Dropped:         "top-k",
+			Winner:          classifier.WinnerBody,
+			TextLength:      512,
+		}},
+	}
+
+	var buf bytes.Buffer
+	if err := writeWhy(&buf, "python-expert", result); err != nil {
+		t.Fatalf("writeWhy() error = %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"🔎 python-expert (/skills/python.md)",
+		`prompt as embedded: "build django app"`,
+		"similarity 0.610, threshold 0.300 (item): dropped by top-k limit",
+		"body 0.610 (max of 2 chunks), decided by the body",
+		"text 512 chars, vectors embedded now",
+		"best chunk 1/2 scored 0.610:\n      " + chunk + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+
+	if err := writeWhy(&buf, "pyhton-expert", result); err == nil || !strings.Contains(err.Error(), `"pyhton-expert"`) {
+		t.Errorf("expected an error naming the unknown item, got %v", err)
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	if got := excerpt("short", 10); got != "short" {
+		t.Errorf("excerpt() = %q", got)
+	}
+	// Never cuts a multi-byte rune in half
+	if got := excerpt("aé", 2); got != "a…" {
+		t.Errorf("excerpt() = %q, expected %q", got, "a…")
+	}
+}
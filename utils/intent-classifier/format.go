@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"intent-classifier/classifier"
+)
+
+// Output formats
+const (
+	formatText   = "text"   // emoji banner for humans and Claude's context
+	formatJSON   = "json"   // one document with all matches
+	formatNDJSON = "ndjson" // one match per line followed by a summary line
+)
+
+// outputSchemaVersion is bumped on incompatible changes to the JSON output
+const outputSchemaVersion = 1
+
+// validateFormat checks that format is a supported output format
+func validateFormat(format string) error {
+	switch format {
+	case formatText, formatJSON, formatNDJSON:
+		return nil
+	}
+	return fmt.Errorf("invalid format %q: must be one of text, json, ndjson", format)
+}
+
+// jsonOutput is the document written by --format json
+type jsonOutput struct {
+	SchemaVersion int                      `json:"schema_version"`
+	Mode          string                   `json:"mode"`
+	Threshold     float32                  `json:"threshold"`
+	LLMThreshold  *float32                 `json:"llm_threshold,omitempty"`
+	Models        modelInfo                `json:"models"`
+	Timings       timings                  `json:"timings_ms"`
+	Daemon        bool                     `json:"daemon"`
+	Matches       []classifier.Match       `json:"matches"`
+	Explain       []classifier.Explanation `json:"explain,omitempty"`
+	Prompt        string                   `json:"embedded_prompt,omitempty"` // with explain: the preprocessed prompt
+	Diagnostics   []classifier.Diagnostic  `json:"diagnostics,omitempty"`
+}
+
+// ndjsonMatch is a match line written by --format ndjson
+type ndjsonMatch struct {
+	SchemaVersion int    `json:"schema_version"`
+	Record        string `json:"record"` // always "match"
+	classifier.Match
+}
+
+// ndjsonSummary is the final line written by --format ndjson
+type ndjsonSummary struct {
+	SchemaVersion int                     `json:"schema_version"`
+	Record        string                  `json:"record"` // always "summary"
+	Mode          string                  `json:"mode"`
+	Threshold     float32                 `json:"threshold"`
+	LLMThreshold  *float32                `json:"llm_threshold,omitempty"`
+	Models        modelInfo               `json:"models"`
+	Timings       timings                 `json:"timings_ms"`
+	Daemon        bool                    `json:"daemon"`
+	MatchCount    int                     `json:"match_count"`
+	Diagnostics   []classifier.Diagnostic `json:"diagnostics,omitempty"`
+}
+
+// llmThresholdFor reports the LLM threshold only for modes that use it
+func llmThresholdFor(req classifyRequest) *float32 {
+	if req.Mode != classifier.ModeLLM && req.Mode != classifier.ModeHybrid {
+		return nil
+	}
+	threshold := req.LLMThreshold
+	return &threshold
+}
+
+// writeJSON writes result as a single versioned JSON document
+func writeJSON(w io.Writer, result classifyResult, req classifyRequest) error {
+	matches := result.Matches
+	if matches == nil {
+		matches = []classifier.Match{} // always an array for consumers
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(jsonOutput{
+		SchemaVersion: outputSchemaVersion,
+		Mode:          req.Mode,
+		Threshold:     req.Threshold,
+		LLMThreshold:  llmThresholdFor(req),
+		Models:        result.Models,
+		Timings:       result.Timings,
+		Daemon:        result.Daemon,
+		Matches:       matches,
+		Explain:       result.Explanations,
+		Prompt:        result.Prompt,
+		Diagnostics:   result.Diagnostics,
+	})
+}
+
+// writeNDJSON writes one line per match followed by a summary line
+func writeNDJSON(w io.Writer, result classifyResult, req classifyRequest) error {
+	encoder := json.NewEncoder(w)
+	for _, match := range result.Matches {
+		if err := encoder.Encode(ndjsonMatch{
+			SchemaVersion: outputSchemaVersion,
+			Record:        "match",
+			Match:         match,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return encoder.Encode(ndjsonSummary{
+		SchemaVersion: outputSchemaVersion,
+		Record:        "summary",
+		Mode:          req.Mode,
+		Threshold:     req.Threshold,
+		LLMThreshold:  llmThresholdFor(req),
+		Models:        result.Models,
+		Timings:       result.Timings,
+		Daemon:        result.Daemon,
+		MatchCount:    len(result.Matches),
+		Diagnostics:   result.Diagnostics,
+	})
+}
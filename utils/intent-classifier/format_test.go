@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"intent-classifier/classifier"
+)
+
+func TestValidateFormat(t *testing.T) {
+	for _, format := range []string{formatText, formatJSON, formatNDJSON} {
+		if err := validateFormat(format); err != nil {
+			t.Errorf("validateFormat(%q) error = %v", format, err)
+		}
+	}
+	if err := validateFormat("yaml"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func testResult() classifyResult {
+	return classifyResult{
+		Matches: []classifier.Match{
+			{Name: "python-expert", Path: "skills/high-skill.md", Similarity: 0.42, Priority: "high", Type: "skill"},
+			{Name: "code-analyzer", Path: "agents/medium-reviewer.md", Similarity: 0.31, Priority: "medium", Type: "agent"},
+		},
+		Models:  modelInfo{Embedding: modelIdentity{Spec: "model.gguf", File: "model.gguf", Description: "bert 22M"}},
+		Timings: timings{EmbedPromptMs: 3, MatchMs: 5, TotalMs: 9},
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	req := classifyRequest{Mode: classifier.ModeEmbedding, Threshold: 0.3}
+	if err := writeJSON(&buf, testResult(), req); err != nil {
+		t.Fatalf("writeJSON() error = %v", err)
+	}
+
+	var decoded map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+
+	if decoded["schema_version"] != float64(outputSchemaVersion) {
+		t.Errorf("schema_version = %v", decoded["schema_version"])
+	}
+	if _, ok := decoded["llm_threshold"]; ok {
+		t.Errorf("llm_threshold must be omitted in embedding mode")
+	}
+
+	matches := decoded["matches"].([]any)
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 matches, got %d", len(matches))
+	}
+	first := matches[0].(map[string]any)
+	for _, field := range []string{"name", "path", "similarity", "priority", "type"} {
+		if _, ok := first[field]; !ok {
+			t.Errorf("match is missing %q: %v", field, first)
+		}
+	}
+}
+
+func TestWriteJSONNoMatches(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, classifyResult{}, classifyRequest{Mode: classifier.ModeLLM, LLMThreshold: 0.5}); err != nil {
+		t.Fatalf("writeJSON() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), `"matches": []`) {
+		t.Errorf("expected empty matches array, got %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), `"llm_threshold": 0.5`) {
+		t.Errorf("expected llm_threshold in llm mode, got %s", buf.String())
+	}
+}
+
+func TestWriteNDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeNDJSON(&buf, testResult(), classifyRequest{Mode: classifier.ModeEmbedding, Threshold: 0.3}); err != nil {
+		t.Fatalf("writeNDJSON() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d: %q", len(lines), buf.String())
+	}
+
+	var match map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &match); err != nil {
+		t.Fatalf("line 1 is not valid JSON: %v", err)
+	}
+	if match["record"] != "match" || match["name"] != "python-expert" {
+		t.Errorf("unexpected match line: %v", match)
+	}
+
+	var summary map[string]any
+	if err := json.Unmarshal([]byte(lines[2]), &summary); err != nil {
+		t.Fatalf("summary is not valid JSON: %v", err)
+	}
+	if summary["record"] != "summary" || summary["match_count"] != float64(2) {
+		t.Errorf("unexpected summary line: %v", summary)
+	}
+}
@@ -4,6 +4,7 @@ go 1.24.0
 
 require (
 	github.com/hybridgroup/yzma v0.8.2-0.20251106124048-a08590464884
+	golang.org/x/sys v0.36.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
@@ -21,5 +22,4 @@ require (
 	github.com/mitchellh/go-homedir v1.0.0 // indirect
 	github.com/mitchellh/go-testing-interface v1.0.0 // indirect
 	github.com/ulikunitz/xz v0.5.8 // indirect
-	golang.org/x/sys v0.36.0 // indirect
 )
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// HookInput is the JSON payload Claude Code sends to a UserPromptSubmit hook on stdin
+type HookInput struct {
+	SessionID      string `json:"session_id"`
+	TranscriptPath string `json:"transcript_path"`
+	Cwd            string `json:"cwd"`
+	HookEventName  string `json:"hook_event_name"`
+	Prompt         string `json:"prompt"`
+}
+
+// HookOutput is the JSON response a UserPromptSubmit hook writes to stdout
+type HookOutput struct {
+	HookSpecificOutput HookSpecificOutput `json:"hookSpecificOutput"`
+}
+
+// HookSpecificOutput carries the context injected alongside the user prompt
+type HookSpecificOutput struct {
+	HookEventName     string `json:"hookEventName"`
+	AdditionalContext string `json:"additionalContext"`
+}
+
+// readHookInput decodes the hook payload from r
+func readHookInput(r io.Reader) (HookInput, error) {
+	var input HookInput
+	if err := json.NewDecoder(r).Decode(&input); err != nil {
+		return input, fmt.Errorf("invalid hook payload: %w", err)
+	}
+	return input, nil
+}
+
+// hookResponse builds the hook JSON response carrying additionalContext
+func hookResponse(eventName string, additionalContext string) ([]byte, error) {
+	if eventName == "" {
+		eventName = "UserPromptSubmit"
+	}
+	return json.Marshal(HookOutput{
+		HookSpecificOutput: HookSpecificOutput{
+			HookEventName:     eventName,
+			AdditionalContext: additionalContext,
+		},
+	})
+}
+
+// hookEmbedPath returns the directory to match against for a hook invocation.
+// An explicit -embed wins; otherwise the project's .claude directory is used.
+func hookEmbedPath(embed string, input HookInput) string {
+	if embed != "" {
+		return embed
+	}
+	if input.Cwd != "" {
+		return filepath.Join(input.Cwd, ".claude")
+	}
+	return ".claude"
+}
+
+// runHook handles a UserPromptSubmit hook invocation. It never blocks the
+// prompt: failures are reported on stderr and produce no output, which Claude
+// Code treats as "no additional context".
+func runHook(r io.Reader, w io.Writer, opts classifyOptions, tmpl *template.Template) {
+	input, err := readHookInput(r)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: intent-classifier hook: %v\n", err)
+		return
+	}
+
+	if input.Prompt == "" {
+		return
+	}
+
+	opts.Embed = hookEmbedPath(opts.Embed, input)
+
+	result, err := classify(input.Prompt, opts)
+	warnDiagnostics(result.Diagnostics)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: intent-classifier hook: %v\n", err)
+		return
+	}
+
+	if len(result.Matches) == 0 {
+		return
+	}
+
+	additionalContext, err := renderMatches(result.Matches, tmpl)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: intent-classifier hook: %v\n", err)
+		return
+	}
+
+	response, err := hookResponse(input.HookEventName, additionalContext)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: intent-classifier hook: %v\n", err)
+		return
+	}
+
+	fmt.Fprintln(w, string(response))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadHookInput(t *testing.T) {
+	tests := []struct {
+		name       string
+		payload    string
+		wantPrompt string
+		wantCwd    string
+		wantErr    bool
+	}{
+		{
+			name:       "full payload",
+			payload:    `{"session_id":"abc","transcript_path":"/tmp/t.jsonl","cwd":"/work","hook_event_name":"UserPromptSubmit","prompt":"review my \"python\" code"}`,
+			wantPrompt: `review my "python" code`,
+			wantCwd:    "/work",
+		},
+		{
+			name:       "unknown fields ignored",
+			payload:    `{"prompt":"hello","permission_mode":"default"}`,
+			wantPrompt: "hello",
+		},
+		{
+			name:    "invalid json",
+			payload: `{"prompt":`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, err := readHookInput(strings.NewReader(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readHookInput() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if input.Prompt != tt.wantPrompt {
+				t.Errorf("prompt = %q, expected %q", input.Prompt, tt.wantPrompt)
+			}
+			if input.Cwd != tt.wantCwd {
+				t.Errorf("cwd = %q, expected %q", input.Cwd, tt.wantCwd)
+			}
+		})
+	}
+}
+
+func TestHookResponse(t *testing.T) {
+	data, err := hookResponse("", "→ python-expert\n")
+	if err != nil {
+		t.Fatalf("hookResponse() error = %v", err)
+	}
+
+	var decoded map[string]map[string]string
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("response is not valid JSON: %v", err)
+	}
+
+	specific := decoded["hookSpecificOutput"]
+	if specific["hookEventName"] != "UserPromptSubmit" {
+		t.Errorf("hookEventName = %q, expected UserPromptSubmit", specific["hookEventName"])
+	}
+	if specific["additionalContext"] != "→ python-expert\n" {
+		t.Errorf("additionalContext = %q", specific["additionalContext"])
+	}
+
+	// A hook response must never block the prompt
+	if strings.Contains(string(data), "decision") {
+		t.Errorf("response must not contain a decision: %s", data)
+	}
+}
+
+func TestHookEmbedPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		embed    string
+		input    HookInput
+		expected string
+	}{
+		{
+			name:     "explicit embed wins",
+			embed:    "testdata",
+			input:    HookInput{Cwd: "/work"},
+			expected: "testdata",
+		},
+		{
+			name:     "defaults to project .claude",
+			input:    HookInput{Cwd: "/work"},
+			expected: filepath.Join("/work", ".claude"),
+		},
+		{
+			name:     "no cwd",
+			expected: ".claude",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := hookEmbedPath(tt.embed, tt.input)
+			if result != tt.expected {
+				t.Errorf("hookEmbedPath() = %q, expected %q", result, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"intent-classifier/classifier"
+)
+
+// runIndex implements the "index" subcommand
+func runIndex(args []string) error {
+	if len(args) == 0 || args[0] != "build" {
+		fmt.Fprintf(os.Stderr, "Usage: %s index build [options] [dir]\n", os.Args[0])
+		return errors.New("unknown index command: expected build")
+	}
+
+	fs := flag.NewFlagSet("index build", flag.ExitOnError)
+	var opts classifyOptions
+	addEngineFlags(fs, &opts)
+	addMaxCacheSizeFlag(fs, &opts.MaxCacheSize)
+	output := fs.String("output", "", "Index file to write (default: <dir>/"+classifier.IndexFileName+")")
+	chunkSize := fs.Int("chunk-size", classifier.DefaultChunkSize, "Tokens per chunk when embedding long items")
+	chunkOverlap := fs.Int("chunk-overlap", classifier.DefaultChunkOverlap, "Tokens shared by consecutive chunks")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s index build [options] [dir]\n\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Embeds the items under dir (default: .claude) into a single index file.")
+		fmt.Fprintln(os.Stderr, "The default <dir>/"+classifier.IndexFileName+" can be checked in: classifying")
+		fmt.Fprintln(os.Stderr, "against dir reuses it for every item that did not change since. Running")
+		fmt.Fprintln(os.Stderr, "it again only embeds items whose files changed.")
+		fmt.Fprintln(os.Stderr, "")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args[1:])
+	applyEngineEnv(fs, &opts)
+
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return errors.New("index build takes at most one directory")
+	}
+	root := ".claude"
+	if fs.NArg() == 1 {
+		root = fs.Arg(0)
+	}
+	if info, err := os.Stat(root); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", root)
+	}
+	if *output == "" {
+		*output = filepath.Join(root, classifier.IndexFileName)
+	}
+
+	// An unreadable previous index only costs a full rebuild
+	var previous *classifier.Index
+	if _, err := os.Stat(*output); err == nil {
+		previous, err = classifier.LoadIndex(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: rebuilding index from scratch: %v\n", err)
+		}
+	}
+
+	eng, err := newEngine(opts)
+	if err != nil {
+		return err
+	}
+	defer eng.close()
+
+	chunking := classifier.ChunkOptions{Size: *chunkSize, Overlap: *chunkOverlap}
+	writes := classifier.CacheWrites()
+	idx, stats, diagnostics, err := eng.classifier.BuildIndex(context.Background(), root, eng.info.indexModel(), chunking, previous)
+	warnDiagnostics(diagnostics)
+	enforceCacheLimit(int64(opts.MaxCacheSize), writes)
+	if err != nil {
+		return err
+	}
+
+	if err := classifier.SaveIndex(*output, idx); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	fmt.Printf("✅ Indexed %d items into %s (%s)\n", len(idx.Entries), *output, stats)
+	return nil
+}
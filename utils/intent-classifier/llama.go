@@ -0,0 +1,475 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hybridgroup/yzma/pkg/download"
+
+	"intent-classifier/classifier"
+)
+
+// defaultLlamaVersion is the llama.cpp build installed on first run. Newer
+// builds are only installed by "lib upgrade", so everyone running the same
+// release gets the same library and the same embeddings.
+const defaultLlamaVersion = "b6795"
+
+// llamaBuild identifies a llama.cpp release archive
+type llamaBuild struct {
+	version   string
+	os        string
+	processor string
+}
+
+// llamaPins holds the sha256 of the main library file (libllama.so,
+// libllama.dylib or llama.dll) in each supported llama.cpp archive. An
+// empty or missing pin means the digest has not been recorded yet; such a
+// build is only checked for a shared library header.
+var llamaPins = map[llamaBuild]string{
+	{defaultLlamaVersion, "linux", "cpu"}:      "",
+	{defaultLlamaVersion, "linux", "cuda"}:     "",
+	{defaultLlamaVersion, "linux", "vulkan"}:   "",
+	{defaultLlamaVersion, "darwin", "cpu"}:     "",
+	{defaultLlamaVersion, "darwin", "metal"}:   "",
+	{defaultLlamaVersion, "windows", "cpu"}:    "",
+	{defaultLlamaVersion, "windows", "cuda"}:   "",
+	{defaultLlamaVersion, "windows", "vulkan"}: "",
+}
+
+// llamaLockFile records the installed llama.cpp build next to the library
+const llamaLockFile = "llama-lock.json"
+
+// llamaLock describes the llama.cpp build installed in a directory
+type llamaLock struct {
+	Version   string            `json:"version"`
+	Processor string            `json:"processor"`
+	OS        string            `json:"os"`
+	Arch      string            `json:"arch"`
+	Installed time.Time         `json:"installed"`
+	Files     map[string]string `json:"files"` // file name -> sha256, symlinks left out
+}
+
+// String describes the build, e.g. "b6795 (cpu, linux/amd64)"
+func (l llamaLock) String() string {
+	return fmt.Sprintf("%s (%s, %s/%s)", l.Version, l.Processor, l.OS, l.Arch)
+}
+
+// readLlamaLock reads the lockfile in dir
+func readLlamaLock(dir string) (llamaLock, error) {
+	var lock llamaLock
+	data, err := os.ReadFile(filepath.Join(dir, llamaLockFile))
+	if err != nil {
+		return lock, err
+	}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return lock, fmt.Errorf("invalid %s: %w", filepath.Join(dir, llamaLockFile), err)
+	}
+	return lock, nil
+}
+
+// newLlamaLock records version and processor with the hashes of the
+// regular files in dir
+func newLlamaLock(dir, version, processor string) (llamaLock, error) {
+	lock := llamaLock{
+		Version:   version,
+		Processor: processor,
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		Installed: time.Now().UTC().Truncate(time.Second),
+		Files:     map[string]string{},
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return lock, err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || entry.Name() == llamaLockFile {
+			continue
+		}
+		sum, err := fileSHA256(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return lock, err
+		}
+		lock.Files[entry.Name()] = sum
+	}
+	return lock, nil
+}
+
+// writeLlamaLock writes lock to dir
+func writeLlamaLock(dir string, lock llamaLock) error {
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	return classifier.WriteFileAtomic(filepath.Join(dir, llamaLockFile), append(data, '\n'))
+}
+
+// verifyLlamaLock returns the files in dir whose content no longer matches
+// lock, sorted by name
+func verifyLlamaLock(dir string, lock llamaLock) []string {
+	var changed []string
+	for name, want := range lock.Files {
+		if sum, err := fileSHA256(filepath.Join(dir, name)); err != nil || sum != want {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// llamaLibDirs returns the directories searched for the llama.cpp library,
+// in order: IC_LIB_DIR, the current directory and the cache
+func llamaLibDirs() []string {
+	var dirs []string
+	if libDir := os.Getenv("IC_LIB_DIR"); libDir != "" {
+		dirs = append(dirs, libDir)
+	}
+	return append(dirs, ".", classifier.CacheDir())
+}
+
+// findLlamaLib returns the first of llamaLibDirs holding the library
+func findLlamaLib() (string, bool) {
+	libName := download.LibraryName(runtime.GOOS)
+	for _, dir := range llamaLibDirs() {
+		if _, err := os.Stat(filepath.Join(dir, libName)); err == nil {
+			return dir, true
+		}
+	}
+	return "", false
+}
+
+// ensureLlamaLib returns the directory of the llama.cpp library, searching
+// llamaLibDirs. A missing library is downloaded into the cache, unless
+// offline is set: version, or defaultLlamaVersion when it is "". An
+// installed library is never replaced; asking for a version other than
+// the one in its lockfile is an error pointing at "lib upgrade".
+func ensureLlamaLib(processor string, version string, offline bool) (string, error) {
+	libName := download.LibraryName(runtime.GOOS)
+	cacheDir := classifier.CacheDir()
+
+	// 1. Check the pre-seeded, current and cache directories
+	if dir, ok := findLlamaLib(); ok {
+		return dir, checkLlamaVersion(dir, version)
+	}
+
+	if offline {
+		return "", missingOffline(missingFile{What: "llama.cpp library " + libName, Looked: llamaLibDirs()})
+	}
+
+	// 2. Download llama.cpp into the cache, once for all concurrent runs
+	os.MkdirAll(cacheDir, 0755)
+	lock, err := classifier.LockFile(filepath.Join(cacheDir, "llama.lock"))
+	if err != nil {
+		return "", fmt.Errorf("failed to lock %s: %w", cacheDir, err)
+	}
+	defer lock.Unlock()
+	if _, err := os.Stat(filepath.Join(cacheDir, libName)); err == nil {
+		return cacheDir, checkLlamaVersion(cacheDir, version)
+	}
+
+	if version == "" {
+		version = defaultLlamaVersion
+	}
+	fmt.Fprintln(os.Stderr, "📥 Downloading llama.cpp library (first time setup)...")
+	if _, err := installLlama(cacheDir, processor, version); err != nil {
+		return "", err
+	}
+	fmt.Fprintln(os.Stderr, "✅ llama.cpp library installed successfully")
+	return cacheDir, nil
+}
+
+// checkLlamaVersion fails when version is set and the library in dir is
+// recorded as a different build. Libraries without a lockfile, such as
+// ones installed by older releases, cannot be checked and only get a
+// warning.
+func checkLlamaVersion(dir string, version string) error {
+	if version == "" {
+		return nil
+	}
+	lock, err := readLlamaLock(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: cannot check the llama.cpp version in %s: %v\n", dir, err)
+		return nil
+	}
+	if lock.Version == version {
+		return nil
+	}
+	if dir == classifier.CacheDir() {
+		return fmt.Errorf("llama.cpp %s is installed, not %s: run \"intent-classifier lib upgrade --llama-version %s\" to switch", lock.Version, version, version)
+	}
+	return fmt.Errorf("llama.cpp in %s is %s, not %s", dir, lock.Version, version)
+}
+
+// installLlama downloads llama.cpp version for processor into dir, replacing
+// any build installed there, and returns its lockfile
+func installLlama(dir, processor, version string) (llamaLock, error) {
+	libName := download.LibraryName(runtime.GOOS)
+	previous, _ := readLlamaLock(dir)
+
+	// Extract into a staging directory so a killed run leaves no partial library behind
+	staging, err := os.MkdirTemp(dir, ".llama-download-*")
+	if err != nil {
+		return llamaLock{}, err
+	}
+	defer os.RemoveAll(staging)
+
+	fmt.Fprintf(os.Stderr, "📦 Installing llama.cpp version %s (%s)...\n", version, processor)
+	err = newDownloader().retry(func() error {
+		return download.Get(runtime.GOOS, processor, version, staging)
+	})
+	if err != nil {
+		return llamaLock{}, fmt.Errorf("failed to download llama.cpp %s: %w", version, err)
+	}
+
+	// Fix broken symlinks (tar extraction sometimes creates text files instead of symlinks)
+	if err := fixBrokenSymlinks(staging); err != nil {
+		// Non-fatal - warn but continue
+		fmt.Fprintf(os.Stderr, "⚠️  Warning: Could not fix symlinks: %v\n", err)
+	}
+
+	// Verify library file exists and is a library, matching its pin if recorded
+	if _, err := os.Stat(filepath.Join(staging, libName)); err != nil {
+		return llamaLock{}, fmt.Errorf("library file not found after download: %w", err)
+	}
+	pin := llamaPins[llamaBuild{version, runtime.GOOS, processor}]
+	if pin == "" {
+		fmt.Fprintf(os.Stderr, "⚠️  Warning: no sha256 recorded for llama.cpp %s (%s, %s), only checking the library header\n", version, runtime.GOOS, processor)
+	}
+	if err := verifyLibrary(filepath.Join(staging, libName), pin); err != nil {
+		return llamaLock{}, fmt.Errorf("downloaded llama.cpp library is not usable: %w", err)
+	}
+
+	// The lockfile is installed with the files it describes
+	lock, err := newLlamaLock(staging, version, processor)
+	if err != nil {
+		return llamaLock{}, err
+	}
+	if err := writeLlamaLock(staging, lock); err != nil {
+		return llamaLock{}, err
+	}
+	if err := installStaged(staging, dir, libName); err != nil {
+		return llamaLock{}, fmt.Errorf("failed to install llama.cpp: %w", err)
+	}
+
+	// Drop files of the previous build that the new one does not have
+	for name := range previous.Files {
+		if _, ok := lock.Files[name]; !ok && !strings.ContainsAny(name, `/\`) {
+			os.Remove(filepath.Join(dir, name))
+		}
+	}
+	return lock, nil
+}
+
+// describeLlamaLib reports the llama.cpp build that would be loaded: the
+// one in libPath (--lib) or the first found in llamaLibDirs
+func describeLlamaLib(libPath string) string {
+	dir, found := libPath, libPath != ""
+	if !found {
+		dir, found = findLlamaLib()
+	}
+	if !found {
+		return fmt.Sprintf("llama.cpp not installed (%s is installed on first run)", defaultLlamaVersion)
+	}
+	lock, err := readLlamaLock(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Sprintf("llama.cpp unknown build in %s (no %s)", dir, llamaLockFile)
+	}
+	if err != nil {
+		return fmt.Sprintf("llama.cpp unknown build in %s (%v)", dir, err)
+	}
+	return fmt.Sprintf("llama.cpp %s in %s", lock, dir)
+}
+
+// runLib implements the "lib" subcommand
+func runLib(args []string) error {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s lib <command> [options]\n\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Commands:")
+		fmt.Fprintln(os.Stderr, "  status     Show the installed llama.cpp build and check its files")
+		fmt.Fprintln(os.Stderr, "  upgrade    Install another llama.cpp build into the cache (default: latest)")
+	}
+	if len(args) == 0 {
+		usage()
+		return errors.New("missing lib command")
+	}
+
+	switch args[0] {
+	case "status":
+		return runLibStatus(args[1:])
+	case "upgrade":
+		return runLibUpgrade(args[1:])
+	default:
+		usage()
+		return fmt.Errorf("unknown lib command %q", args[0])
+	}
+}
+
+// runLibStatus implements "lib status"
+func runLibStatus(args []string) error {
+	fs := flag.NewFlagSet("lib status", flag.ExitOnError)
+	libPath := fs.String("lib", "", "llama.cpp library path to check (default: the one classification would load)")
+	fs.Parse(args)
+
+	fmt.Println(describeLlamaLib(*libPath))
+	dir, found := *libPath, *libPath != ""
+	if !found {
+		if dir, found = findLlamaLib(); !found {
+			return nil
+		}
+	}
+	lock, err := readLlamaLock(dir)
+	if err != nil {
+		return nil
+	}
+	fmt.Printf("   Installed %s\n", lock.Installed.Local().Format(time.DateTime))
+	if changed := verifyLlamaLock(dir, lock); len(changed) > 0 {
+		return fmt.Errorf("%d file(s) differ from %s: %s", len(changed), llamaLockFile, strings.Join(changed, ", "))
+	}
+	fmt.Printf("✅ %d files match %s\n", len(lock.Files), llamaLockFile)
+	return nil
+}
+
+// runLibUpgrade implements "lib upgrade"
+func runLibUpgrade(args []string) error {
+	fs := flag.NewFlagSet("lib upgrade", flag.ExitOnError)
+	version := fs.String("llama-version", "", "llama.cpp build to install, e.g. "+defaultLlamaVersion+" (default: latest release)")
+	processor := fs.String("processor", "", "Processor type: cpu, cuda, vulkan, metal (default: the installed one, or cpu)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s lib upgrade [options]\n\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Replaces the llama.cpp library in the cache and records the new build")
+		fmt.Fprintf(os.Stderr, "in %s. Normal runs never change the installed build.\n\n", llamaLockFile)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	if offline, err := strconv.ParseBool(os.Getenv("IC_OFFLINE")); err == nil && offline {
+		return errors.New("lib upgrade downloads llama.cpp, unset IC_OFFLINE to run it")
+	}
+
+	cacheDir := classifier.CacheDir()
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return err
+	}
+	lockFile, err := classifier.LockFile(filepath.Join(cacheDir, "llama.lock"))
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %w", cacheDir, err)
+	}
+	defer lockFile.Unlock()
+
+	installed, installedErr := readLlamaLock(cacheDir)
+	if *processor == "" {
+		*processor = "cpu"
+		if installedErr == nil {
+			*processor = installed.Processor
+		}
+	}
+	if *version == "" {
+		latest, err := download.LlamaLatestVersion()
+		if err != nil {
+			return fmt.Errorf("could not get the latest llama.cpp version, pass --llama-version: %w", err)
+		}
+		*version = latest
+	}
+
+	libName := download.LibraryName(runtime.GOOS)
+	if _, err := os.Stat(filepath.Join(cacheDir, libName)); err == nil && installedErr == nil &&
+		installed.Version == *version && installed.Processor == *processor {
+		fmt.Printf("✅ llama.cpp %s is already installed\n", installed)
+		return nil
+	}
+
+	lock, err := installLlama(cacheDir, *processor, *version)
+	if err != nil {
+		return err
+	}
+	if installedErr == nil {
+		fmt.Printf("✅ Upgraded llama.cpp %s → %s\n", installed, lock)
+	} else {
+		fmt.Printf("✅ Installed llama.cpp %s\n", lock)
+	}
+	fmt.Println("   Running daemons keep the previous build until their idle timeout")
+	if libDir := os.Getenv("IC_LIB_DIR"); libDir != "" {
+		fmt.Fprintf(os.Stderr, "Warning: IC_LIB_DIR=%s is searched before the cache\n", libDir)
+	}
+	return nil
+}
+
+// installStaged renames the files extracted into staging to dir. The file
+// named last goes last, so its presence means the install is complete.
+func installStaged(staging, dir, last string) error {
+	entries, err := os.ReadDir(staging)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name() == last {
+			continue
+		}
+		if err := os.Rename(filepath.Join(staging, entry.Name()), filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return os.Rename(filepath.Join(staging, last), filepath.Join(dir, last))
+}
+
+// fixBrokenSymlinks repairs symlinks that were extracted as text files
+func fixBrokenSymlinks(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		// Only check .so* files
+		if !strings.Contains(entry.Name(), ".so") {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		// Skip if already a symlink or too large
+		if info.Mode()&os.ModeSymlink != 0 || info.Size() >= 100 {
+			continue
+		}
+
+		// Read content - should be the symlink target
+		content, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		target := strings.TrimSpace(string(content))
+		// Validate: single line, target exists
+		if strings.Contains(target, "\n") || target == "" {
+			continue
+		}
+
+		targetPath := filepath.Join(dir, target)
+		if _, err := os.Stat(targetPath); err != nil {
+			continue
+		}
+
+		// Replace text file with symlink
+		os.Remove(path)
+		os.Symlink(target, path)
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/hybridgroup/yzma/pkg/download"
+
+	"intent-classifier/classifier"
+)
+
+func TestLlamaLock(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "libllama.so"), []byte("\x7fELF llama"), 0644)
+	os.WriteFile(filepath.Join(dir, "libggml.so"), []byte("\x7fELF ggml"), 0644)
+	if runtime.GOOS != "windows" {
+		os.Symlink("libggml.so", filepath.Join(dir, "libggml.so.1"))
+	}
+
+	lock, err := newLlamaLock(dir, "b6795", "cpu")
+	if err != nil {
+		t.Fatalf("newLlamaLock() error = %v", err)
+	}
+	want := map[string]string{
+		"libllama.so": sha256Hex([]byte("\x7fELF llama")),
+		"libggml.so":  sha256Hex([]byte("\x7fELF ggml")),
+	}
+	if !reflect.DeepEqual(lock.Files, want) {
+		t.Errorf("Files = %v, expected %v", lock.Files, want)
+	}
+
+	if err := writeLlamaLock(dir, lock); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readLlamaLock(dir)
+	if err != nil {
+		t.Fatalf("readLlamaLock() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, lock) {
+		t.Errorf("readLlamaLock() = %+v, expected %+v", got, lock)
+	}
+	if changed := verifyLlamaLock(dir, got); len(changed) != 0 {
+		t.Errorf("verifyLlamaLock() = %v, expected no changes", changed)
+	}
+
+	os.WriteFile(filepath.Join(dir, "libggml.so"), []byte("\x7fELF other"), 0644)
+	if changed := verifyLlamaLock(dir, got); !reflect.DeepEqual(changed, []string{"libggml.so"}) {
+		t.Errorf("verifyLlamaLock() = %v, expected [libggml.so]", changed)
+	}
+}
+
+func TestCheckLlamaVersion(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	cacheDir := classifier.CacheDir()
+	os.MkdirAll(cacheDir, 0755)
+	if err := writeLlamaLock(cacheDir, llamaLock{Version: "b6795", Processor: "cpu"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		dir     string
+		version string
+		wantErr string
+	}{
+		{"any version", cacheDir, "", ""},
+		{"matching", cacheDir, "b6795", ""},
+		{"other version", cacheDir, "b7000", "lib upgrade --llama-version b7000"},
+		{"no lockfile", t.TempDir(), "b7000", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkLlamaVersion(tt.dir, tt.version)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkLlamaVersion() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkLlamaVersion() error = %v, expected it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDescribeLlamaLib(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	libDir := t.TempDir()
+	t.Setenv("IC_LIB_DIR", libDir)
+
+	if got := describeLlamaLib(""); !strings.Contains(got, "not installed") {
+		t.Errorf("describeLlamaLib() = %q, expected not installed", got)
+	}
+
+	os.WriteFile(filepath.Join(libDir, download.LibraryName(runtime.GOOS)), []byte("\x7fELF"), 0644)
+	if got := describeLlamaLib(""); !strings.Contains(got, "unknown build in "+libDir) {
+		t.Errorf("describeLlamaLib() = %q, expected an unknown build", got)
+	}
+
+	writeLlamaLock(libDir, llamaLock{Version: "b6795", Processor: "cuda", OS: "linux", Arch: "amd64"})
+	if got, want := describeLlamaLib(""), "llama.cpp b6795 (cuda, linux/amd64) in "+libDir; got != want {
+		t.Errorf("describeLlamaLib() = %q, expected %q", got, want)
+	}
+}
@@ -1,110 +1,35 @@
 package main
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"math"
-	"net/http"
 	"os"
 	"path/filepath"
-	"regexp"
-	"runtime"
 	"strconv"
 	"strings"
-	"unicode"
+	"time"
 
-	"github.com/hybridgroup/yzma/pkg/download"
-	"github.com/hybridgroup/yzma/pkg/llama"
+	"intent-classifier/classifier"
 )
 
 // Version is injected at build time via ldflags
 var version = "0.2.8"
 
-// Item represents a file with its content for matching
-type Item struct {
-	Name     string
-	Path     string
-	Content  string
-	Priority string
-	Type     string // "skill" or "agent"
-}
-
-// Match represents a matched item with its similarity score
-type Match struct {
-	Name       string
-	Path       string
-	Similarity float32
-	Priority   string
-	Type       string // "skill" or "agent"
-}
-
-// Common English stop words (lightweight list)
-var stopWords = map[string]bool{
-	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
-	"be": true, "by": true, "for": true, "from": true, "has": true, "he": true,
-	"in": true, "is": true, "it": true, "its": true, "of": true, "on": true,
-	"that": true, "the": true, "to": true, "was": true, "will": true, "with": true,
-	"this": true, "these": true, "those": true, "or": true, "but": true, "can": true,
-	"have": true, "do": true, "does": true, "did": true, "doing": true,
-}
-
-// preprocessText compacts text for embedding by removing noise and redundancy
-func preprocessText(text string) string {
-	// 1. Strip YAML frontmatter (already parsed, just noise for embedding)
-	text = stripFrontmatter(text)
-
-	// 2. Normalize whitespace - collapse multiple spaces/newlines
-	text = normalizeWhitespace(text)
-
-	// 3. Remove stop words to reduce dimensionality
-	text = removeStopWords(text)
-
-	// 4. Final whitespace cleanup
-	text = strings.TrimSpace(text)
+// defaultEmbeddingModel is the all-MiniLM-L6-v2 sentence transformer in GGUF format
+const defaultEmbeddingModel = "https://huggingface.co/second-state/All-MiniLM-L6-v2-Embedding-GGUF/resolve/main/all-MiniLM-L6-v2-Q5_K_M.gguf"
 
-	return text
-}
+// defaultLLMModel is SmolLM2-360M-Instruct, small enough for per-prompt reasoning on CPU
+const defaultLLMModel = "https://huggingface.co/bartowski/SmolLM2-360M-Instruct-GGUF/resolve/main/SmolLM2-360M-Instruct-Q5_K_M.gguf"
 
-// stripFrontmatter removes YAML frontmatter from text
-func stripFrontmatter(text string) string {
-	lines := strings.Split(text, "\n")
-	if len(lines) > 0 && strings.HasPrefix(lines[0], "---") {
-		// Find closing ---
-		for i := 1; i < len(lines); i++ {
-			if strings.TrimSpace(lines[i]) == "---" {
-				// Return everything after frontmatter
-				return strings.Join(lines[i+1:], "\n")
-			}
-		}
-	}
-	return text
-}
-
-// normalizeWhitespace collapses multiple spaces, tabs, and newlines
-func normalizeWhitespace(text string) string {
-	// Replace multiple whitespace with single space
-	re := regexp.MustCompile(`\s+`)
-	return re.ReplaceAllString(text, " ")
-}
-
-// removeStopWords removes common English stop words
-func removeStopWords(text string) string {
-	words := strings.FieldsFunc(text, func(r rune) bool {
-		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
-	})
-
-	var filtered []string
-	for _, word := range words {
-		lower := strings.ToLower(word)
-		if !stopWords[lower] && len(word) > 1 { // Keep words > 1 char
-			filtered = append(filtered, word)
-		}
-	}
-
-	return strings.Join(filtered, " ")
+// presetPins holds the sha256 of the built-in models, applied when they are
+// used without a #sha256= pin of their own. An empty pin means the digest
+// of the published file has not been recorded yet; such a preset is only
+// checked for a valid GGUF header.
+var presetPins = map[string]string{
+	defaultEmbeddingModel: "",
+	defaultLLMModel:       "",
 }
 
 func main() {
@@ -113,13 +38,39 @@ func main() {
 	flag.BoolVar(&showVersion, "version", false, "Show version and exit")
 	flag.BoolVar(&showVersion, "v", false, "Show version and exit (shorthand)")
 	prompt := flag.String("prompt", "", "User prompt to match against (required)")
-	embed := flag.String("embed", "", "File or directory path to search and match (required)")
+	embed := flag.String("embed", "", "File or directory path to search and match (required unless --index is given)")
+	indexPath := flag.String("index", "", "Index file built by \"index build\" to match against instead of reading --embed")
 	threshold := flag.Float64("threshold", 0.2, "Similarity threshold (0.0-1.0, lower = more matches, env: IC_THRESHOLD)")
-	embeddingModel := flag.String("embedding-model", "https://huggingface.co/second-state/All-MiniLM-L6-v2-Embedding-GGUF/resolve/main/all-MiniLM-L6-v2-Q5_K_M.gguf", "Embedding model URL or path")
-	libPath := flag.String("lib", "", "llama.cpp library path (auto-detect if empty)")
-	processor := flag.String("processor", "cpu", "Processor type: cpu, cuda, vulkan, metal (default: cpu)")
-	outputType := flag.String("output-type", "auto", "Output type: auto, skills, or agents (auto-detects from directory structure)")
-	llamaLogLevel := flag.Int("llama-log-level", 0, "Llama.cpp log level (0=disabled, 1=error, 2=warn, 3=info)")
+	outputType := flag.String("output-type", classifier.OutputAuto, "Output type: auto, skills, agents, or commands (auto-detects from directory structure)")
+	format := flag.String("format", formatText, "Output format: text, json, or ndjson")
+	templateSpec := flag.String("template", "default", "Text output template: default, plain, markdown, xml-tags, or a path to a Go text/template file")
+	hook := flag.Bool("hook", false, "Run as a Claude Code UserPromptSubmit hook (reads JSON payload from stdin)")
+	mode := flag.String("mode", classifier.ModeEmbedding, "Matching mode: embedding, llm, or hybrid (env: IC_MODE)")
+	llmThreshold := flag.Float64("llm-threshold", 0.5, "LLM confidence threshold for llm/hybrid modes (0.0-1.0, env: IC_LLM_THRESHOLD)")
+	shortlist := flag.Int("shortlist", 5, "Hybrid mode: max embedding matches sent to the LLM")
+	chunkSize := flag.Int("chunk-size", classifier.DefaultChunkSize, "Tokens per chunk when embedding long items")
+	chunkOverlap := flag.Int("chunk-overlap", classifier.DefaultChunkOverlap, "Tokens shared by consecutive chunks")
+	chunkAggregate := flag.String("chunk-aggregate", classifier.AggregateMax, "How chunk similarities become an item score: max, mean, or topk-mean")
+	chunkTopK := flag.Int("chunk-top-k", classifier.DefaultChunkTopK, "Chunks averaged by --chunk-aggregate topk-mean")
+	topK := flag.Int("top-k", 0, "Keep at most this many matches, best first (0 = no limit)")
+	minMargin := flag.Float64("min-margin", 0, "Keep matches within this distance of the best score (0 = no limit)")
+	typeCaps := map[string]*int{
+		"skill":   flag.Int("max-skills", 0, "Keep at most this many skills (0 = no limit)"),
+		"agent":   flag.Int("max-agents", 0, "Keep at most this many agents (0 = no limit)"),
+		"command": flag.Int("max-commands", 0, "Keep at most this many commands (0 = no limit)"),
+	}
+	configPath := flag.String("config", "", "Config file with threshold overrides (default: <embed>/intent-classifier.yaml, env: IC_CONFIG)")
+	typeThresholds := map[string]*float64{
+		"skill":   flag.Float64("skill-threshold", -1, "Similarity threshold for skills (overrides --threshold and the config)"),
+		"agent":   flag.Float64("agent-threshold", -1, "Similarity threshold for agents (overrides --threshold and the config)"),
+		"command": flag.Float64("command-threshold", -1, "Similarity threshold for commands (overrides --threshold and the config)"),
+	}
+	explain := flag.Bool("explain", false, "Print how every item was scored to stderr")
+	why := flag.String("why", "", "Print how one item was scored, with the prompt as embedded, to stderr")
+	noDaemon := flag.Bool("no-daemon", false, "Load the model in-process instead of using the background daemon (env: IC_NO_DAEMON)")
+	var opts classifyOptions
+	addEngineFlags(flag.CommandLine, &opts)
+	addMaxCacheSizeFlag(flag.CommandLine, &opts.MaxCacheSize)
 
 	// Custom usage message
 	flag.Usage = func() {
@@ -129,18 +80,124 @@ func main() {
 		fmt.Fprintln(os.Stderr, "        User prompt to match against")
 		fmt.Fprintln(os.Stderr, "  -embed string")
 		fmt.Fprintln(os.Stderr, "        File or directory to embed and match")
+		fmt.Fprintln(os.Stderr, "  -index string")
+		fmt.Fprintln(os.Stderr, "        Index file built by \"index build\", replaces -embed")
 		fmt.Fprintln(os.Stderr, "\nOptional flags:")
+		fmt.Fprintln(os.Stderr, "  -hook")
+		fmt.Fprintln(os.Stderr, "        Read a UserPromptSubmit hook payload from stdin instead of -prompt")
+		fmt.Fprintln(os.Stderr, "        (-embed defaults to <cwd>/.claude)")
 		fmt.Fprintln(os.Stderr, "  -threshold float")
 		fmt.Fprintln(os.Stderr, "        Similarity threshold (default: 0.2, env: IC_THRESHOLD)")
+		fmt.Fprintln(os.Stderr, "  -skill-threshold, -agent-threshold, -command-threshold float")
+		fmt.Fprintln(os.Stderr, "        Similarity threshold for one item type (overrides -threshold and the config)")
+		fmt.Fprintln(os.Stderr, "  -top-k int")
+		fmt.Fprintln(os.Stderr, "        Keep at most this many matches, best first (default: 0 = no limit)")
+		fmt.Fprintln(os.Stderr, "  -min-margin float")
+		fmt.Fprintln(os.Stderr, "        Keep matches within this distance of the best score (default: 0 = no limit)")
+		fmt.Fprintln(os.Stderr, "  -max-skills, -max-agents, -max-commands int")
+		fmt.Fprintln(os.Stderr, "        Keep at most this many matches of one type (default: 0 = no limit)")
+		fmt.Fprintln(os.Stderr, "  -config string")
+		fmt.Fprintln(os.Stderr, "        Config file with threshold overrides")
+		fmt.Fprintln(os.Stderr, "        (default: <embed>/intent-classifier.yaml, env: IC_CONFIG)")
+		fmt.Fprintln(os.Stderr, "  -mode string")
+		fmt.Fprintln(os.Stderr, "        Matching mode: embedding, llm, or hybrid (default: embedding, env: IC_MODE)")
+		fmt.Fprintln(os.Stderr, "  -llm-model string")
+		fmt.Fprintln(os.Stderr, "        LLM URL or local path for llm/hybrid modes")
+		fmt.Fprintln(os.Stderr, "        (default: SmolLM2-360M-Instruct)")
+		fmt.Fprintln(os.Stderr, "  -llm-threshold float")
+		fmt.Fprintln(os.Stderr, "        LLM confidence threshold (default: 0.5, env: IC_LLM_THRESHOLD)")
+		fmt.Fprintln(os.Stderr, "  -shortlist int")
+		fmt.Fprintln(os.Stderr, "        Hybrid mode: max embedding matches sent to the LLM (default: 5)")
+		fmt.Fprintln(os.Stderr, "  -chunk-size int")
+		fmt.Fprintf(os.Stderr, "        Tokens per chunk when embedding long items (default: %d)\n", classifier.DefaultChunkSize)
+		fmt.Fprintln(os.Stderr, "  -chunk-overlap int")
+		fmt.Fprintf(os.Stderr, "        Tokens shared by consecutive chunks (default: %d)\n", classifier.DefaultChunkOverlap)
+		fmt.Fprintln(os.Stderr, "  -chunk-aggregate string")
+		fmt.Fprintln(os.Stderr, "        Item score from its chunks: max, mean, or topk-mean (default: max)")
+		fmt.Fprintln(os.Stderr, "  -chunk-top-k int")
+		fmt.Fprintf(os.Stderr, "        Chunks averaged by topk-mean (default: %d)\n", classifier.DefaultChunkTopK)
+		fmt.Fprintln(os.Stderr, "  -explain")
+		fmt.Fprintln(os.Stderr, "        Print how every item was scored against its threshold, including the best chunk, to stderr")
+		fmt.Fprintln(os.Stderr, "  -why name")
+		fmt.Fprintln(os.Stderr, "        Print how one item was scored, including the prompt as embedded, to stderr")
 		fmt.Fprintln(os.Stderr, "  -output-type string")
-		fmt.Fprintln(os.Stderr, "        Output type: auto, skills, or agents (default: auto)")
+		fmt.Fprintln(os.Stderr, "        Output type: auto, skills, agents, or commands (default: auto)")
+		fmt.Fprintln(os.Stderr, "  -format string")
+		fmt.Fprintln(os.Stderr, "        Output format: text, json, or ndjson (default: text)")
+		fmt.Fprintln(os.Stderr, "  -template string")
+		fmt.Fprintln(os.Stderr, "        Text output template: default, plain, markdown, xml-tags,")
+		fmt.Fprintln(os.Stderr, "        or a path to a Go text/template file (default: default)")
 		fmt.Fprintln(os.Stderr, "  -embedding-model string")
-		fmt.Fprintln(os.Stderr, "        Embedding model URL or local path")
+		fmt.Fprintln(os.Stderr, "        Embedding model URL or local path, optionally pinned with #sha256=<hex>")
 		fmt.Fprintln(os.Stderr, "        (default: all-MiniLM-L6-v2)")
 		fmt.Fprintln(os.Stderr, "  -lib string")
 		fmt.Fprintln(os.Stderr, "        llama.cpp library path (default: auto-download)")
+		fmt.Fprintln(os.Stderr, "  -llama-version string")
+		fmt.Fprintf(os.Stderr, "        llama.cpp build installed on first run; an installed build must match (default: %s)\n", defaultLlamaVersion)
+		fmt.Fprintln(os.Stderr, "        Change the installed build with \"lib upgrade\"")
 		fmt.Fprintln(os.Stderr, "  -processor string")
 		fmt.Fprintln(os.Stderr, "        Processor type: cpu, cuda, vulkan, metal (default: cpu)")
+		fmt.Fprintln(os.Stderr, "  -no-daemon")
+		fmt.Fprintln(os.Stderr, "        Load the model in-process instead of using the daemon (env: IC_NO_DAEMON)")
+		fmt.Fprintln(os.Stderr, "  -idle-timeout duration")
+		fmt.Fprintln(os.Stderr, "        Stop the daemon after this long without requests (default: 10m, env: IC_IDLE_TIMEOUT)")
+		fmt.Fprintln(os.Stderr, "  -offline")
+		fmt.Fprintln(os.Stderr, "        Never download models or llama.cpp; fail listing what is missing (env: IC_OFFLINE)")
+		fmt.Fprintln(os.Stderr, "        Seed them with IC_MODEL_DIR and IC_LIB_DIR")
+		fmt.Fprintln(os.Stderr, "  -max-cache-size size")
+		fmt.Fprintln(os.Stderr, "        Evict least recently used embeddings and LLM responses beyond this size,")
+		fmt.Fprintln(os.Stderr, "        e.g. 500MB (default: 0 = no limit, env: IC_MAX_CACHE_SIZE)")
+		fmt.Fprintln(os.Stderr, "\nSubcommands:")
+		fmt.Fprintln(os.Stderr, "  serve    Run the classifier daemon in the foreground")
+		fmt.Fprintln(os.Stderr, "  index    Build an index file of embedded items (index build <dir>)")
+		fmt.Fprintln(os.Stderr, "  eval     Score matches against a labelled dataset (eval --dataset cases.yaml)")
+		fmt.Fprintln(os.Stderr, "  calibrate  Suggest thresholds from a labelled dataset (calibrate --dataset cases.yaml)")
+		fmt.Fprintln(os.Stderr, "  cache    Inspect and prune the cache (cache stats|list|prune|clear)")
+		fmt.Fprintln(os.Stderr, "  lib      Show or upgrade the installed llama.cpp build (lib status|upgrade)")
+	}
+
+	// Subcommands have their own flag sets
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		if err := runServe(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "index" {
+		if err := runIndex(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "eval" {
+		if err := runEval(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "calibrate" {
+		if err := runCalibrate(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "lib" {
+		if err := runLib(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "cache" {
+		if err := runCache(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			os.Exit(1)
+		}
+		return
 	}
 
 	flag.Parse()
@@ -148,6 +205,7 @@ func main() {
 	// Handle version flag
 	if showVersion {
 		fmt.Printf("intent-classifier version %s\n", version)
+		fmt.Println(describeLlamaLib(opts.LibPath))
 		os.Exit(0)
 	}
 
@@ -168,598 +226,297 @@ func main() {
 		}
 	}
 
-	// Validate required flags
-	if *prompt == "" || *embed == "" {
-		fmt.Fprintln(os.Stderr, "Error: -prompt and -embed are required")
-		fmt.Fprintln(os.Stderr, "")
-		flag.Usage()
-		os.Exit(1)
+	// Same FLAG -> ENV -> DEFAULT precedence for the LLM settings
+	flagsSet := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		flagsSet[f.Name] = true
+	})
+	if envMode := os.Getenv("IC_MODE"); envMode != "" && !flagsSet["mode"] {
+		*mode = envMode
 	}
-
-	// Auto-download llama.cpp if not found (must happen before resolving models)
-	if *libPath == "" {
-		*libPath = ensureLlamaLib(*processor)
+	if envConfig := os.Getenv("IC_CONFIG"); envConfig != "" && !flagsSet["config"] {
+		*configPath = envConfig
 	}
-
-	// Resolve embedding model to GGUF file path
-	embeddingModelPath := resolveModel(*embeddingModel, "embedding")
-
-	// Load llama.cpp library
-	if err := llama.Load(*libPath); err != nil {
-		if strings.Contains(err.Error(), "libffi") {
-			fmt.Fprintf(os.Stderr, "❌ Missing libffi dependency\n")
-			fmt.Fprintln(os.Stderr, "\nInstall libffi for your system:")
-			fmt.Fprintln(os.Stderr, "  • Ubuntu/Debian: sudo apt install libffi8")
-			fmt.Fprintln(os.Stderr, "  • Fedora/RHEL:   sudo dnf install libffi")
-			fmt.Fprintln(os.Stderr, "  • Arch Linux:    sudo pacman -S libffi")
-			fmt.Fprintln(os.Stderr, "  • macOS:         brew install libffi")
-			fmt.Fprintln(os.Stderr, "  • Nix:           nix profile install nixpkgs#libffi")
-			os.Exit(1)
+	if envLLMThreshold := os.Getenv("IC_LLM_THRESHOLD"); envLLMThreshold != "" && !flagsSet["llm-threshold"] {
+		if val, err := strconv.ParseFloat(envLLMThreshold, 64); err == nil {
+			*llmThreshold = val
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: Invalid IC_LLM_THRESHOLD env var '%s', using default\n", envLLMThreshold)
 		}
-		fmt.Fprintf(os.Stderr, "Failed to load llama.cpp library: %v\n", err)
-		fmt.Fprintln(os.Stderr, "Hint: Ensure llama.cpp shared library is available")
-		fmt.Fprintln(os.Stderr, "      You can specify it with --lib /path/to/libllama.so")
-		os.Exit(1)
 	}
-
-	// Initialize llama.cpp
-	llama.Init()
-	defer llama.BackendFree()
-
-	// Set llama.cpp log level (0 = silent)
-	if *llamaLogLevel == 0 {
-		llama.LogSet(llama.LogSilent())
+	if err := classifier.ValidateMode(*mode); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
-
-	// Load backends from the library path
-	llama.GGMLBackendLoadAllFromPath(*libPath)
-
-	// Load embedding model
-	model := llama.ModelLoadFromFile(embeddingModelPath, llama.ModelDefaultParams())
-	if model == 0 {
-		fmt.Fprintf(os.Stderr, "Failed to load embedding model from %s\n", embeddingModelPath)
+	if err := classifier.ValidateOutputType(*outputType); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
-	defer llama.ModelFree(model)
-
-	// Create context for embeddings
-	ctxParams := llama.ContextDefaultParams()
-	ctxParams.NCtx = 512
-	ctxParams.NBatch = 512
-	ctxParams.NUbatch = 512 // Set micro-batch size to match batch size
-	ctxParams.Embeddings = 1 // Enable embeddings mode
-
-	lctx := llama.InitFromModel(model, ctxParams)
-	if lctx == 0 {
-		fmt.Fprintf(os.Stderr, "Failed to create context from model\n")
+	if err := classifier.ValidateAggregate(*chunkAggregate); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
-	defer llama.Free(lctx)
-
-	// Load items from file or directory
-	items, err := loadItems(*embed)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to load items: %v\n", err)
+	if err := validateFormat(*format); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
-
-	// Compute prompt embedding (preprocess first)
-	processedPrompt := preprocessText(strings.ToLower(*prompt))
-	promptEmbed, err := getEmbedding(model, lctx, processedPrompt)
+	tmpl, err := loadTemplate(*templateSpec)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to embed prompt: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Embedding similarity mode - match items
-	matches := matchItems(model, lctx, promptEmbed, items, float32(*threshold))
-
-	// Output results
-	if len(matches) > 0 {
-		outputWithTemplate(matches, *outputType)
-	}
-}
-
-// matchWithLLMAndTemplate uses LLM to analyze files and generate template output
-func getEmbedding(model llama.Model, lctx llama.Context, text string) ([]float32, error) {
-	// Get max context size and reserve room for special tokens
-	maxTokens := int(llama.NCtx(lctx)) - 10
-
-	// Tokenize
-	vocab := llama.ModelGetVocab(model)
-	count := llama.Tokenize(vocab, text, nil, true, true)
-	if count <= 0 {
-		return nil, fmt.Errorf("tokenization returned no tokens")
-	}
-
-	// Truncate if exceeds max tokens
-	if count > int32(maxTokens) {
-		count = int32(maxTokens)
-	}
-
-	tokens := make([]llama.Token, count)
-	llama.Tokenize(vocab, text, tokens, true, true)
-
-	// Encode (use Encode for embedding models like BERT)
-	batch := llama.BatchGetOne(tokens)
-	if llama.Encode(lctx, batch) != 0 {
-		return nil, fmt.Errorf("encode failed")
-	}
-
-	// Get embeddings
-	nEmbd := llama.ModelNEmbd(model)
-	vec := llama.GetEmbeddingsSeq(lctx, 0, nEmbd)
-
-	// Normalize
-	var sum float64
-	for _, v := range vec {
-		sum += float64(v * v)
-	}
-	sum = math.Sqrt(sum)
-	norm := float32(1.0 / sum)
-
-	normalized := make([]float32, len(vec))
-	for i, v := range vec {
-		normalized[i] = v * norm
-	}
-
-	return normalized, nil
-}
-
-// isValidSkillFile checks if file should be processed
-func isValidSkillFile(path string, content string) bool {
-	// Must be .md file
-	if !strings.HasSuffix(strings.ToLower(path), ".md") {
-		return false
+	applyEngineEnv(flag.CommandLine, &opts)
+
+	// IC_NO_DAEMON=1 disables the daemon the same way --no-daemon does
+	if envNoDaemon, err := strconv.ParseBool(os.Getenv("IC_NO_DAEMON")); err == nil && envNoDaemon {
+		*noDaemon = true
+	}
+
+	opts.Embed = *embed
+	opts.Index = *indexPath
+	opts.Threshold = float32(*threshold)
+	opts.OutputType = *outputType
+	opts.Mode = *mode
+	opts.LLMThreshold = float32(*llmThreshold)
+	opts.Shortlist = *shortlist
+	opts.ChunkSize = *chunkSize
+	opts.ChunkOverlap = *chunkOverlap
+	opts.ChunkAggregate = *chunkAggregate
+	opts.ChunkTopK = *chunkTopK
+	opts.Explain = *explain || *why != ""
+	opts.Config = *configPath
+	opts.TopK = *topK
+	opts.MinMargin = float32(*minMargin)
+	for itemType, value := range typeCaps {
+		if *value != 0 {
+			if opts.MaxPerType == nil {
+				opts.MaxPerType = map[string]int{}
+			}
+			opts.MaxPerType[itemType] = *value
+		}
 	}
-
-	// Must have valid frontmatter with name field
-	return hasValidFrontmatter(content)
-}
-
-// hasValidFrontmatter checks if content has YAML frontmatter with required fields
-func hasValidFrontmatter(content string) bool {
-	lines := strings.Split(content, "\n")
-	if len(lines) < 3 || !strings.HasPrefix(lines[0], "---") {
-		return false
+	selection := classifier.Selection{TopK: opts.TopK, MinMargin: opts.MinMargin, MaxPerType: opts.MaxPerType}
+	if err := selection.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
-
-	// Look for closing --- and name: field
-	foundClosing := false
-	foundName := false
-
-	for i := 1; i < len(lines); i++ {
-		line := strings.TrimSpace(lines[i])
-
-		if line == "---" {
-			foundClosing = true
-			break
-		}
-
-		if strings.HasPrefix(line, "name:") {
-			nameValue := strings.TrimSpace(strings.TrimPrefix(line, "name:"))
-			nameValue = strings.Trim(nameValue, "\"'")
-			if nameValue != "" {
-				foundName = true
+	for itemType, value := range typeThresholds {
+		if flagsSet[itemType+"-threshold"] {
+			if opts.TypeThresholds == nil {
+				opts.TypeThresholds = map[string]float32{}
 			}
+			opts.TypeThresholds[itemType] = float32(*value)
 		}
 	}
+	opts.UseDaemon = !*noDaemon
 
-	return foundClosing && foundName
-}
-
-// loadItems reads file or directory and loads content
-func loadItems(path string) ([]Item, error) {
-	var items []Item
-
-	info, err := os.Stat(path)
-	if err != nil {
-		return nil, err
+	// Hook mode never fails the prompt - errors are reported on stderr only
+	if *hook {
+		runHook(os.Stdin, os.Stdout, opts, tmpl)
+		return
 	}
 
-	// Single file
-	if !info.IsDir() {
-		content, err := os.ReadFile(path)
-		if err != nil {
-			return nil, err
-		}
-
-		contentStr := string(content)
-		if !isValidSkillFile(path, contentStr) {
-			return nil, fmt.Errorf("file must be .md with valid frontmatter (name field required)")
-		}
-
-		name, priority, itemType := extractMetadata(contentStr, path)
-		items = append(items, Item{
-			Name:     name,
-			Path:     path,
-			Content:  contentStr,
-			Priority: priority,
-			Type:     itemType,
-		})
-		return items, nil
+	// Validate required flags
+	if *prompt == "" || (*embed == "" && *indexPath == "") {
+		fmt.Fprintln(os.Stderr, "Error: -prompt and -embed (or -index) are required")
+		fmt.Fprintln(os.Stderr, "")
+		flag.Usage()
+		os.Exit(1)
 	}
 
-	// Directory - recursively walk and read all files
-	err = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if info.IsDir() {
-			return nil
-		}
-
-		content, err := os.ReadFile(p)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to read %s: %v\n", p, err)
-			return nil // Continue walking
-		}
-
-		contentStr := string(content)
-
-		// Skip files that don't meet validation criteria
-		if !isValidSkillFile(p, contentStr) {
-			return nil // Skip silently
-		}
-
-		// Extract name, priority, and type from frontmatter
-		name, priority, itemType := extractMetadata(contentStr, p)
-
-		items = append(items, Item{
-			Name:     name,
-			Path:     p,
-			Content:  contentStr,
-			Priority: priority,
-			Type:     itemType,
-		})
-
-		return nil
-	})
-
-	return items, err
-}
-
-// extractMetadata extracts name, priority, and type from frontmatter and path
-func extractMetadata(content string, path string) (string, string, string) {
-	name := ""
-	priority := "medium" // default priority
-	itemType := ""       // will be detected from path or frontmatter
-
-	// Try to parse frontmatter
-	lines := strings.Split(content, "\n")
-	if len(lines) > 0 && strings.HasPrefix(lines[0], "---") {
-		// Look for name, priority, and type in frontmatter
-		for i := 1; i < len(lines); i++ {
-			line := strings.TrimSpace(lines[i])
-			if line == "---" {
-				break // End of frontmatter
-			}
-
-			// Look for name: value
-			if strings.HasPrefix(line, "name:") {
-				nameValue := strings.TrimSpace(strings.TrimPrefix(line, "name:"))
-				nameValue = strings.Trim(nameValue, "\"'") // Remove quotes if present
-				if nameValue != "" {
-					name = nameValue
-				}
-			}
-
-			// Look for priority: value
-			if strings.HasPrefix(line, "priority:") {
-				priorityValue := strings.TrimSpace(strings.TrimPrefix(line, "priority:"))
-				priorityValue = strings.Trim(priorityValue, "\"'") // Remove quotes if present
-				if priorityValue != "" {
-					priority = priorityValue
-				}
-			}
-
-			// Look for type: value
-			if strings.HasPrefix(line, "type:") {
-				typeValue := strings.TrimSpace(strings.TrimPrefix(line, "type:"))
-				typeValue = strings.Trim(typeValue, "\"'") // Remove quotes if present
-				if typeValue != "" {
-					itemType = typeValue
-				}
-			}
-		}
+	result, err := classify(*prompt, opts)
+	warnDiagnostics(result.Diagnostics)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		os.Exit(1)
 	}
 
-	// If no name found in frontmatter, fallback to absolute path
-	if name == "" {
-		absPath, err := filepath.Abs(path)
-		if err == nil {
-			name = absPath
-		} else {
-			name = path
+	if *why != "" {
+		if err := writeWhy(os.Stderr, *why, result); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			os.Exit(1)
 		}
+	} else if *explain {
+		writeExplanations(os.Stderr, result.Explanations)
 	}
 
-	// Auto-detect type from path if not specified in frontmatter
-	if itemType == "" {
-		if strings.Contains(path, "/agents/") || strings.Contains(path, "\\agents\\") {
-			itemType = "agent"
-		} else if strings.Contains(path, "/skills/") || strings.Contains(path, "\\skills\\") {
-			itemType = "skill"
-		} else {
-			// Default to skill if can't determine
-			itemType = "skill"
+	// Output results
+	switch *format {
+	case formatJSON:
+		err = writeJSON(os.Stdout, result, opts.request(*prompt))
+	case formatNDJSON:
+		err = writeNDJSON(os.Stdout, result, opts.request(*prompt))
+	default:
+		if len(result.Matches) > 0 {
+			err = outputWithTemplate(result.Matches, tmpl)
 		}
 	}
-
-	return name, priority, itemType
-}
-
-// matchItems computes similarity between prompt and item contents
-func matchItems(model llama.Model, lctx llama.Context, promptEmbed []float32, items []Item, threshold float32) []Match {
-	var matches []Match
-
-	// Get model's max context size and be conservative (leave room for special tokens)
-	maxTokens := int(llama.NCtx(lctx)) - 10
-
-	// Get context params for recreation
-	ctxParams := llama.ContextDefaultParams()
-	ctxParams.NCtx = 512
-	ctxParams.NBatch = 512
-	ctxParams.NUbatch = 512
-	ctxParams.Embeddings = 1
-
-	for _, item := range items {
-		// Preprocess text before embedding (removes stop words, whitespace, frontmatter)
-		itemText := preprocessText(strings.ToLower(item.Content))
-
-		// Try to load from cache first
-		itemEmbed, cached := loadCachedEmbedding(itemText)
-
-		if !cached {
-			// Not in cache - generate embedding
-			// Conservative char-based truncation (estimate ~3 chars per token to be safe)
-			maxChars := maxTokens * 3
-			if len(itemText) > maxChars {
-				itemText = itemText[:maxChars]
-			}
-
-			// Create fresh context for each file to avoid state accumulation
-			itemCtx := llama.InitFromModel(model, ctxParams)
-			if itemCtx == 0 {
-				fmt.Fprintf(os.Stderr, "Warning: failed to create context for %s\n", item.Name)
-				continue
-			}
-
-			var err error
-			itemEmbed, err = getEmbedding(model, itemCtx, itemText)
-			llama.Free(itemCtx)
-
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Warning: failed to embed %s: %v\n", item.Name, err)
-				continue
-			}
-
-			// Save to cache for next time
-			if err := saveCachedEmbedding(itemText, itemEmbed); err != nil {
-				fmt.Fprintf(os.Stderr, "Warning: failed to cache embedding for %s: %v\n", item.Name, err)
-			}
-		}
-
-		// Compute cosine similarity
-		similarity := cosineSimilarity(promptEmbed, itemEmbed)
-
-		if similarity >= threshold {
-			matches = append(matches, Match{
-				Name:       item.Name,
-				Path:       item.Path,
-				Similarity: similarity,
-				Priority:   item.Priority,
-				Type:       item.Type,
-			})
-		}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to write output: %v\n", err)
+		os.Exit(1)
 	}
-
-	return matches
 }
 
-// cosineSimilarity computes cosine similarity between two vectors
-func cosineSimilarity(a, b []float32) float32 {
-	if len(a) != len(b) {
-		return 0
-	}
-
-	var dotProduct float32
-	for i := range a {
-		dotProduct += a[i] * b[i]
+// warnDiagnostics reports item files that could not be loaded or scored,
+// and other problems that did not stop the classification, on stderr
+func warnDiagnostics(diagnostics []classifier.Diagnostic) {
+	for _, d := range diagnostics {
+		if d.Path == "" {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", d)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Warning: skipped %s\n", d)
 	}
-
-	// Vectors are already normalized, so dot product = cosine similarity
-	return dotProduct
 }
 
-// hashContent returns SHA256 hash of content
-func hashContent(content string) string {
-	h := sha256.Sum256([]byte(content))
-	return hex.EncodeToString(h[:])
+// classifyOptions holds the settings shared by the CLI and hook entry points
+type classifyOptions struct {
+	Embed          string
+	Index          string
+	Threshold      float32
+	OutputType     string
+	Mode           string
+	LLMThreshold   float32
+	Shortlist      int
+	ChunkSize      int
+	ChunkOverlap   int
+	ChunkAggregate string
+	ChunkTopK      int
+	Explain        bool
+	Config         string
+	TypeThresholds map[string]float32
+	TopK           int
+	MinMargin      float32
+	MaxPerType     map[string]int
+	EmbeddingModel string
+	LLMModel       string
+	LibPath        string
+	LlamaVersion   string
+	Processor      string
+	LlamaLogLevel  int
+	UseDaemon      bool
+	IdleTimeout    time.Duration
+	MaxCacheSize   byteSize
+	Offline        bool
 }
 
-// getCacheFile returns path to cache file for given hash
-func getCacheFile(hash, cacheType string) string {
-	cacheDir := filepath.Join(getCacheDir(), cacheType)
-	os.MkdirAll(cacheDir, 0755)
-	return filepath.Join(cacheDir, hash+".cache")
+// addEngineFlags registers the flags that select the model and llama.cpp backend
+func addEngineFlags(fs *flag.FlagSet, opts *classifyOptions) {
+	fs.StringVar(&opts.EmbeddingModel, "embedding-model", defaultEmbeddingModel, "Embedding model URL or path")
+	fs.StringVar(&opts.LLMModel, "llm-model", defaultLLMModel, "LLM URL or path for llm/hybrid modes")
+	fs.StringVar(&opts.LibPath, "lib", "", "llama.cpp library path (auto-detect if empty)")
+	fs.StringVar(&opts.LlamaVersion, "llama-version", "", "llama.cpp build to install on first run, e.g. "+defaultLlamaVersion+"; an installed build must match (default: the installed build, or "+defaultLlamaVersion+")")
+	fs.StringVar(&opts.Processor, "processor", "cpu", "Processor type: cpu, cuda, vulkan, metal (default: cpu)")
+	fs.IntVar(&opts.LlamaLogLevel, "llama-log-level", 0, "Llama.cpp log level (0=disabled, 1=error, 2=warn, 3=info)")
+	fs.DurationVar(&opts.IdleTimeout, "idle-timeout", defaultIdleTimeout, "Shut the daemon down after this long without requests (0 = never, env: IC_IDLE_TIMEOUT)")
+	fs.BoolVar(&opts.Offline, "offline", false, "Never download models or llama.cpp, fail listing what is missing instead (env: IC_OFFLINE)")
 }
 
-// loadCachedEmbedding loads embedding from cache if exists
-func loadCachedEmbedding(content string) ([]float32, bool) {
-	hash := hashContent(content)
-	cacheFile := getCacheFile(hash, "embeddings")
-
-	data, err := os.ReadFile(cacheFile)
-	if err != nil {
-		return nil, false
-	}
-
-	// Decode float32 array
-	if len(data)%4 != 0 {
-		return nil, false
+// request builds the classification request for prompt
+func (opts classifyOptions) request(prompt string) classifyRequest {
+	return classifyRequest{
+		Prompt:       prompt,
+		Embed:        opts.Embed,
+		Threshold:    opts.Threshold,
+		OutputType:   opts.OutputType,
+		Mode:         opts.Mode,
+		LLMThreshold: opts.LLMThreshold,
+		Shortlist:    opts.Shortlist,
+
+		ChunkSize:      opts.ChunkSize,
+		ChunkOverlap:   opts.ChunkOverlap,
+		ChunkAggregate: opts.ChunkAggregate,
+		ChunkTopK:      opts.ChunkTopK,
+		Explain:        opts.Explain,
+		ExplainAll:     opts.Explain,
+
+		Index:          opts.Index,
+		Config:         opts.Config,
+		TypeThresholds: opts.TypeThresholds,
+
+		TopK:       opts.TopK,
+		MinMargin:  opts.MinMargin,
+		MaxPerType: opts.MaxPerType,
+
+		MaxCacheSize: int64(opts.MaxCacheSize),
 	}
-
-	embedding := make([]float32, len(data)/4)
-	for i := range embedding {
-		bits := uint32(data[i*4]) | uint32(data[i*4+1])<<8 | uint32(data[i*4+2])<<16 | uint32(data[i*4+3])<<24
-		embedding[i] = math.Float32frombits(bits)
-	}
-
-	return embedding, true
-}
-
-// saveCachedEmbedding saves embedding to cache
-func saveCachedEmbedding(content string, embedding []float32) error {
-	hash := hashContent(content)
-	cacheFile := getCacheFile(hash, "embeddings")
-
-	// Encode float32 array
-	data := make([]byte, len(embedding)*4)
-	for i, v := range embedding {
-		bits := math.Float32bits(v)
-		data[i*4] = byte(bits)
-		data[i*4+1] = byte(bits >> 8)
-		data[i*4+2] = byte(bits >> 16)
-		data[i*4+3] = byte(bits >> 24)
-	}
-
-	return os.WriteFile(cacheFile, data, 0644)
 }
 
-// outputWithTemplate renders matches grouped by type and priority
-func outputWithTemplate(matches []Match, outputType string) {
-	// Separate matches by type and priority
-	skillsByPriority := map[string][]string{
-		"critical": {},
-		"high":     {},
-		"medium":   {},
-		"low":      {},
-	}
-	agentsByPriority := map[string][]string{
-		"critical": {},
-		"high":     {},
-		"medium":   {},
-		"low":      {},
-	}
-
-	for _, match := range matches {
-		priority := strings.ToLower(match.Priority)
-		if priority != "critical" && priority != "high" && priority != "medium" && priority != "low" {
-			priority = "medium" // default
-		}
-
-		if match.Type == "agent" {
-			agentsByPriority[priority] = append(agentsByPriority[priority], match.Name)
+// applyEngineEnv applies IC_IDLE_TIMEOUT and IC_OFFLINE unless the
+// matching flag was given
+func applyEngineEnv(fs *flag.FlagSet, opts *classifyOptions) {
+	flagsSet := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		flagsSet[f.Name] = true
+	})
+	if env := os.Getenv("IC_IDLE_TIMEOUT"); env != "" && !flagsSet["idle-timeout"] {
+		if d, err := time.ParseDuration(env); err == nil {
+			opts.IdleTimeout = d
 		} else {
-			skillsByPriority[priority] = append(skillsByPriority[priority], match.Name)
+			fmt.Fprintf(os.Stderr, "Warning: Invalid IC_IDLE_TIMEOUT env var '%s', using default\n", env)
 		}
 	}
-
-	// Count totals
-	hasSkills := len(skillsByPriority["critical"])+len(skillsByPriority["high"])+len(skillsByPriority["medium"])+len(skillsByPriority["low"]) > 0
-	hasAgents := len(agentsByPriority["critical"])+len(agentsByPriority["high"])+len(agentsByPriority["medium"])+len(agentsByPriority["low"]) > 0
-
-	var output strings.Builder
-	output.WriteString("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n")
-
-	if hasSkills && hasAgents {
-		output.WriteString("🎯 SKILLS & AGENTS ACTIVATION CHECK\n")
-	} else if hasAgents {
-		output.WriteString("🤖 AGENTS ACTIVATION CHECK\n")
-	} else {
-		output.WriteString("🎯 SKILLS ACTIVATION CHECK\n")
-	}
-
-	output.WriteString("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n")
-	output.WriteString("\n")
-
-	// Output skills section
-	if hasSkills {
-		outputSection(&output, "SKILLS", "", skillsByPriority)
-	}
-
-	// Output agents section
-	if hasAgents {
-		if hasSkills {
-			output.WriteString("\n") // Extra spacing between sections
+	if env := os.Getenv("IC_OFFLINE"); env != "" && !flagsSet["offline"] {
+		if offline, err := strconv.ParseBool(env); err == nil {
+			opts.Offline = offline
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: Invalid IC_OFFLINE env var '%s', using default\n", env)
 		}
-		outputSection(&output, "AGENTS", "@", agentsByPriority)
 	}
+}
 
-	// Build action text
-	var actionParts []string
-	if hasSkills {
-		actionParts = append(actionParts, "Use Skill tool")
-	}
-	if hasAgents {
-		var agentList []string
-		for _, priority := range []string{"critical", "high", "medium", "low"} {
-			for _, agent := range agentsByPriority[priority] {
-				agentList = append(agentList, "@"+agent)
-			}
-		}
-		if len(agentList) > 0 {
-			actionParts = append(actionParts, "Use "+strings.Join(agentList, ", "))
+// classify returns the items under opts.Embed whose similarity to prompt
+// reaches the threshold. A running (or freshly spawned) daemon answers when
+// available; otherwise the model is loaded in-process for this one request.
+func classify(prompt string, opts classifyOptions) (classifyResult, error) {
+	start := time.Now()
+
+	if opts.UseDaemon {
+		result, err := classifyViaDaemon(prompt, opts)
+		if !errors.Is(err, errDaemonUnavailable) {
+			result.Timings.TotalMs = millisSince(start)
+			return result, err
 		}
 	}
 
-	if len(actionParts) > 0 {
-		output.WriteString("ACTION: " + strings.Join(actionParts, " and ") + "\n")
+	eng, err := newEngine(opts)
+	if err != nil {
+		return classifyResult{}, err
 	}
+	defer eng.close()
+	loadMs := millisSince(start)
 
-	output.WriteString("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n")
-
-	fmt.Print(output.String())
+	result, err := eng.classify(opts.request(prompt))
+	result.Timings.LoadMs = loadMs
+	result.Timings.TotalMs = millisSince(start)
+	return result, err
 }
 
-// outputSection outputs a single section (skills or agents) grouped by priority
-func outputSection(output *strings.Builder, label string, prefix string, itemsByPriority map[string][]string) {
-	if len(itemsByPriority["critical"]) > 0 {
-		output.WriteString("⚠️  CRITICAL " + label + " (REQUIRED):\n")
-		for _, item := range itemsByPriority["critical"] {
-			output.WriteString("  → " + prefix + item + "\n")
-		}
-		output.WriteString("\n")
-	}
-
-	if len(itemsByPriority["high"]) > 0 {
-		output.WriteString("📚 RECOMMENDED " + label + ":\n")
-		for _, item := range itemsByPriority["high"] {
-			output.WriteString("  → " + prefix + item + "\n")
-		}
-		output.WriteString("\n")
-	}
-
-	if len(itemsByPriority["medium"]) > 0 {
-		output.WriteString("💡 SUGGESTED " + label + ":\n")
-		for _, item := range itemsByPriority["medium"] {
-			output.WriteString("  → " + prefix + item + "\n")
-		}
-		output.WriteString("\n")
+// resolveModel resolves a model URL or path, optionally pinned with
+// #sha256=<hex>, to a verified local GGUF file path. A model missing from
+// IC_MODEL_DIR and the cache is downloaded, unless offline is set.
+func resolveModel(spec string, modelType string, offline bool) (string, error) {
+	pinned, err := parseModelSpec(spec)
+	if err != nil {
+		return "", err
 	}
-
-	if len(itemsByPriority["low"]) > 0 {
-		output.WriteString("📌 OPTIONAL " + label + ":\n")
-		for _, item := range itemsByPriority["low"] {
-			output.WriteString("  → " + prefix + item + "\n")
-		}
-		output.WriteString("\n")
+	modelSpec := pinned.Location
+	if pinned.SHA256 == "" {
+		pinned.SHA256 = presetPins[modelSpec]
 	}
-}
 
-// resolveModel resolves a model URL or path to a local GGUF file path
-func resolveModel(modelSpec string, modelType string) string {
-	// If it's already a local file path, return it
+	// If it's already a local file path, verify and return it
 	if _, err := os.Stat(modelSpec); err == nil {
-		return modelSpec
+		if err := verifyModel(modelSpec, pinned.SHA256, ""); err != nil {
+			return "", err
+		}
+		return modelSpec, nil
 	}
 
 	// Must be a URL - download it
 	if !strings.HasPrefix(modelSpec, "http://") && !strings.HasPrefix(modelSpec, "https://") {
-		fmt.Fprintf(os.Stderr, "❌ Model must be either a local path or a URL: %s\n", modelSpec)
-		os.Exit(1)
+		return "", fmt.Errorf("model must be either a local path or a URL: %s", modelSpec)
 	}
 
 	// Extract filename from URL
@@ -771,180 +528,85 @@ func resolveModel(modelSpec string, modelType string) string {
 		filename = filename[:idx]
 	}
 
-	// Build cache path
-	cacheDir := filepath.Join(getCacheDir(), "models", modelType)
-	os.MkdirAll(cacheDir, 0755)
-	modelPath := filepath.Join(cacheDir, filename)
-
-	// If model already cached, return path
-	if _, err := os.Stat(modelPath); err == nil {
-		return modelPath
+	// Models seeded into IC_MODEL_DIR (e.g. a Nix store path or a shared
+	// volume) are used in place: a copy failing verification is an error
+	// rather than something to remove and download again
+	modelDir := os.Getenv("IC_MODEL_DIR")
+	var seeded []string
+	if modelDir != "" {
+		seeded = []string{filepath.Join(modelDir, modelType), modelDir}
 	}
-
-	// Download model using HTTP client
-	fmt.Printf("📥 Downloading %s model...\n", modelType)
-	fmt.Printf("   From: %s\n", modelSpec)
-
-	if err := downloadFile(modelSpec, modelPath); err != nil {
-		fmt.Fprintf(os.Stderr, "❌ Failed to download model: %v\n", err)
-		os.Exit(1)
-	}
-
-	// Verify model file exists and has non-zero size
-	if stat, err := os.Stat(modelPath); err != nil {
-		fmt.Fprintf(os.Stderr, "❌ Model file not found after download: %v\n", err)
-		os.Exit(1)
-	} else if stat.Size() == 0 {
-		fmt.Fprintf(os.Stderr, "❌ Downloaded model file is empty\n")
-		os.Exit(1)
-	}
-
-	fmt.Println("✅ Model downloaded successfully")
-	return modelPath
-}
-
-// downloadFile downloads a file from a URL to a local path
-func downloadFile(url string, filepath string) error {
-	// Create the file
-	out, err := os.Create(filepath)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	// Get the data
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
+	for _, dir := range seeded {
+		path := filepath.Join(dir, filename)
+		if _, err := os.Stat(path); err == nil {
+			if err := verifyModel(path, pinned.SHA256, seededSumFile(path)); err != nil {
+				return "", err
+			}
+			return path, nil
+		}
 	}
-	defer resp.Body.Close()
 
-	// Check server response
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("bad status: %s", resp.Status)
-	}
+	// Build cache path
+	cacheDir := filepath.Join(classifier.CacheDir(), "models", modelType)
+	modelPath := filepath.Join(cacheDir, filename)
 
-	// Write the body to file
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
-		return err
+	// If model already cached, mark it used for "cache prune --models" and return path
+	if cachedModel(modelPath, pinned.SHA256) {
+		now := time.Now()
+		os.Chtimes(modelPath, now, now)
+		return modelPath, nil
 	}
 
-	// Ensure data is flushed to disk before returning
-	return out.Sync()
-}
-
-// ensureLlamaLib ensures llama.cpp library is available
-func ensureLlamaLib(processor string) string {
-	// 1. Check if already exists in current directory
-	libName := download.LibraryName(runtime.GOOS)
-	if _, err := os.Stat(libName); err == nil {
-		return "."
+	if offline {
+		return "", missingOffline(missingFile{
+			What:   modelType + " model " + filename,
+			Looked: append(seeded, cacheDir),
+			Source: modelSpec,
+		})
 	}
-
-	// 2. Check cache directory
-	cacheDir := getCacheDir()
 	os.MkdirAll(cacheDir, 0755)
 
-	libPath := filepath.Join(cacheDir, libName)
-	if _, err := os.Stat(libPath); err == nil {
-		return cacheDir
-	}
-
-	// 3. Download llama.cpp
-	fmt.Println("📥 Downloading llama.cpp library (first time setup)...")
-
-	version, err := download.LlamaLatestVersion()
+	// Concurrent runs (e.g. several hooks at once) wait for a single download
+	lock, err := classifier.LockFile(modelPath + ".lock")
 	if err != nil {
-		fmt.Println("⚠️  Could not get latest version, using default...")
-		version = "b6795"
-	}
-
-	fmt.Printf("📦 Installing llama.cpp version %s (%s)...\n", version, processor)
-	if err := download.Get(runtime.GOOS, processor, version, cacheDir); err != nil {
-		fmt.Fprintf(os.Stderr, "❌ Failed to download llama.cpp: %v\n", err)
-		os.Exit(1)
+		return "", fmt.Errorf("failed to lock %s: %w", modelPath, err)
 	}
-
-	// Fix broken symlinks (tar extraction sometimes creates text files instead of symlinks)
-	if err := fixBrokenSymlinks(cacheDir); err != nil {
-		// Non-fatal - warn but continue
-		fmt.Fprintf(os.Stderr, "⚠️  Warning: Could not fix symlinks: %v\n", err)
+	defer lock.Unlock()
+	if cachedModel(modelPath, pinned.SHA256) {
+		return modelPath, nil
 	}
 
-	// Verify library file exists and is readable
-	if _, err := os.Stat(libPath); err != nil {
-		fmt.Fprintf(os.Stderr, "❌ Library file not found after download: %v\n", err)
-		os.Exit(1)
-	}
+	// Download model using HTTP client (progress goes to stderr, stdout is reserved for results)
+	fmt.Fprintf(os.Stderr, "📥 Downloading %s model...\n", modelType)
+	fmt.Fprintf(os.Stderr, "   From: %s\n", modelSpec)
 
-	fmt.Println("✅ llama.cpp library installed successfully")
-	return cacheDir
-}
-
-// fixBrokenSymlinks repairs symlinks that were extracted as text files
-func fixBrokenSymlinks(dir string) error {
-	entries, err := os.ReadDir(dir)
-	if err != nil {
+	sum, err := downloadFile(modelSpec, modelPath, pinned.SHA256, func(r io.Reader) error {
+		_, err := classifier.ParseGGUFHeader(r)
 		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to download model from %s: %w", modelSpec, err)
 	}
-
-	for _, entry := range entries {
-		// Only check .so* files
-		if !strings.Contains(entry.Name(), ".so") {
-			continue
-		}
-
-		path := filepath.Join(dir, entry.Name())
-		info, err := entry.Info()
-		if err != nil {
-			continue
-		}
-
-		// Skip if already a symlink or too large
-		if info.Mode()&os.ModeSymlink != 0 || info.Size() >= 100 {
-			continue
-		}
-
-		// Read content - should be the symlink target
-		content, err := os.ReadFile(path)
-		if err != nil {
-			continue
-		}
-
-		target := strings.TrimSpace(string(content))
-		// Validate: single line, target exists
-		if strings.Contains(target, "\n") || target == "" {
-			continue
-		}
-
-		targetPath := filepath.Join(dir, target)
-		if _, err := os.Stat(targetPath); err != nil {
-			continue
-		}
-
-		// Replace text file with symlink
-		os.Remove(path)
-		os.Symlink(target, path)
+	if err := writeSum(sumFile(modelPath), modelPath, sum); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record checksum of %s: %v\n", modelPath, err)
 	}
 
-	return nil
+	fmt.Fprintln(os.Stderr, "✅ Model downloaded successfully")
+	return modelPath, nil
 }
 
-// getCacheDir returns a cross-platform cache directory
-func getCacheDir() string {
-	if runtime.GOOS == "windows" {
-		localAppData := os.Getenv("LOCALAPPDATA")
-		if localAppData != "" {
-			return filepath.Join(localAppData, "intent-classifier")
-		}
-		return filepath.Join(os.Getenv("USERPROFILE"), "AppData", "Local", "intent-classifier")
+// cachedModel reports whether a usable copy of the model is cached at
+// modelPath. A copy that fails verification is removed with a warning, so
+// it gets downloaded again.
+func cachedModel(modelPath string, pin string) bool {
+	if _, err := os.Stat(modelPath); err != nil {
+		return false
 	}
-
-	// Unix-like systems (Linux, macOS, BSD)
-	if xdgCache := os.Getenv("XDG_CACHE_HOME"); xdgCache != "" {
-		return filepath.Join(xdgCache, "intent-classifier")
+	if err := verifyModel(modelPath, pin, sumFile(modelPath)); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: removing cached model: %v\n", err)
+		os.Remove(modelPath)
+		os.Remove(sumFile(modelPath))
+		return false
 	}
-
-	return filepath.Join(os.Getenv("HOME"), ".cache", "intent-classifier")
+	return true
 }
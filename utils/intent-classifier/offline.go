@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// missingFile is a model or library that offline mode would have downloaded
+type missingFile struct {
+	What   string   // e.g. "embedding model all-MiniLM-L6-v2-Q5_K_M.gguf"
+	Looked []string // directories searched
+	Source string   // where it would be downloaded from, "" if unknown
+}
+
+// offlineError lists everything a run needs that offline mode may not
+// download, with the ways to provide it
+type offlineError struct {
+	missing []missingFile
+}
+
+func (e *offlineError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "offline mode: %d required file(s) missing, refusing to download:", len(e.missing))
+	for _, m := range e.missing {
+		fmt.Fprintf(&b, "\n  - %s (looked in %s)", m.What, strings.Join(m.Looked, ", "))
+		if m.Source != "" {
+			fmt.Fprintf(&b, "\n    from %s", m.Source)
+		}
+	}
+	b.WriteString("\nRun once without --offline (IC_OFFLINE) to download them, or pre-seed them:")
+	b.WriteString("\n  IC_LIB_DIR=<dir containing the llama.cpp library> or --lib <dir>")
+	b.WriteString("\n  IC_MODEL_DIR=<dir containing <type>/<file>.gguf or <file>.gguf>")
+	b.WriteString("\n  or a local path for --embedding-model / --llm-model")
+	return b.String()
+}
+
+// missingOffline returns the error for a single missing file
+func missingOffline(m missingFile) error {
+	return &offlineError{missing: []missingFile{m}}
+}
+
+// joinOffline merges the offline errors among errs into one, so a run
+// reports everything missing at once. Any other error takes precedence.
+func joinOffline(errs ...error) error {
+	merged := &offlineError{}
+	for _, err := range errs {
+		var offline *offlineError
+		switch {
+		case err == nil:
+		case errors.As(err, &offline):
+			merged.missing = append(merged.missing, offline.missing...)
+		default:
+			return err
+		}
+	}
+	if len(merged.missing) == 0 {
+		return nil
+	}
+	return merged
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestJoinOffline(t *testing.T) {
+	lib := missingOffline(missingFile{What: "llama.cpp library libllama.so", Looked: []string{"."}})
+	model := missingOffline(missingFile{What: "embedding model a.gguf", Looked: []string{"/cache"}, Source: "https://example.com/a.gguf"})
+	other := errors.New("bad pin")
+
+	tests := []struct {
+		name    string
+		errs    []error
+		want    []string // substrings of the joined error, none when nil
+		missing int
+	}{
+		{"none", []error{nil, nil}, nil, 0},
+		{"one", []error{nil, model}, []string{"1 required file(s)", "a.gguf", "from https://example.com/a.gguf"}, 1},
+		{"both", []error{lib, model}, []string{"2 required file(s)", "libllama.so", "a.gguf"}, 2},
+		{"other error wins", []error{lib, other}, []string{"bad pin"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := joinOffline(tt.errs...)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("joinOffline() = %v, expected nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("joinOffline() = nil")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("joinOffline() = %q, expected it to contain %q", err, want)
+				}
+			}
+			var offline *offlineError
+			if errors.As(err, &offline) && len(offline.missing) != tt.missing {
+				t.Errorf("joinOffline() lists %d files, expected %d", len(offline.missing), tt.missing)
+			}
+		})
+	}
+}
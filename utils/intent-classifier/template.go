@@ -0,0 +1,254 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"intent-classifier/classifier"
+)
+
+// builtinTemplates holds the named templates selectable with --template
+//
+//go:embed templates/*.tmpl
+var builtinTemplates embed.FS
+
+// priorities lists priority levels from most to least important
+var priorities = []string{"critical", "high", "medium", "low"}
+
+// templateData is the value templates are executed with
+type templateData struct {
+	Matches     []classifier.Match // all matches, most similar first
+	Skills      priorityGroups     // skill matches grouped by priority
+	Agents      priorityGroups     // agent matches grouped by priority
+	Commands    priorityGroups     // command matches grouped by priority
+	HasSkills   bool
+	HasAgents   bool
+	HasCommands bool
+	Heading     string // matched types, e.g. "SKILLS & AGENTS"
+	Action      string // e.g. "Use Skill tool and Use @a, @b"
+}
+
+// priorityGroups holds the matches of one type by priority level
+type priorityGroups struct {
+	Critical []classifier.Match
+	High     []classifier.Match
+	Medium   []classifier.Match
+	Low      []classifier.Match
+}
+
+// priorityGroup is one priority level and its matches
+type priorityGroup struct {
+	Priority string
+	Matches  []classifier.Match
+}
+
+// ByPriority returns the non-empty groups from critical to low
+func (g priorityGroups) ByPriority() []priorityGroup {
+	var groups []priorityGroup
+	for _, priority := range priorities {
+		if matches := g.get(priority); len(matches) > 0 {
+			groups = append(groups, priorityGroup{Priority: priority, Matches: matches})
+		}
+	}
+	return groups
+}
+
+// All returns every match from critical to low
+func (g priorityGroups) All() []classifier.Match {
+	var all []classifier.Match
+	for _, priority := range priorities {
+		all = append(all, g.get(priority)...)
+	}
+	return all
+}
+
+// get returns the matches for priority
+func (g priorityGroups) get(priority string) []classifier.Match {
+	switch priority {
+	case "critical":
+		return g.Critical
+	case "high":
+		return g.High
+	case "low":
+		return g.Low
+	default:
+		return g.Medium
+	}
+}
+
+// add appends match to the group of its priority
+func (g *priorityGroups) add(match classifier.Match) {
+	switch match.Priority {
+	case "critical":
+		g.Critical = append(g.Critical, match)
+	case "high":
+		g.High = append(g.High, match)
+	case "low":
+		g.Low = append(g.Low, match)
+	default:
+		g.Medium = append(g.Medium, match)
+	}
+}
+
+// normalizePriority lowercases priority, treating unknown values as medium
+func normalizePriority(priority string) string {
+	priority = strings.ToLower(priority)
+	for _, known := range priorities {
+		if priority == known {
+			return priority
+		}
+	}
+	return "medium" // default
+}
+
+// sectionData is passed to sub-templates rendering one type
+type sectionData struct {
+	Label  string
+	Prefix string
+	Groups priorityGroups
+}
+
+// templateFuncs are available to built-in and user templates
+var templateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"score": func(similarity float32) string {
+		return fmt.Sprintf("%.2f", similarity)
+	},
+	"section": func(label string, prefix string, groups priorityGroups) sectionData {
+		return sectionData{Label: label, Prefix: prefix, Groups: groups}
+	},
+}
+
+// builtinTemplateNames returns the names accepted by --template
+func builtinTemplateNames() []string {
+	entries, _ := builtinTemplates.ReadDir("templates")
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".tmpl"))
+	}
+	return names
+}
+
+// loadTemplate returns the built-in template called spec, or parses the
+// template file at path spec
+func loadTemplate(spec string) (*template.Template, error) {
+	if spec == "" {
+		spec = "default"
+	}
+
+	if content, err := builtinTemplates.ReadFile("templates/" + spec + ".tmpl"); err == nil {
+		return template.New(spec).Funcs(templateFuncs).Parse(string(content))
+	}
+
+	content, err := os.ReadFile(spec)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("template %q is neither a file nor a built-in (%s)", spec, strings.Join(builtinTemplateNames(), ", "))
+		}
+		return nil, fmt.Errorf("failed to read template: %w", err)
+	}
+
+	tmpl, err := template.New(filepath.Base(spec)).Funcs(templateFuncs).Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// newTemplateData groups matches by type and priority. Within each group
+// the most similar match comes first.
+func newTemplateData(matches []classifier.Match) templateData {
+	var data templateData
+
+	ranked := make([]classifier.Match, len(matches))
+	copy(ranked, matches)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Similarity > ranked[j].Similarity
+	})
+
+	for _, match := range ranked {
+		match.Priority = normalizePriority(match.Priority)
+		data.Matches = append(data.Matches, match)
+
+		switch match.Type {
+		case "agent":
+			data.Agents.add(match)
+		case "command":
+			data.Commands.add(match)
+		default:
+			data.Skills.add(match)
+		}
+	}
+
+	data.HasSkills = len(data.Skills.All()) > 0
+	data.HasAgents = len(data.Agents.All()) > 0
+	data.HasCommands = len(data.Commands.All()) > 0
+
+	// Build heading from the matched types
+	var labels []string
+	if data.HasSkills {
+		labels = append(labels, "SKILLS")
+	}
+	if data.HasAgents {
+		labels = append(labels, "AGENTS")
+	}
+	if data.HasCommands {
+		labels = append(labels, "COMMANDS")
+	}
+	if len(labels) == 0 {
+		labels = append(labels, "SKILLS")
+	}
+	data.Heading = labels[len(labels)-1]
+	if len(labels) > 1 {
+		data.Heading = strings.Join(labels[:len(labels)-1], ", ") + " & " + data.Heading
+	}
+
+	// Build action text
+	var actionParts []string
+	if data.HasSkills {
+		actionParts = append(actionParts, "Use Skill tool")
+	}
+	if data.HasAgents {
+		var agentList []string
+		for _, agent := range data.Agents.All() {
+			agentList = append(agentList, "@"+agent.Name)
+		}
+		actionParts = append(actionParts, "Use "+strings.Join(agentList, ", "))
+	}
+	if data.HasCommands {
+		var commandList []string
+		for _, command := range data.Commands.All() {
+			commandList = append(commandList, "/"+command.Name)
+		}
+		actionParts = append(actionParts, "Run "+strings.Join(commandList, ", "))
+	}
+	data.Action = strings.Join(actionParts, " and ")
+
+	return data
+}
+
+// renderMatches renders matches with tmpl
+func renderMatches(matches []classifier.Match, tmpl *template.Template) (string, error) {
+	var output strings.Builder
+	if err := tmpl.Execute(&output, newTemplateData(matches)); err != nil {
+		return "", fmt.Errorf("failed to render template: %w", err)
+	}
+	return output.String(), nil
+}
+
+// outputWithTemplate prints matches rendered with tmpl to stdout
+func outputWithTemplate(matches []classifier.Match, tmpl *template.Template) error {
+	output, err := renderMatches(matches, tmpl)
+	if err != nil {
+		return err
+	}
+	fmt.Print(output)
+	return nil
+}
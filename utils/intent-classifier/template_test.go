@@ -0,0 +1,181 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"intent-classifier/classifier"
+)
+
+var testMatches = []classifier.Match{
+	{Name: "security-scanner", Path: "skills/critical-skill.md", Similarity: 0.51, Priority: "critical", Type: "skill"},
+	{Name: "python-expert", Path: "skills/high-skill.md", Similarity: 0.42, Priority: "high", Type: "skill"},
+	{Name: "style-guide", Path: "skills/low-skill.md", Similarity: 0.21, Priority: "low", Type: "skill"},
+	{Name: "python-specialist", Path: "agents/python-agent.md", Similarity: 0.38, Priority: "high", Type: "agent"},
+	{Name: "code-analyzer", Path: "agents/medium-reviewer.md", Similarity: 0.25, Priority: "bogus", Type: "agent"},
+}
+
+func TestDefaultTemplate(t *testing.T) {
+	tmpl, err := loadTemplate("default")
+	if err != nil {
+		t.Fatalf("loadTemplate() error = %v", err)
+	}
+
+	const rule = "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n"
+	tests := []struct {
+		name     string
+		matches  []classifier.Match
+		expected string
+	}{
+		{
+			name:    "skills and agents",
+			matches: testMatches,
+			expected: rule + "🎯 SKILLS & AGENTS ACTIVATION CHECK\n" + rule + "\n" +
+				"⚠️  CRITICAL SKILLS (REQUIRED):\n  → security-scanner\n\n" +
+				"📚 RECOMMENDED SKILLS:\n  → python-expert\n\n" +
+				"📌 OPTIONAL SKILLS:\n  → style-guide\n\n\n" +
+				"📚 RECOMMENDED AGENTS:\n  → @python-specialist\n\n" +
+				"💡 SUGGESTED AGENTS:\n  → @code-analyzer\n\n" +
+				"ACTION: Use Skill tool and Use @python-specialist, @code-analyzer\n" + rule,
+		},
+		{
+			name:    "skills only",
+			matches: testMatches[:2],
+			expected: rule + "🎯 SKILLS ACTIVATION CHECK\n" + rule + "\n" +
+				"⚠️  CRITICAL SKILLS (REQUIRED):\n  → security-scanner\n\n" +
+				"📚 RECOMMENDED SKILLS:\n  → python-expert\n\n" +
+				"ACTION: Use Skill tool\n" + rule,
+		},
+		{
+			name:    "agents only",
+			matches: testMatches[3:],
+			expected: rule + "🤖 AGENTS ACTIVATION CHECK\n" + rule + "\n" +
+				"📚 RECOMMENDED AGENTS:\n  → @python-specialist\n\n" +
+				"💡 SUGGESTED AGENTS:\n  → @code-analyzer\n\n" +
+				"ACTION: Use @python-specialist, @code-analyzer\n" + rule,
+		},
+		{
+			name:    "skills and commands",
+			matches: append(testMatches[1:2:2], classifier.Match{Name: "deploy", Path: "commands/deploy.md", Similarity: 0.33, Priority: "medium", Type: "command"}),
+			expected: rule + "🎯 SKILLS & COMMANDS ACTIVATION CHECK\n" + rule + "\n" +
+				"📚 RECOMMENDED SKILLS:\n  → python-expert\n\n\n" +
+				"💡 SUGGESTED COMMANDS:\n  → /deploy\n\n" +
+				"ACTION: Use Skill tool and Run /deploy\n" + rule,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := renderMatches(tt.matches, tmpl)
+			if err != nil {
+				t.Fatalf("renderMatches() error = %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("renderMatches() =\n%q\nexpected\n%q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBuiltinTemplates(t *testing.T) {
+	tests := []struct {
+		name     string
+		contains []string
+	}{
+		{name: "plain", contains: []string{"Relevant skills: security-scanner, python-expert, style-guide\n", "Relevant agents: @python-specialist, @code-analyzer\n"}},
+		{name: "markdown", contains: []string{"### Skills", "- **python-expert** (high priority, similarity 0.42)", "- **@code-analyzer**"}},
+		{name: "xml-tags", contains: []string{"<intent-classifier>", `<skill name="python-expert" priority="high" similarity="0.42" path="skills/high-skill.md"/>`, "<agents>", "</intent-classifier>"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := loadTemplate(tt.name)
+			if err != nil {
+				t.Fatalf("loadTemplate() error = %v", err)
+			}
+			result, err := renderMatches(testMatches, tmpl)
+			if err != nil {
+				t.Fatalf("renderMatches() error = %v", err)
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(result, want) {
+					t.Errorf("expected output to contain %q, got:\n%s", want, result)
+				}
+			}
+		})
+	}
+}
+
+func TestUserTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "custom.tmpl")
+	content := `{{range .Skills.ByPriority}}{{upper .Priority}}:{{range .Matches}} {{.Name}}{{end}};{{end}}{{len .Matches}}`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl, err := loadTemplate(path)
+	if err != nil {
+		t.Fatalf("loadTemplate() error = %v", err)
+	}
+
+	result, err := renderMatches(testMatches, tmpl)
+	if err != nil {
+		t.Fatalf("renderMatches() error = %v", err)
+	}
+
+	expected := "CRITICAL: security-scanner;HIGH: python-expert;LOW: style-guide;5"
+	if result != expected {
+		t.Errorf("renderMatches() = %q, expected %q", result, expected)
+	}
+}
+
+func TestTemplateRanksMatches(t *testing.T) {
+	tmpl, err := loadTemplate("plain")
+	if err != nil {
+		t.Fatalf("loadTemplate() error = %v", err)
+	}
+
+	// Walk order puts the weaker match first
+	matches := []classifier.Match{
+		{Name: "flask-helper", Similarity: 0.31, Priority: "high", Type: "skill"},
+		{Name: "django-expert", Similarity: 0.57, Priority: "high", Type: "skill"},
+	}
+	result, err := renderMatches(matches, tmpl)
+	if err != nil {
+		t.Fatalf("renderMatches() error = %v", err)
+	}
+	if strings.Index(result, "django-expert") > strings.Index(result, "flask-helper") {
+		t.Errorf("expected the most similar match first, got:\n%s", result)
+	}
+}
+
+func TestLoadTemplateErrors(t *testing.T) {
+	if _, err := loadTemplate("no-such-template"); err == nil || !strings.Contains(err.Error(), "xml-tags") {
+		t.Errorf("expected error listing built-ins, got %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "broken.tmpl")
+	if err := os.WriteFile(path, []byte("{{range .Matches}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadTemplate(path); err == nil {
+		t.Error("expected parse error")
+	}
+}
+
+func TestNormalizePriority(t *testing.T) {
+	tests := map[string]string{
+		"critical": "critical",
+		"HIGH":     "high",
+		"low":      "low",
+		"":         "medium",
+		"urgent":   "medium",
+	}
+	for input, expected := range tests {
+		if result := normalizePriority(input); result != expected {
+			t.Errorf("normalizePriority(%q) = %q, expected %q", input, result, expected)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"intent-classifier/classifier"
+)
+
+// pinPrefix introduces a checksum pin in a model spec, e.g.
+// https://example.com/model.gguf#sha256=<64 hex digits>
+const pinPrefix = "#sha256="
+
+// modelSpec is a model URL or local path with an optional sha256 pin
+type modelSpec struct {
+	Location string
+	SHA256   string // lowercase hex, "" when unpinned
+}
+
+// parseModelSpec splits the pin off a --embedding-model or --llm-model value
+func parseModelSpec(spec string) (modelSpec, error) {
+	i := strings.LastIndex(spec, pinPrefix)
+	if i < 0 {
+		return modelSpec{Location: spec}, nil
+	}
+
+	sum := strings.ToLower(spec[i+len(pinPrefix):])
+	if _, err := hex.DecodeString(sum); err != nil || len(sum) != sha256.Size*2 {
+		return modelSpec{}, fmt.Errorf("invalid sha256 pin %q in %s: expected 64 hex digits", sum, spec[:i])
+	}
+	return modelSpec{Location: spec[:i], SHA256: sum}, nil
+}
+
+// fileSHA256 returns the hex sha256 of the file at path
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checksumError reports a file whose content does not match its pin
+func checksumError(name, want, got string) error {
+	return fmt.Errorf("checksum mismatch for %s: expected sha256 %s, got %s", name, want, got)
+}
+
+// sumFile is where the sha256 of a model downloaded into the cache is
+// recorded, so a pin can be checked without hashing the model on every run
+func sumFile(modelPath string) string {
+	return modelPath + classifier.ModelSumSuffix
+}
+
+// seededSumFile is where the sha256 of a model seeded into IC_MODEL_DIR is
+// recorded. Sums next to seeded models were not written by this tool, so
+// they are never trusted; instead the sum goes into the cache under a name
+// derived from the model's path, size and modification time, and any
+// change to the model leads to a fresh hash. It returns "" when the model
+// cannot be examined, so it is hashed.
+func seededSumFile(modelPath string) string {
+	abs, err := filepath.Abs(modelPath)
+	if err != nil {
+		return ""
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return ""
+	}
+	key := fmt.Sprintf("%s\x00%d\x00%d", abs, info.Size(), info.ModTime().UnixNano())
+	return filepath.Join(classifier.CacheDir(), classifier.CacheModels, "seeded", classifier.HashContent(key)[:16]+classifier.ModelSumSuffix)
+}
+
+// writeSum records at sums the sha256 and size of the model at modelPath
+func writeSum(sums string, modelPath string, sum string) error {
+	info, err := os.Stat(modelPath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(sums), 0755); err != nil {
+		return err
+	}
+	return classifier.WriteFileAtomic(sums, []byte(fmt.Sprintf("%s %d\n", sum, info.Size())))
+}
+
+// verifyModel checks the GGUF header of the model at path and, if pin is
+// set, its sha256. With sums set, the sum recorded there by writeSum is
+// trusted while the size still matches, so the file is hashed only once;
+// without it, e.g. for local files given by the user, the file is hashed
+// every time.
+func verifyModel(path string, pin string, sums string) error {
+	if _, err := classifier.ReadGGUFHeader(path); err != nil {
+		return err
+	}
+	if pin == "" {
+		return nil
+	}
+
+	if sums != "" {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if data, err := os.ReadFile(sums); err == nil {
+			fields := strings.Fields(string(data))
+			if len(fields) == 2 && fields[1] == strconv.FormatInt(info.Size(), 10) {
+				if fields[0] != pin {
+					return checksumError(path, pin, fields[0])
+				}
+				return nil
+			}
+		}
+	}
+
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	if sum != pin {
+		return checksumError(path, pin, sum)
+	}
+	if sums != "" {
+		writeSum(sums, path, sum)
+	}
+	return nil
+}
+
+// libraryMagics are the leading bytes of shared libraries: ELF, Mach-O
+// (32 and 64 bit, both byte orders, universal) and PE
+var libraryMagics = [][]byte{
+	[]byte("\x7fELF"),
+	{0xfe, 0xed, 0xfa, 0xce}, {0xce, 0xfa, 0xed, 0xfe},
+	{0xfe, 0xed, 0xfa, 0xcf}, {0xcf, 0xfa, 0xed, 0xfe},
+	{0xca, 0xfe, 0xba, 0xbe},
+	[]byte("MZ"),
+}
+
+// verifyLibrary checks that path is a shared library and, if pin is set,
+// that its sha256 matches
+func verifyLibrary(path string, pin string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	head := make([]byte, 4)
+	n, _ := io.ReadFull(file, head)
+	isLibrary := false
+	for _, magic := range libraryMagics {
+		isLibrary = isLibrary || bytes.HasPrefix(head[:n], magic)
+	}
+	if !isLibrary {
+		return fmt.Errorf("%s is not a shared library", path)
+	}
+
+	if pin == "" {
+		return nil
+	}
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	if sum != strings.ToLower(pin) {
+		return checksumError(path, strings.ToLower(pin), sum)
+	}
+	return nil
+}
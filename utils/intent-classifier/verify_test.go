@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"intent-classifier/classifier"
+)
+
+func TestParseModelSpec(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+
+	tests := []struct {
+		spec    string
+		want    modelSpec
+		wantErr bool
+	}{
+		{"https://example.com/model.gguf", modelSpec{Location: "https://example.com/model.gguf"}, false},
+		{"https://example.com/model.gguf#sha256=" + sum, modelSpec{Location: "https://example.com/model.gguf", SHA256: sum}, false},
+		{"./model.gguf#sha256=" + strings.ToUpper(sum), modelSpec{Location: "./model.gguf", SHA256: sum}, false},
+		{"https://example.com/model.gguf#sha256=abc", modelSpec{}, true},
+		{"https://example.com/model.gguf#sha256=" + strings.Repeat("zz", 32), modelSpec{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parseModelSpec(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseModelSpec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseModelSpec() = %+v, expected %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyModel(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "model.gguf")
+	if err := os.WriteFile(path, testGGUF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	pin := sha256Hex(testGGUF)
+
+	if err := verifyModel(path, "", ""); err != nil {
+		t.Errorf("verifyModel() unpinned error = %v", err)
+	}
+	if err := verifyModel(path, pin, ""); err != nil {
+		t.Errorf("verifyModel() pinned error = %v", err)
+	}
+	if _, err := os.Stat(sumFile(path)); !os.IsNotExist(err) {
+		t.Error("expected no checksum file next to a local model")
+	}
+
+	// Downloaded models record their sum and trust it while the size matches
+	if err := verifyModel(path, pin, sumFile(path)); err != nil {
+		t.Errorf("verifyModel() downloaded error = %v", err)
+	}
+	if err := writeSum(sumFile(path), path, sha256Hex([]byte("other"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyModel(path, pin, sumFile(path)); err == nil {
+		t.Error("expected the recorded sum to be checked against the pin")
+	}
+
+	if err := os.WriteFile(path, []byte("<html>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyModel(path, "", ""); err == nil {
+		t.Error("expected an error for a file that is not a GGUF model")
+	}
+}
+
+func TestVerifySeededModel(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	path := filepath.Join(t.TempDir(), "model.gguf")
+	if err := os.WriteFile(path, testGGUF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	pin := sha256Hex(testGGUF)
+
+	// A sum seeded next to the model is ignored, so a forged one does not pass
+	tampered := append([]byte{}, testGGUF...)
+	tampered[8] = 2 // tensor count, so the header stays valid
+	if err := os.WriteFile(path, tampered, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(sumFile(path), []byte(fmt.Sprintf("%s %d\n", pin, len(tampered))), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyModel(path, pin, seededSumFile(path)); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("verifyModel() error = %v, expected a tampered seeded model to fail despite the sum next to it", err)
+	}
+
+	// The verified sum is recorded in the cache and keyed by size and mtime
+	if err := os.WriteFile(path, testGGUF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sums := seededSumFile(path)
+	if strings.HasPrefix(sums, filepath.Dir(path)) || !strings.HasPrefix(sums, classifier.CacheDir()) {
+		t.Errorf("seededSumFile() = %s, expected a file in the cache", sums)
+	}
+	if err := verifyModel(path, pin, sums); err != nil {
+		t.Fatalf("verifyModel() seeded error = %v", err)
+	}
+	if _, err := os.Stat(sums); err != nil {
+		t.Errorf("expected the sum to be recorded: %v", err)
+	}
+
+	// Same size, new content and mtime: the record no longer applies
+	if err := os.WriteFile(path, tampered, 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if seededSumFile(path) == sums {
+		t.Error("expected a new record once the model changed")
+	}
+	if err := verifyModel(path, pin, seededSumFile(path)); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("verifyModel() error = %v, expected the changed seeded model to be hashed again", err)
+	}
+}
+
+func TestVerifyLibrary(t *testing.T) {
+	dir := t.TempDir()
+	elf := []byte("\x7fELF\x02\x01\x01")
+
+	tests := []struct {
+		name    string
+		data    []byte
+		pin     string
+		wantErr bool
+	}{
+		{"elf", elf, "", false},
+		{"pe", []byte("MZ\x90\x00"), "", false},
+		{"mach-o", []byte{0xcf, 0xfa, 0xed, 0xfe, 0x07}, "", false},
+		{"pinned", elf, strings.ToUpper(sha256Hex(elf)), false},
+		{"wrong pin", elf, sha256Hex([]byte("other")), true},
+		{"html", []byte("<html>"), "", true},
+		{"empty", nil, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := verifyLibrary(path, tt.pin); (err != nil) != tt.wantErr {
+				t.Errorf("verifyLibrary() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPinsAreSHA256(t *testing.T) {
+	pins := make(map[string]string)
+	for spec, pin := range presetPins {
+		pins[spec] = pin
+	}
+	for build, pin := range llamaPins {
+		pins[fmt.Sprintf("llama.cpp %s (%s, %s)", build.version, build.os, build.processor)] = pin
+	}
+
+	for name, pin := range pins {
+		if pin == "" {
+			continue // not recorded yet
+		}
+		parsed, err := parseModelSpec("pin#sha256=" + pin)
+		if err != nil || parsed.SHA256 != pin {
+			t.Errorf("pin of %s = %q, expected 64 lowercase hex digits", name, pin)
+		}
+	}
+}